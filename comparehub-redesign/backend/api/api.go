@@ -0,0 +1,87 @@
+// Package api holds the response contract shared by handlers and middleware.
+//
+// Routes under /v1 always answer with an Envelope:
+//
+//	{"data": ..., "meta": {...}}                       on success
+//	{"error": {"code": "...", "message": "...", ...}}  on failure
+//
+// The unversioned legacy routes keep their historical shapes (bare arrays,
+// {"offers": [...]}, {"error": "..."}) until clients have migrated.
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Code is a stable, machine-readable error identifier.
+type Code string
+
+const (
+	CodeInvalidArgument Code = "invalid_argument"
+	CodeUnauthorized    Code = "unauthorized"
+	CodeForbidden       Code = "forbidden"
+	CodeNotFound        Code = "not_found"
+	CodeConflict        Code = "conflict"
+	CodeTimeout         Code = "timeout"
+	CodeRateLimited     Code = "rate_limited"
+	CodeInternal        Code = "internal"
+)
+
+// ErrorBody is the "error" member of a v1 envelope.
+type ErrorBody struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+	// RequestID lets clients quote the failing request to support.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Envelope is the body of every /v1 response.
+type Envelope struct {
+	Data  any        `json:"data,omitempty"`
+	Meta  gin.H      `json:"meta,omitempty"`
+	Error *ErrorBody `json:"error,omitempty"`
+}
+
+const versionKey = "api.version"
+
+// V1 marks every request in the group as a v1 request so handlers answer
+// with the envelope.
+func V1() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(versionKey, "v1")
+		c.Next()
+	}
+}
+
+// IsV1 reports whether the request came in through the /v1 group.
+func IsV1(c *gin.Context) bool {
+	return c.GetString(versionKey) == "v1"
+}
+
+// OK writes a successful response. v1 requests get data and meta wrapped in
+// an Envelope; legacy requests get legacy exactly as before.
+func OK(c *gin.Context, status int, data any, meta gin.H, legacy any) {
+	if IsV1(c) {
+		c.JSON(status, Envelope{Data: data, Meta: meta})
+		return
+	}
+	c.JSON(status, legacy)
+}
+
+// Fail writes an error response and aborts the chain. Legacy requests get
+// the historical {"error": message} body.
+func Fail(c *gin.Context, status int, code Code, message string, details any) {
+	reqID := c.GetString(RequestIDKey)
+	if IsV1(c) {
+		c.AbortWithStatusJSON(status, Envelope{Error: &ErrorBody{
+			Code: code, Message: message, Details: details, RequestID: reqID,
+		}})
+		return
+	}
+	body := gin.H{"error": message}
+	if reqID != "" {
+		body["requestId"] = reqID
+	}
+	c.AbortWithStatusJSON(status, body)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/store"
+)
+
+// RequestIDKey is the gin context key holding the id of the current request
+// (set by middleware.RequestID).
+const RequestIDKey = "request_id"
+
+// Error is an error that is safe to show to clients. Message never contains
+// driver output; the underlying cause (if any) is kept in Err for the logs.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Details any
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return string(e.Code) + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return string(e.Code) + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func NotFound(message string) *Error {
+	return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: message}
+}
+
+func InvalidArgument(message string, details any) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidArgument, Message: message, Details: details}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: message}
+}
+
+// Postgres error codes we translate instead of reporting as internal.
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+	pqNotNullViolation    = "23502"
+	pqCheckViolation      = "23514"
+	pqInvalidText         = "22P02"
+	pqNumericOutOfRange   = "22003"
+	pqQueryCanceled       = "57014"
+)
+
+// StatusClientClosedRequest is logged when the client hung up before we
+// answered. Nothing is written back; there is nobody left to read it.
+const StatusClientClosedRequest = 499
+
+// FromError classifies err. *Error values pass through, sql.ErrNoRows becomes
+// not_found, known Postgres constraint errors become client errors, an
+// exceeded deadline becomes timeout, and everything else is internal.
+func FromError(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Status: http.StatusGatewayTimeout, Code: CodeTimeout, Message: "request timed out", Err: err}
+	}
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, store.ErrNotFound) {
+		return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: "not found", Err: err}
+	}
+	if errors.Is(err, store.ErrInvalidReference) {
+		return &Error{Status: http.StatusUnprocessableEntity, Code: CodeInvalidArgument, Message: "referenced resource does not exist", Err: err}
+	}
+	if errors.Is(err, store.ErrConflict) {
+		return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: "resource already exists", Err: err}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: "resource already exists", Err: err}
+		case pqForeignKeyViolation:
+			return &Error{Status: http.StatusUnprocessableEntity, Code: CodeInvalidArgument, Message: "referenced resource does not exist", Err: err}
+		case pqNotNullViolation, pqCheckViolation:
+			return &Error{Status: http.StatusBadRequest, Code: CodeInvalidArgument, Message: "missing or invalid field", Err: err}
+		case pqInvalidText, pqNumericOutOfRange:
+			return &Error{Status: http.StatusBadRequest, Code: CodeInvalidArgument, Message: "malformed parameter", Err: err}
+		case pqQueryCanceled:
+			return &Error{Status: http.StatusGatewayTimeout, Code: CodeTimeout, Message: "request timed out", Err: err}
+		}
+	}
+
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal server error", Err: err}
+}
+
+// Abort classifies err, logs the cause together with the request id and
+// writes a sanitized error response. Drivers do not always report a
+// cancelled query as the context's error, so when the request context is
+// done that takes precedence over the classification of err.
+func Abort(c *gin.Context, err error) {
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx).With("method", c.Request.Method, "route", c.FullPath())
+	switch ctxErr := ctx.Err(); {
+	case errors.Is(ctxErr, context.Canceled):
+		logger.Info("client closed request", "status", StatusClientClosedRequest, "err", err)
+		c.AbortWithStatus(StatusClientClosedRequest)
+		return
+	case ctxErr != nil && !errors.Is(err, ctxErr):
+		err = errors.Join(ctxErr, err)
+	}
+	e := FromError(err)
+	if e.Err != nil {
+		level := slog.LevelWarn
+		if e.Status >= 500 {
+			level = slog.LevelError
+		}
+		logger.Log(ctx, level, "request failed", "status", e.Status, "code", e.Code, "err", e.Err)
+	}
+	Fail(c, e.Status, e.Code, e.Message, e.Details)
+}
@@ -0,0 +1,205 @@
+// Package cache is the read cache in front of the catalog queries behind
+// /products, /products/:id, /compare and /analytics/top-deals.
+//
+// Entries are JSON values in a Backend (a per-process LRU or a
+// Redis-compatible server) under keys built from the normalized query.
+// Every key embeds the backend's current generation; Invalidate bumps the
+// generation, so all earlier entries stop being read at once, on every
+// instance sharing the backend, and a query that was already running
+// cannot write a stale value under the new generation.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go-ecommerce-backend/config"
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/metrics"
+)
+
+// Backend stores raw entries. Get reports a missing or expired key as
+// ok=false, not as an error.
+type Backend interface {
+	Name() string
+	Get(ctx context.Context, key string) (val []byte, ok bool, err error)
+	Set(ctx context.Context, key string, val []byte, ttl time.Duration) error
+	// Generation returns the current invalidation generation; Bump
+	// advances it.
+	Generation(ctx context.Context) (uint64, error)
+	Bump(ctx context.Context) (uint64, error)
+	// Len is the number of entries held, or -1 if the backend cannot tell.
+	Len() int
+	Evictions() uint64
+}
+
+// Cache counts lookups around a Backend. A Cache with no backend (caching
+// disabled) passes every lookup through to the loader.
+type Cache struct {
+	backend Backend
+	ttl     time.Duration
+
+	hits, misses, bypasses, invalidations, errors atomic.Uint64
+}
+
+// New builds the cache described by cfg.
+func New(cfg config.Cache) (*Cache, error) {
+	if !cfg.Enabled {
+		return &Cache{}, nil
+	}
+	switch cfg.Backend {
+	case "memory":
+		return &Cache{backend: NewLRU(cfg.MaxEntries), ttl: cfg.TTL.Std()}, nil
+	case "redis":
+		b, err := NewRedis(cfg.RedisURL, cfg.KeyPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return &Cache{backend: b, ttl: cfg.TTL.Std()}, nil
+	}
+	return nil, fmt.Errorf("cache: unknown backend %q", cfg.Backend)
+}
+
+// WithBackend returns a cache over b; tests use it with their own LRU or
+// Redis server.
+func WithBackend(b Backend, ttl time.Duration) *Cache {
+	return &Cache{backend: b, ttl: ttl}
+}
+
+// Close releases the backend's connections, if it holds any.
+func (c *Cache) Close() error {
+	if cl, ok := c.backend.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
+
+// Shared reports whether invalidations reach other processes, which is
+// what a CLI import needs to refresh running servers.
+func (c *Cache) Shared() bool {
+	return c.backend != nil && c.backend.Name() != "memory"
+}
+
+// Invalidate drops every entry, here and on every instance sharing the
+// backend. Callers run it after a sync or an admin write.
+func (c *Cache) Invalidate(ctx context.Context) error {
+	if c.backend == nil {
+		return nil
+	}
+	gen, err := c.backend.Bump(ctx)
+	if err != nil {
+		c.errors.Add(1)
+		return fmt.Errorf("cache invalidate: %w", err)
+	}
+	c.invalidations.Add(1)
+	logging.FromContext(ctx).Debug("cache invalidated", "generation", gen)
+	return nil
+}
+
+// Stats is the /admin/cache/stats body.
+type Stats struct {
+	Backend       string  `json:"backend"`
+	Generation    uint64  `json:"generation"`
+	Entries       int     `json:"entries"`
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	Bypasses      uint64  `json:"bypasses"`
+	HitRatio      float64 `json:"hitRatio"`
+	Invalidations uint64  `json:"invalidations"`
+	Evictions     uint64  `json:"evictions"`
+	Errors        uint64  `json:"errors"`
+}
+
+// Stats reports this process's counters. With a shared backend Generation
+// and Entries are global; the rest are per instance.
+func (c *Cache) Stats(ctx context.Context) Stats {
+	s := Stats{
+		Backend:       "disabled",
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Bypasses:      c.bypasses.Load(),
+		Invalidations: c.invalidations.Load(),
+		Errors:        c.errors.Load(),
+	}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRatio = float64(s.Hits) / float64(total)
+	}
+	if c.backend != nil {
+		s.Backend = c.backend.Name()
+		s.Entries = c.backend.Len()
+		s.Evictions = c.backend.Evictions()
+		s.Generation, _ = c.backend.Generation(ctx)
+	}
+	return s
+}
+
+// Fetch returns the cached value for key, or calls load and caches its
+// result. name labels the lookup in metrics ("products.list"). Backend
+// failures are logged and counted but never fail the request: the value is
+// then simply loaded from the database.
+func Fetch[T any](ctx context.Context, c *Cache, name, key string, load func() (T, error)) (T, error) {
+	if c == nil || c.backend == nil {
+		return load()
+	}
+	st := stateFrom(ctx)
+	if st != nil && st.bypass {
+		c.bypasses.Add(1)
+		st.bypassed.Store(true)
+		return load()
+	}
+
+	logger := logging.FromContext(ctx)
+	gen, err := c.backend.Generation(ctx)
+	if err != nil {
+		c.errors.Add(1)
+		logger.Warn("cache generation lookup failed", "backend", c.backend.Name(), "err", err)
+		return load()
+	}
+	full := strconv.FormatUint(gen, 10) + ":" + name + ":" + key
+
+	if raw, ok, err := c.backend.Get(ctx, full); err != nil {
+		c.errors.Add(1)
+		logger.Warn("cache get failed", "backend", c.backend.Name(), "err", err)
+	} else if ok {
+		var v T
+		if err := json.Unmarshal(raw, &v); err == nil {
+			c.hit(st, name, true)
+			return v, nil
+		}
+		c.errors.Add(1)
+	}
+
+	c.hit(st, name, false)
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+	if raw, err := json.Marshal(v); err != nil {
+		c.errors.Add(1)
+	} else if err := c.backend.Set(ctx, full, raw, c.ttl); err != nil {
+		c.errors.Add(1)
+		logger.Warn("cache set failed", "backend", c.backend.Name(), "err", err)
+	}
+	return v, nil
+}
+
+func (c *Cache) hit(st *state, name string, hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	metrics.CacheLookup(name, hit)
+	if st != nil {
+		if hit {
+			st.hits.Add(1)
+		} else {
+			st.misses.Add(1)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"go-ecommerce-backend/store"
+	"go-ecommerce-backend/store/memory"
+)
+
+func TestLRUEvictsLeastRecentlyUsedAndExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLRU(2)
+	l.now = func() time.Time { return now }
+
+	_ = l.Set(ctx, "a", []byte("1"), time.Minute)
+	_ = l.Set(ctx, "b", []byte("2"), time.Minute)
+	if _, ok, _ := l.Get(ctx, "a"); !ok { // a is now the most recent
+		t.Fatal("a missing")
+	}
+	_ = l.Set(ctx, "c", []byte("3"), time.Minute)
+
+	if _, ok, _ := l.Get(ctx, "b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if l.Len() != 2 || l.Evictions() != 1 {
+		t.Errorf("len=%d evictions=%d, want 2 and 1", l.Len(), l.Evictions())
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := l.Get(ctx, "a"); ok {
+		t.Error("a should have expired")
+	}
+}
+
+func TestProductQueryKeyNormalizes(t *testing.T) {
+	a := store.ProductQuery{Search: "Laptop", Offers: store.OfferFilter{Stores: []string{"Walmart", "Best Buy"}}}
+	b := store.ProductQuery{Search: "laptop", Offers: store.OfferFilter{Condition: "Any", Stores: []string{"bestbuy", "walmart", "Walmart"}}}
+	if ProductQueryKey(a, true) != ProductQueryKey(b, true) {
+		t.Errorf("equivalent queries got different keys:\n%s\n%s", ProductQueryKey(a, true), ProductQueryKey(b, true))
+	}
+
+	c := b
+	c.Offers.Condition = "New"
+	if ProductQueryKey(b, true) == ProductQueryKey(c, true) {
+		t.Error("condition must be part of the key")
+	}
+
+	d := b
+	d.Offset = 24
+	if ProductQueryKey(b, true) == ProductQueryKey(d, true) {
+		t.Error("paging must be part of the listing key")
+	}
+	if ProductQueryKey(b, false) != ProductQueryKey(d, false) {
+		t.Error("paging must not be part of the count key")
+	}
+}
+
+func seeded(t *testing.T) store.Stores {
+	t.Helper()
+	ctx := context.Background()
+	m := memory.New()
+	id, err := m.CreateProduct(ctx, store.Product{Name: "Pixel 9", Brand: "Google", Category: "Phones"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateOffer(ctx, store.NewOffer{ProductID: id, StoreName: "Amazon", Price: 799, Condition: "New"}); err != nil {
+		t.Fatal(err)
+	}
+	return m.Stores()
+}
+
+func TestWrapCachesReadsAndInvalidatesOnWrites(t *testing.T) {
+	ctx := context.Background()
+	c := WithBackend(NewLRU(100), time.Minute)
+	st := Wrap(seeded(t), c)
+
+	f := store.OfferFilter{Stores: []string{"Amazon", "Walmart"}}
+	deals := func() []store.TopDealRow {
+		t.Helper()
+		rows, err := st.Products.TopDeals(ctx, f, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	first := deals()
+	deals()
+	if s := c.Stats(ctx); s.Hits != 1 || s.Misses != 1 || s.Entries != 1 {
+		t.Fatalf("stats = %+v, want 1 hit, 1 miss, 1 entry", s)
+	}
+
+	// A cheaper offer through the wrapped store must show up right away.
+	if err := st.Offers.CreateOffer(ctx, store.NewOffer{ProductID: int(first[0].ID), StoreName: "Walmart", Price: 699, Condition: "New"}); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Stats(ctx); s.Invalidations != 1 || s.Generation != 1 || s.Entries != 0 {
+		t.Fatalf("stats after write = %+v", s)
+	}
+	if got := deals(); *got[0].BestPrice != 699 {
+		t.Errorf("best price after invalidation = %v, want 699", *got[0].BestPrice)
+	}
+}
+
+func TestFetchBypass(t *testing.T) {
+	c := WithBackend(NewLRU(100), time.Minute)
+	st := &state{bypass: true}
+	ctx := context.WithValue(context.Background(), stateKey{}, st)
+
+	loads := 0
+	for range 2 {
+		_, _ = Fetch(ctx, c, "test", "k", func() (int, error) { loads++; return 1, nil })
+	}
+	if loads != 2 {
+		t.Errorf("bypassed lookups loaded %d times, want 2", loads)
+	}
+	if s := c.Stats(ctx); s.Bypasses != 2 || s.Entries != 0 {
+		t.Errorf("stats = %+v, want 2 bypasses and nothing stored", s)
+	}
+}
+
+func TestRedisBackendSharesInvalidation(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	newCache := func() *Cache {
+		b, err := NewRedis("redis://"+srv.Addr(), "test:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { b.Close() })
+		return WithBackend(b, time.Minute)
+	}
+	a, b := newCache(), newCache()
+
+	loads := 0
+	load := func() (string, error) { loads++; return "v", nil }
+	_, _ = Fetch(ctx, a, "test", "k", load)
+	_, _ = Fetch(ctx, b, "test", "k", load) // filled by a
+	if loads != 1 {
+		t.Fatalf("loads = %d, want 1 (second instance should hit)", loads)
+	}
+
+	if err := a.Invalidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = Fetch(ctx, b, "test", "k", load)
+	if loads != 2 {
+		t.Errorf("loads = %d, want 2 (invalidation must reach the other instance)", loads)
+	}
+	if ttl := srv.TTL("test:1:test:k"); ttl != time.Minute {
+		t.Errorf("entry TTL = %v, want 1m", ttl)
+	}
+}
+
+func TestFetchFailsOpen(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	b, err := NewRedis("redis://"+srv.Addr(), "test:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	c := WithBackend(b, time.Minute)
+	srv.Close()
+
+	v, err := Fetch(ctx, c, "test", "k", func() (string, error) { return "fresh", nil })
+	if err != nil || v != "fresh" {
+		t.Fatalf("Fetch with the backend down = %q, %v; want the loaded value", v, err)
+	}
+	if c.Stats(ctx).Errors == 0 {
+		t.Error("backend error not counted")
+	}
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/api"
+)
+
+const (
+	// BypassHeader set to any non-empty value makes the request skip the
+	// cache (it neither reads nor fills it), for debugging stale answers.
+	// It is ignored unless the server allows it (cache.allowBypass), since
+	// anyone could otherwise send every request straight to the database.
+	BypassHeader = "X-Cache-Bypass"
+	// StatusHeader reports HIT (every lookup was served from the cache),
+	// MISS (at least one was loaded) or BYPASS.
+	StatusHeader = "X-Cache"
+)
+
+// state tracks the lookups of one request.
+type state struct {
+	bypass       bool
+	bypassed     atomic.Bool
+	hits, misses atomic.Int32
+}
+
+type stateKey struct{}
+
+func stateFrom(ctx context.Context) *state {
+	st, _ := ctx.Value(stateKey{}).(*state)
+	return st
+}
+
+// Middleware sets StatusHeader on responses that looked anything up and,
+// if allowBypass is set, honours BypassHeader.
+func Middleware(allowBypass bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := &state{bypass: allowBypass && c.GetHeader(BypassHeader) != ""}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), stateKey{}, st))
+		c.Writer = &statusWriter{ResponseWriter: c.Writer, st: st}
+		c.Next()
+	}
+}
+
+// statusWriter adds StatusHeader just before the headers go out, when
+// every lookup of the request has happened.
+type statusWriter struct {
+	gin.ResponseWriter
+	st *state
+}
+
+func (w *statusWriter) setHeader() {
+	if w.Written() {
+		return
+	}
+	switch {
+	case w.st.bypassed.Load():
+		w.Header().Set(StatusHeader, "BYPASS")
+	case w.st.misses.Load() > 0:
+		w.Header().Set(StatusHeader, "MISS")
+	case w.st.hits.Load() > 0:
+		w.Header().Set(StatusHeader, "HIT")
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection (exports
+// extend their write deadline through it).
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.setHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// GET /admin/cache/stats
+func StatsHandler(c *Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		s := c.Stats(ctx.Request.Context())
+		api.OK(ctx, http.StatusOK, s, nil, s)
+	}
+}
+
+// POST /admin/cache/invalidate
+func InvalidateHandler(c *Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if err := c.Invalidate(ctx.Request.Context()); err != nil {
+			api.Abort(ctx, err)
+			return
+		}
+		api.OK(ctx, http.StatusOK, gin.H{"ok": true}, nil, gin.H{"ok": true})
+	}
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStatusHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := WithBackend(NewLRU(100), time.Minute)
+	r := gin.New()
+	r.Use(Middleware(true))
+	r.GET("/cached", func(ctx *gin.Context) {
+		v, _ := Fetch(ctx.Request.Context(), c, "test", "k", func() (int, error) { return 1, nil })
+		ctx.JSON(http.StatusOK, v)
+	})
+	r.GET("/uncached", func(ctx *gin.Context) { ctx.JSON(http.StatusOK, 1) })
+
+	get := func(path string, bypass bool) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if bypass {
+			req.Header.Set(BypassHeader, "1")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Header().Get(StatusHeader)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		bypass bool
+		want   string
+	}{
+		{"/cached", false, "MISS"},
+		{"/cached", false, "HIT"},
+		{"/cached", true, "BYPASS"},
+		{"/uncached", false, ""},
+	} {
+		if got := get(tc.path, tc.bypass); got != tc.want {
+			t.Errorf("%s (bypass=%v): %s = %q, want %q", tc.path, tc.bypass, StatusHeader, got, tc.want)
+		}
+	}
+}
+
+func TestBypassNotAllowed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := WithBackend(NewLRU(100), time.Minute)
+	r := gin.New()
+	r.Use(Middleware(false))
+	r.GET("/cached", func(ctx *gin.Context) {
+		v, _ := Fetch(ctx.Request.Context(), c, "test", "k", func() (int, error) { return 1, nil })
+		ctx.JSON(http.StatusOK, v)
+	})
+
+	for _, want := range []string{"MISS", "HIT"} {
+		req := httptest.NewRequest(http.MethodGet, "/cached", nil)
+		req.Header.Set(BypassHeader, "1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got := w.Header().Get(StatusHeader); got != want {
+			t.Errorf("%s = %q, want %q: the header must be ignored", StatusHeader, got, want)
+		}
+	}
+}
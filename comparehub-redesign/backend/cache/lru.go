@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is the in-process Backend: at most max entries, least recently used
+// evicted first, each entry expiring after its TTL.
+type LRU struct {
+	mu        sync.Mutex
+	max       int
+	ll        *list.List // front = most recently used
+	items     map[string]*list.Element
+	gen       uint64
+	evictions uint64
+
+	now func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	val     []byte
+	expires time.Time
+}
+
+func NewLRU(max int) *LRU {
+	return &LRU{max: max, ll: list.New(), items: map[string]*list.Element{}, now: time.Now}
+}
+
+func (l *LRU) Name() string { return "memory" }
+
+func (l *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*lruEntry)
+	if !l.now().Before(e.expires) {
+		l.remove(el)
+		return nil, false, nil
+	}
+	l.ll.MoveToFront(el)
+	return e.val, true, nil
+}
+
+func (l *LRU) Set(_ context.Context, key string, val []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expires := l.now().Add(ttl)
+	if el, ok := l.items[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.val, e.expires = val, expires
+		l.ll.MoveToFront(el)
+		return nil
+	}
+	l.items[key] = l.ll.PushFront(&lruEntry{key: key, val: val, expires: expires})
+	for l.ll.Len() > l.max {
+		l.remove(l.ll.Back())
+		l.evictions++
+	}
+	return nil
+}
+
+func (l *LRU) remove(el *list.Element) {
+	l.ll.Remove(el)
+	delete(l.items, el.Value.(*lruEntry).key)
+}
+
+func (l *LRU) Generation(context.Context) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.gen, nil
+}
+
+// Bump also frees every entry; they could never be read again anyway.
+func (l *LRU) Bump(context.Context) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.gen++
+	l.ll.Init()
+	l.items = map[string]*list.Element{}
+	return l.gen, nil
+}
+
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len()
+}
+
+func (l *LRU) Evictions() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.evictions
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a Backend on any server speaking the Redis protocol (Redis,
+// Valkey, KeyDB, ...). Entries expire through the server's TTL; the
+// generation is a counter key, so an invalidation from one instance is
+// seen by all of them.
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis connects lazily to url (redis://[:password@]host:port/db or
+// rediss:// for TLS); nothing is dialled until the first lookup.
+func NewRedis(url, prefix string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("cache: REDIS_URL: %w", err)
+	}
+	// A slow cache is worse than none: fail fast and load from Postgres.
+	opts.DialTimeout = 500 * time.Millisecond
+	opts.ReadTimeout = 200 * time.Millisecond
+	opts.WriteTimeout = 200 * time.Millisecond
+	return &Redis{client: redis.NewClient(opts), prefix: prefix}, nil
+}
+
+func (r *Redis) Name() string { return "redis" }
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	b, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+key, val, ttl).Err()
+}
+
+func (r *Redis) Generation(ctx context.Context) (uint64, error) {
+	n, err := r.client.Get(ctx, r.prefix+"generation").Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// Bump leaves the old generation's entries to expire through their TTL.
+func (r *Redis) Bump(ctx context.Context) (uint64, error) {
+	n, err := r.client.Incr(ctx, r.prefix+"generation").Result()
+	return uint64(n), err
+}
+
+func (r *Redis) Len() int { return -1 }
+
+// Evictions is always 0: the server evicts on its own (see its INFO stats).
+func (r *Redis) Evictions() uint64 { return 0 }
+
+func (r *Redis) Close() error { return r.client.Close() }
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/store"
+)
+
+// Wrap puts c in front of the catalog reads of st and invalidates it after
+// the admin writes that go through st. Analytics and admin accounts are
+// never cached.
+func Wrap(st store.Stores, c *Cache) store.Stores {
+	st.Products = &products{ProductStore: st.Products, c: c}
+	st.Offers = &offers{OfferStore: st.Offers, c: c}
+	st.Specs = &specs{SpecStore: st.Specs, c: c}
+	return st
+}
+
+// invalidateAfter invalidates the cache once a write has succeeded. A
+// failed invalidation is logged, not returned: the write itself is done
+// and the TTL bounds the staleness.
+func (c *Cache) invalidateAfter(ctx context.Context, err error) error {
+	if err == nil {
+		if ierr := c.Invalidate(ctx); ierr != nil {
+			logging.FromContext(ctx).Warn("cache invalidation after write failed", "err", ierr)
+		}
+	}
+	return err
+}
+
+type products struct {
+	store.ProductStore
+	c *Cache
+}
+
+func (p *products) ListProducts(ctx context.Context, q store.ProductQuery) ([]store.ProductRow, error) {
+	return Fetch(ctx, p.c, "products.list", ProductQueryKey(q, true), func() ([]store.ProductRow, error) {
+		return p.ProductStore.ListProducts(ctx, q)
+	})
+}
+
+func (p *products) CountProducts(ctx context.Context, q store.ProductQuery) (int64, error) {
+	return Fetch(ctx, p.c, "products.count", ProductQueryKey(q, false), func() (int64, error) {
+		return p.ProductStore.CountProducts(ctx, q)
+	})
+}
+
+func (p *products) GetProduct(ctx context.Context, id int) (store.Product, error) {
+	return Fetch(ctx, p.c, "products.get", strconv.Itoa(id), func() (store.Product, error) {
+		return p.ProductStore.GetProduct(ctx, id)
+	})
+}
+
+func (p *products) GetProducts(ctx context.Context, ids []int) ([]store.Product, error) {
+	return Fetch(ctx, p.c, "products.get_many", idsKey(ids), func() ([]store.Product, error) {
+		return p.ProductStore.GetProducts(ctx, ids)
+	})
+}
+
+func (p *products) TopDeals(ctx context.Context, f store.OfferFilter, limit int) ([]store.TopDealRow, error) {
+	key := offerFilterValues(f)
+	key.Set("limit", strconv.Itoa(limit))
+	return Fetch(ctx, p.c, "products.top_deals", key.Encode(), func() ([]store.TopDealRow, error) {
+		return p.ProductStore.TopDeals(ctx, f, limit)
+	})
+}
+
+func (p *products) CreateProduct(ctx context.Context, prod store.Product) (int, error) {
+	id, err := p.ProductStore.CreateProduct(ctx, prod)
+	return id, p.c.invalidateAfter(ctx, err)
+}
+
+type offers struct {
+	store.OfferStore
+	c *Cache
+}
+
+func (o *offers) ListOffers(ctx context.Context, productIDs []int, f store.OfferFilter) ([]store.Offer, error) {
+	key := offerFilterValues(f)
+	key.Set("ids", idsKey(productIDs))
+	return Fetch(ctx, o.c, "offers.list", key.Encode(), func() ([]store.Offer, error) {
+		return o.OfferStore.ListOffers(ctx, productIDs, f)
+	})
+}
+
+func (o *offers) CreateOffer(ctx context.Context, n store.NewOffer) error {
+	return o.c.invalidateAfter(ctx, o.OfferStore.CreateOffer(ctx, n))
+}
+
+type specs struct {
+	store.SpecStore
+	c *Cache
+}
+
+func (s *specs) GetSpecs(ctx context.Context, productIDs []int) (map[int]store.Specs, error) {
+	return Fetch(ctx, s.c, "specs.get", idsKey(productIDs), func() (map[int]store.Specs, error) {
+		return s.SpecStore.GetSpecs(ctx, productIDs)
+	})
+}
+
+func (s *specs) UpsertSpecs(ctx context.Context, productID int, data map[string]any) error {
+	return s.c.invalidateAfter(ctx, s.SpecStore.UpsertSpecs(ctx, productID, data))
+}
+
+// ProductQueryKey is the canonical form of q: parameters in a fixed order,
+// stores normalized, de-duplicated and sorted, the "" and "Any" conditions
+// folded together and the search lower-cased (it is matched
+// case-insensitively). Queries that select the same rows get the same key.
+// withPage includes sort and paging, which CountProducts ignores.
+func ProductQueryKey(q store.ProductQuery, withPage bool) string {
+	v := offerFilterValues(q.Offers)
+	v.Set("q", strings.ToLower(q.Search))
+	v.Set("category", q.Category)
+	v.Set("brand", q.Brand)
+	setFloat(v, "min_price", q.MinPrice)
+	setFloat(v, "max_price", q.MaxPrice)
+	setFloat(v, "min_rating", q.MinRating)
+	if withPage {
+		v.Set("sort", q.Sort)
+		v.Set("limit", strconv.Itoa(q.Limit))
+		v.Set("offset", strconv.Itoa(q.Offset))
+		if q.After != nil {
+			v.Set("after", strconv.FormatFloat(q.After.Key, 'g', -1, 64)+","+strconv.Itoa(q.After.ID))
+		}
+	}
+	return v.Encode() // Encode sorts by parameter name
+}
+
+func offerFilterValues(f store.OfferFilter) url.Values {
+	cond := f.Condition
+	if cond == "" {
+		cond = "Any" // the stores treat both alike
+	}
+	stores := store.StoreKeys(f.Stores)
+	slices.Sort(stores)
+	stores = slices.Compact(stores)
+	return url.Values{"condition": {cond}, "stores": {strings.Join(stores, ",")}}
+}
+
+func setFloat(v url.Values, name string, f *float64) {
+	if f != nil {
+		v.Set(name, strconv.FormatFloat(*f, 'g', -1, 64))
+	}
+}
+
+// idsKey is the sorted, de-duplicated id list; the stores answer in id
+// order regardless of the order asked for.
+func idsKey(ids []int) string {
+	sorted := slices.Clone(ids)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+	parts := make([]string, len(sorted))
+	for i, id := range sorted {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
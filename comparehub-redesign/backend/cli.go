@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-ecommerce-backend/cache"
+	"go-ecommerce-backend/config"
+	"go-ecommerce-backend/db"
+	"go-ecommerce-backend/handlers"
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/migrate"
+	"go-ecommerce-backend/rollup"
+	"go-ecommerce-backend/store/postgres"
+	syncer "go-ecommerce-backend/sync"
+	"go-ecommerce-backend/tracing"
+)
+
+// The comparehub binary is the server and its operations tool. Every
+// command gets the same config.Config as serve (.env, CONFIG_FILE or
+// --config, then the environment).
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(cfg *config.Config, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "", "run the HTTP API (default)", serve},
+		{"sync", "[--source NAME|PATH] [--dry-run]", "import a JSON feed once", cmdSync},
+		{"migrate", "up | down [N] | status", "apply, revert or list schema migrations", withDB(runMigrate)},
+		{"seed", "", "load the demo data in sql/", withDB(func(conn *sql.DB, _ []string) error { return runSeed(conn) })},
+		{"import", "FILE.csv [--dry-run]", "upsert products and offers from a CSV file", cmdImport},
+		{"export", "[--format csv|json] [--out FILE]", "write products with active offers", cmdExport},
+		{"create-admin", "--email EMAIL [--password PASS]", "create an admin account or reset its password", cmdCreateAdmin},
+		{"reindex-search", "", "rebuild product search indexes and planner statistics", withDB(cmdReindexSearch)},
+		{"rollup", "[--backfill]", "refresh the analytics rollups and purge expired events", cmdRollup},
+		{"config", "print [--redacted | --show-secrets]", "show the effective configuration", cmdConfig},
+	}
+}
+
+func run(args []string) error {
+	// --config FILE may precede the command.
+	configPath := ""
+	for len(args) > 0 && strings.HasPrefix(args[0], "--config") {
+		if v, ok := strings.CutPrefix(args[0], "--config="); ok {
+			configPath, args = v, args[1:]
+		} else if args[0] == "--config" && len(args) > 1 {
+			configPath, args = args[1], args[2:]
+		} else {
+			return errors.New("usage: comparehub [--config FILE] <command> [arguments]")
+		}
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	if _, err := logging.Setup(os.Stderr, cfg.Log.Level, cfg.Log.Format); err != nil {
+		return err
+	}
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Flush buffered spans; a collector that is down must not turn a
+		// successful command into a failure.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := stopTracing(ctx); err != nil {
+			slog.Warn("tracing shutdown", "err", err)
+		}
+	}()
+
+	if len(args) == 0 {
+		return serve(cfg, nil)
+	}
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage(os.Stdout)
+		return nil
+	}
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(cfg, args[1:])
+		}
+	}
+	usage(os.Stderr)
+	return fmt.Errorf("unknown command %q", name)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: comparehub [--config FILE] <command> [arguments]")
+	fmt.Fprintln(w)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-15s %-38s %s\n", c.name, c.args, c.summary)
+	}
+}
+
+// openDB validates the shared settings and connects.
+func openDB(cfg *config.Config) (*sql.DB, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return db.Open(cfg.Database)
+}
+
+func withDB(fn func(conn *sql.DB, args []string) error) func(*config.Config, []string) error {
+	return func(cfg *config.Config, args []string) error {
+		conn, err := openDB(cfg)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return fn(conn, args)
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet("comparehub "+name, flag.ContinueOnError)
+}
+
+// parseFlags allows flags before and after positional arguments
+// ("import file.csv --dry-run") and returns the positionals.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// runSeed loads the demo data. It only runs on an explicit "seed" command.
+func runSeed(conn *sql.DB) error {
+	seedFiles := []string{"sql/seed.sql", "sql/seed_specs.sql"}
+	for _, f := range seedFiles {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", f, err)
+		}
+		if _, err := conn.Exec(string(b)); err != nil {
+			return fmt.Errorf("run %s: %w", f, err)
+		}
+	}
+	slog.Info("demo seed data ready")
+	return nil
+}
+
+// runMigrate handles "migrate up|down [n]|status".
+func runMigrate(conn *sql.DB, args []string) error {
+	m := migrate.New(conn)
+	m.Logf = func(format string, args ...any) { slog.Info(fmt.Sprintf(format, args...)) }
+	ctx := context.Background()
+
+	cmd := "up"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	switch cmd {
+	case "up":
+		done, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("migrations applied", "count", len(done))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("migrate down: invalid step count %q", args[1])
+			}
+			steps = n
+		}
+		done, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		slog.Info("migrations reverted", "count", len(done))
+	case "status":
+		st, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range st {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-30s  %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q (want up, down or status)", cmd)
+	}
+	return nil
+}
+
+// resolveSource maps --source to a feed file: an existing path is used as
+// is, otherwise NAME is looked up as source_NAME.json (or NAME.json) next to
+// the default feed.
+func resolveSource(cfg *config.Config, src string) (string, error) {
+	if src == "" {
+		return cfg.Sync.FeedPath, nil
+	}
+	candidates := []string{src}
+	dir := filepath.Dir(cfg.Sync.FeedPath)
+	if !strings.ContainsAny(src, `/\`) && !strings.HasSuffix(src, ".json") {
+		candidates = append(candidates,
+			filepath.Join(dir, "source_"+src+".json"),
+			filepath.Join(dir, src+".json"))
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("no feed found for source %q (looked in %s)", src, strings.Join(candidates, ", "))
+}
+
+// printResult writes a command's result to stdout as indented JSON.
+func printResult(res any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
+
+// invalidateServerCaches tells running servers that the catalog changed.
+// Only a shared (redis) cache is reachable from here; in-process caches
+// catch up within cache.ttl. It also runs after a failed apply, which may
+// have written part of the feed.
+func invalidateServerCaches(cfg *config.Config) {
+	rc, err := cache.New(cfg.Cache)
+	if err != nil {
+		slog.Warn("cache not invalidated", "err", err)
+		return
+	}
+	defer rc.Close()
+	if !rc.Shared() {
+		return
+	}
+	if err := rc.Invalidate(context.Background()); err != nil {
+		slog.Warn("cache not invalidated", "err", err)
+	}
+}
+
+func cmdSync(cfg *config.Config, args []string) error {
+	fs := newFlagSet("sync")
+	source := fs.String("source", "", "feed name (feeds/source_NAME.json) or path; defaults to FEED_PATH")
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	path, err := resolveSource(cfg, *source)
+	if err != nil {
+		return err
+	}
+	feed, err := syncer.ReadFeed(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	res, err := syncer.Apply(context.Background(), conn, feed, syncer.Options{DryRun: *dryRun, Deactivate: true})
+	if !*dryRun {
+		invalidateServerCaches(cfg)
+	}
+	if err != nil {
+		return err
+	}
+	return printResult(res)
+}
+
+func cmdImport(cfg *config.Config, args []string) error {
+	fs := newFlagSet("import")
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing")
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return errors.New("usage: comparehub import FILE.csv [--dry-run]")
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	feed, err := syncer.ReadCSV(f, "csv:"+filepath.Base(files[0]))
+	if err != nil {
+		return fmt.Errorf("%s: %w", files[0], err)
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	res, err := syncer.Apply(context.Background(), conn, feed, syncer.Options{DryRun: *dryRun})
+	if !*dryRun {
+		invalidateServerCaches(cfg)
+	}
+	if err != nil {
+		return err
+	}
+	return printResult(res)
+}
+
+func cmdExport(cfg *config.Config, args []string) error {
+	fs := newFlagSet("export")
+	format := fs.String("format", "csv", "csv, or json (the sync feed format)")
+	out := fs.String("out", "", "output file (default stdout)")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q (want csv or json)", *format)
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	feed, err := syncer.Export(context.Background(), conn)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(feed)
+	} else {
+		err = syncer.WriteCSV(w, feed)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("export complete", "products", len(feed.Products))
+	return nil
+}
+
+func cmdCreateAdmin(cfg *config.Config, args []string) error {
+	fs := newFlagSet("create-admin")
+	email := fs.String("email", "", "admin email (required)")
+	password := fs.String("password", "", "password; read from stdin when omitted")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*email) == "" {
+		return errors.New("--email is required")
+	}
+
+	pw := *password
+	if pw == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		pw = strings.TrimRight(line, "\r\n")
+	}
+	hash, err := handlers.HashAdminPassword(pw)
+	if err != nil {
+		return err
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := postgres.New(conn).UpsertAdmin(context.Background(), *email, hash); err != nil {
+		return err
+	}
+	slog.Info("admin ready", "email", strings.ToLower(strings.TrimSpace(*email)))
+	return nil
+}
+
+// cmdReindexSearch rebuilds the indexes /products searches and filters on
+// and refreshes planner statistics, e.g. after a large import. Indexes are
+// rebuilt CONCURRENTLY so reads and syncs carry on meanwhile; that cannot
+// run inside a transaction, so each statement runs on its own.
+func cmdReindexSearch(conn *sql.DB, _ []string) error {
+	stmts := []string{
+		`REINDEX INDEX CONCURRENTLY idx_products_name`,
+		`REINDEX INDEX CONCURRENTLY idx_products_category`,
+		`REINDEX INDEX CONCURRENTLY ux_products_name_brand`,
+		`REINDEX INDEX CONCURRENTLY idx_offers_product`,
+		`REINDEX INDEX CONCURRENTLY idx_offers_price`,
+		`REINDEX INDEX CONCURRENTLY idx_offers_condition`,
+		`REINDEX INDEX CONCURRENTLY idx_product_specs_gin`,
+		`REINDEX INDEX CONCURRENTLY best_offers_pkey`,
+		`REINDEX INDEX CONCURRENTLY idx_best_offers_price`,
+		`ANALYZE products, offers, stores, product_specs, best_offers`,
+	}
+	for _, q := range stmts {
+		start := time.Now()
+		if _, err := conn.Exec(q); err != nil {
+			return fmt.Errorf("%s: %w", q, err)
+		}
+		slog.Info("reindex", "statement", q, "duration_ms", time.Since(start).Milliseconds())
+	}
+	slog.Info("search indexes rebuilt")
+	return nil
+}
+
+// rollupOptions are the rollup settings of cfg, shared by the server's
+// job and "comparehub rollup".
+func rollupOptions(cfg config.Analytics) rollup.Options {
+	return rollup.Options{Lookback: cfg.RollupLookback.Std(), Retention: cfg.Retention.Std()}
+}
+
+// cmdRollup runs the analytics rollup once. --backfill recomputes every
+// rollup from the oldest raw event, e.g. after restoring events from a
+// backup; the first run after upgrading does that by itself.
+func cmdRollup(cfg *config.Config, args []string) error {
+	fs := newFlagSet("rollup")
+	backfill := fs.Bool("backfill", false, "recompute from the oldest raw event")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	opts := rollupOptions(cfg.Analytics)
+	opts.Backfill = *backfill
+	res, err := rollup.RunOnce(context.Background(), conn, opts)
+	if err != nil {
+		return err
+	}
+	if res.Skipped {
+		return errors.New("another instance is running the rollup; try again later")
+	}
+	return printResult(res)
+}
+
+func cmdConfig(cfg *config.Config, args []string) error {
+	return printConfig(os.Stdout, cfg, args)
+}
+
+// printConfig writes cfg as YAML, with secrets masked unless --show-secrets
+// is given. --redacted asks for the default explicitly, so scripts can
+// spell it out.
+func printConfig(w io.Writer, cfg *config.Config, args []string) error {
+	fs := newFlagSet("config")
+	showSecrets := fs.Bool("show-secrets", false, "print secrets (JWT_SECRET, passwords, DATABASE_URL) instead of masking them")
+	redacted := fs.Bool("redacted", false, "mask secrets (the default)")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 || rest[0] != "print" {
+		return errors.New("usage: comparehub config print [--redacted | --show-secrets]")
+	}
+	if *redacted && *showSecrets {
+		return errors.New("config print: --redacted and --show-secrets are mutually exclusive")
+	}
+
+	if !*showSecrets {
+		cfg = cfg.Redacted()
+	}
+	b, err := cfg.YAML()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
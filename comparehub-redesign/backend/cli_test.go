@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go-ecommerce-backend/config"
+)
+
+func TestConfigPrint(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "super-secret-super-secret-super-secret"
+
+	printed := func(args ...string) (string, error) {
+		var buf bytes.Buffer
+		err := printConfig(&buf, cfg, args)
+		return buf.String(), err
+	}
+	for _, args := range [][]string{{"print"}, {"print", "--redacted"}, {"--redacted", "print"}} {
+		out, err := printed(args...)
+		if err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		if strings.Contains(out, cfg.Auth.JWTSecret) {
+			t.Errorf("%v: secret leaked:\n%s", args, out)
+		}
+	}
+	out, err := printed("print", "--show-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, cfg.Auth.JWTSecret) {
+		t.Errorf("--show-secrets: secret missing:\n%s", out)
+	}
+
+	if _, err := printed("print", "--redacted", "--show-secrets"); err == nil {
+		t.Error("--redacted with --show-secrets: want an error")
+	}
+	if _, err := printed("show"); err == nil {
+		t.Error("config show: want a usage error")
+	}
+}
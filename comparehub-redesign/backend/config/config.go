@@ -0,0 +1,673 @@
+// Package config loads the backend configuration from defaults, an optional
+// YAML or TOML file and the environment (in that order of precedence, the
+// environment winning), and validates it once at startup.
+//
+// Every field that can be set from the environment carries an `env` tag with
+// the variable name; fields tagged `secret:"true"` are masked by Redacted.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// MinJWTSecretLen is the shortest JWT_SECRET the server starts with.
+const MinJWTSecretLen = 32
+
+type Config struct {
+	// Env is the deployment profile: development, staging or production.
+	Env         string `yaml:"env" toml:"env" env:"APP_ENV"`
+	Port        string `yaml:"port" toml:"port" env:"PORT"`
+	AutoMigrate bool   `yaml:"autoMigrate" toml:"autoMigrate" env:"AUTO_MIGRATE"`
+
+	Log       Log       `yaml:"log" toml:"log"`
+	Server    Server    `yaml:"server" toml:"server"`
+	Database  Database  `yaml:"database" toml:"database"`
+	Auth      Auth      `yaml:"auth" toml:"auth"`
+	CORS      CORS      `yaml:"cors" toml:"cors"`
+	Sync      Sync      `yaml:"sync" toml:"sync"`
+	Metrics   Metrics   `yaml:"metrics" toml:"metrics"`
+	Tracing   Tracing   `yaml:"tracing" toml:"tracing"`
+	Cache     Cache     `yaml:"cache" toml:"cache"`
+	HTTPCache HTTPCache `yaml:"httpCache" toml:"httpCache"`
+	RateLimit RateLimit `yaml:"rateLimit" toml:"rateLimit"`
+	Analytics Analytics `yaml:"analytics" toml:"analytics"`
+}
+
+// Database is either a URL (DATABASE_URL, preferred on Render) or the
+// individual DB_* settings used in local development.
+type Database struct {
+	URL      string `yaml:"url" toml:"url" env:"DATABASE_URL" secret:"true"`
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST"`
+	Port     string `yaml:"port" toml:"port" env:"DB_PORT"`
+	User     string `yaml:"user" toml:"user" env:"DB_USER"`
+	Password string `yaml:"password" toml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" toml:"name" env:"DB_NAME"`
+	SSLMode  string `yaml:"sslMode" toml:"sslMode" env:"DB_SSLMODE"`
+
+	// Pool settings; keep MaxOpenConns below the server's connection limit
+	// divided by the number of instances.
+	MaxOpenConns    int      `yaml:"maxOpenConns" toml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int      `yaml:"maxIdleConns" toml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime Duration `yaml:"connMaxLifetime" toml:"connMaxLifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime Duration `yaml:"connMaxIdleTime" toml:"connMaxIdleTime" env:"DB_CONN_MAX_IDLE_TIME"`
+}
+
+// Log selects the slog level (debug, info, warn, error) and output format
+// (json, or text for reading in a terminal).
+type Log struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+}
+
+// Server holds HTTP timeouts. QueryTimeout bounds the database work of one
+// request; RouteTimeouts overrides it per route, keyed "GET /products"
+// (the path as registered, without the /v1 prefix); 0 disables the deadline.
+type Server struct {
+	ReadHeaderTimeout Duration            `yaml:"readHeaderTimeout" toml:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       Duration            `yaml:"readTimeout" toml:"readTimeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      Duration            `yaml:"writeTimeout" toml:"writeTimeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       Duration            `yaml:"idleTimeout" toml:"idleTimeout" env:"HTTP_IDLE_TIMEOUT"`
+	ShutdownTimeout   Duration            `yaml:"shutdownTimeout" toml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+	QueryTimeout      Duration            `yaml:"queryTimeout" toml:"queryTimeout" env:"QUERY_TIMEOUT"`
+	HealthTimeout     Duration            `yaml:"healthTimeout" toml:"healthTimeout" env:"HEALTH_TIMEOUT"`
+	RouteTimeouts     map[string]Duration `yaml:"routeTimeouts" toml:"routeTimeouts"`
+	// TrustedProxies are the addresses (IPs or CIDRs) whose
+	// X-Forwarded-For is believed when working out the client IP that rate
+	// limits and logs use. The default trusts private networks, where
+	// platform load balancers (Render, Kubernetes ingress) sit.
+	TrustedProxies []string `yaml:"trustedProxies" toml:"trustedProxies" env:"TRUSTED_PROXIES"`
+}
+
+type Auth struct {
+	JWTSecret string `yaml:"jwtSecret" toml:"jwtSecret" env:"JWT_SECRET" secret:"true"`
+	// AdminEmail / AdminPassword is the bootstrap login; accounts made
+	// with "comparehub create-admin" are checked first.
+	AdminEmail    string   `yaml:"adminEmail" toml:"adminEmail" env:"ADMIN_EMAIL"`
+	AdminPassword string   `yaml:"adminPassword" toml:"adminPassword" env:"ADMIN_PASSWORD" secret:"true"`
+	TokenTTL      Duration `yaml:"tokenTTL" toml:"tokenTTL" env:"TOKEN_TTL"`
+}
+
+// CORS lists the browser origins allowed to call the API. Entries are exact
+// origins or "https://*.example.com" patterns (see middleware.OriginMatcher).
+type CORS struct {
+	// FrontendOrigin is the deployed frontend, e.g. https://comparehub.vercel.app.
+	FrontendOrigin string `yaml:"frontendOrigin" toml:"frontendOrigin" env:"FRONTEND_ORIGIN"`
+	// AllowedOrigins apply in every environment (comma-separated in env).
+	AllowedOrigins []string `yaml:"allowedOrigins" toml:"allowedOrigins" env:"CORS_ALLOWED_ORIGINS"`
+	// Profiles adds origins for one environment only. A profile given in the
+	// config file replaces the built-in one for that environment.
+	Profiles map[string][]string `yaml:"profiles" toml:"profiles"`
+	// AllowCredentials lets browsers send cookies / HTTP auth; it requires
+	// an explicit allowlist (there is no allow-all origin).
+	AllowCredentials bool     `yaml:"allowCredentials" toml:"allowCredentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           Duration `yaml:"maxAge" toml:"maxAge" env:"CORS_MAX_AGE"`
+}
+
+// defaultCORSProfiles are the built-in per-environment origins: the Vite dev
+// server locally, nothing implicit anywhere else.
+var defaultCORSProfiles = map[string][]string{
+	"development": {"http://localhost:5173", "http://127.0.0.1:5173"},
+}
+
+// Origins is the allowlist in effect for env.
+func (c CORS) Origins(env string) []string {
+	profile, ok := c.Profiles[env]
+	if !ok {
+		profile = defaultCORSProfiles[env]
+	}
+	out := append([]string{}, profile...)
+	out = append(out, c.AllowedOrigins...)
+	if c.FrontendOrigin != "" {
+		out = append(out, c.FrontendOrigin)
+	}
+	return out
+}
+
+type Sync struct {
+	Enabled  bool     `yaml:"enabled" toml:"enabled" env:"ENABLE_SYNC"`
+	Interval Duration `yaml:"interval" toml:"interval" env:"SYNC_INTERVAL"`
+	FeedPath string   `yaml:"feedPath" toml:"feedPath" env:"FEED_PATH"`
+	// Timeout bounds one sync run, including one started by /admin/sync-now.
+	Timeout Duration `yaml:"timeout" toml:"timeout" env:"SYNC_TIMEOUT"`
+	// StaleAfter is how old a source's last successful sync may be before
+	// /readyz reports the instance as degraded.
+	StaleAfter Duration `yaml:"staleAfter" toml:"staleAfter" env:"SYNC_STALE_AFTER"`
+}
+
+// Metrics controls the Prometheus endpoint. With Addr set, /metrics is
+// served only on that separate listener (e.g. "127.0.0.1:9100" or an
+// internal-network port) and not on the public one. Otherwise it is
+// mounted on the main port and, outside development, requires Token as a
+// bearer token.
+type Metrics struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled" env:"METRICS_ENABLED"`
+	Addr    string `yaml:"addr" toml:"addr" env:"METRICS_ADDR"`
+	Token   string `yaml:"token" toml:"token" env:"METRICS_TOKEN" secret:"true"`
+}
+
+// Tracing selects where OpenTelemetry spans go: "none" (the default; spans
+// are not recorded), "stdout" or "otlp". The OTLP/HTTP exporter reads the
+// standard OTEL_EXPORTER_OTLP_* variables; Endpoint, when set, overrides
+// the collector URL.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT"`
+	SampleRatio float64 `yaml:"sampleRatio" toml:"sampleRatio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// Cache configures the read cache in front of product listings, compare
+// and top deals. Backend "memory" is a per-process LRU of MaxEntries;
+// "redis" shares entries (and invalidations) between instances through any
+// Redis-compatible server at RedisURL. TTL bounds staleness when a write
+// bypasses invalidation, e.g. a CLI import next to the memory backend.
+// AllowBypass lets clients skip the cache with X-Cache-Bypass; it is off
+// by default because the header is unauthenticated.
+type Cache struct {
+	Enabled     bool     `yaml:"enabled" toml:"enabled" env:"CACHE_ENABLED"`
+	Backend     string   `yaml:"backend" toml:"backend" env:"CACHE_BACKEND"`
+	MaxEntries  int      `yaml:"maxEntries" toml:"maxEntries" env:"CACHE_MAX_ENTRIES"`
+	TTL         Duration `yaml:"ttl" toml:"ttl" env:"CACHE_TTL"`
+	RedisURL    string   `yaml:"redisUrl" toml:"redisUrl" env:"REDIS_URL" secret:"true"`
+	KeyPrefix   string   `yaml:"keyPrefix" toml:"keyPrefix" env:"CACHE_KEY_PREFIX"`
+	AllowBypass bool     `yaml:"allowBypass" toml:"allowBypass" env:"CACHE_ALLOW_BYPASS"`
+}
+
+// HTTPCache sets Cache-Control on the cacheable GET routes (product
+// details, offers, compare): browsers keep a response for MaxAge, shared
+// caches such as a CDN for SharedMaxAge, and either may serve it up to
+// StaleWhileRevalidate longer while refetching it. /products is always
+// revalidated, so every search still reaches the server and its analytics.
+type HTTPCache struct {
+	MaxAge               Duration `yaml:"maxAge" toml:"maxAge" env:"HTTP_CACHE_MAX_AGE"`
+	SharedMaxAge         Duration `yaml:"sharedMaxAge" toml:"sharedMaxAge" env:"HTTP_CACHE_SHARED_MAX_AGE"`
+	StaleWhileRevalidate Duration `yaml:"staleWhileRevalidate" toml:"staleWhileRevalidate" env:"HTTP_CACHE_STALE_WHILE_REVALIDATE"`
+}
+
+// RateLimit throttles each client IP per route with token buckets. Default
+// applies to routes without an entry in Routes (keyed like
+// server.routeTimeouts, "POST /track/click"); an "off" rate lifts the
+// limit. Logins additionally lock an email out, for the failing client
+// IP only, for LoginLockout after LoginMaxFailures failures within
+// LoginLockout. Backend "redis" shares
+// buckets and lockouts between instances through cache.redisUrl
+// (REDIS_URL).
+type RateLimit struct {
+	Enabled          bool            `yaml:"enabled" toml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	Backend          string          `yaml:"backend" toml:"backend" env:"RATE_LIMIT_BACKEND"`
+	KeyPrefix        string          `yaml:"keyPrefix" toml:"keyPrefix" env:"RATE_LIMIT_KEY_PREFIX"`
+	Default          Rate            `yaml:"default" toml:"default" env:"RATE_LIMIT_DEFAULT"`
+	Routes           map[string]Rate `yaml:"routes" toml:"routes"`
+	LoginMaxFailures int             `yaml:"loginMaxFailures" toml:"loginMaxFailures" env:"LOGIN_MAX_FAILURES"`
+	LoginLockout     Duration        `yaml:"loginLockout" toml:"loginLockout" env:"LOGIN_LOCKOUT"`
+}
+
+// Analytics controls how tracked events are recorded. Session ids and IPs
+// are stored only as HMACs under HashKey (JWT_SECRET when empty). The
+// hashes are stable, so raw events holding them are always purged after
+// Retention. A click that repeats one the same visitor made on the same
+// offer within DedupeWindow is kept but not counted, and so is a product
+// view repeating one of the same product; 0 counts every click and view.
+//
+// Reports read hourly and daily rollups, which the server refreshes every
+// RollupInterval (0 leaves it to "comparehub rollup"), recomputing the
+// last RollupLookback so late clicks still reach their search. Raw events
+// and hourly rollups older than Retention are then deleted; daily rollups
+// are kept.
+//
+// Searches and views are recorded by Workers goroutines from a queue of
+// QueueSize events; events arriving while it is full are dropped (and
+// counted in the metrics).
+type Analytics struct {
+	HashKey        string   `yaml:"hashKey" toml:"hashKey" env:"ANALYTICS_HASH_KEY" secret:"true"`
+	DedupeWindow   Duration `yaml:"dedupeWindow" toml:"dedupeWindow" env:"CLICK_DEDUPE_WINDOW"`
+	RollupInterval Duration `yaml:"rollupInterval" toml:"rollupInterval" env:"ANALYTICS_ROLLUP_INTERVAL"`
+	RollupLookback Duration `yaml:"rollupLookback" toml:"rollupLookback" env:"ANALYTICS_ROLLUP_LOOKBACK"`
+	Retention      Duration `yaml:"retention" toml:"retention" env:"ANALYTICS_RETENTION"`
+	QueueSize      int      `yaml:"queueSize" toml:"queueSize" env:"ANALYTICS_QUEUE_SIZE"`
+	Workers        int      `yaml:"workers" toml:"workers" env:"ANALYTICS_WORKERS"`
+}
+
+// Rate is a request budget written "30/m": Requests per Per, in bursts of
+// up to Requests. Per is s, m, h or any duration ("5/10s"). "off" (the
+// zero Rate) means unlimited.
+type Rate struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Off reports whether r imposes no limit.
+func (r Rate) Off() bool { return r.Requests == 0 }
+
+func (r Rate) MarshalText() ([]byte, error) {
+	if r.Off() {
+		return []byte("off"), nil
+	}
+	per := r.Per.String()
+	switch r.Per {
+	case time.Second:
+		per = "s"
+	case time.Minute:
+		per = "m"
+	case time.Hour:
+		per = "h"
+	}
+	return []byte(strconv.Itoa(r.Requests) + "/" + per), nil
+}
+
+func (r *Rate) UnmarshalText(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	if s == "off" || s == "0" {
+		*r = Rate{}
+		return nil
+	}
+	n, per, ok := strings.Cut(s, "/")
+	requests, err := strconv.Atoi(strings.TrimSpace(n))
+	if !ok || err != nil || requests < 1 {
+		return fmt.Errorf("rate %q: want N/s, N/m, N/h, N/<duration> or off", s)
+	}
+	var d time.Duration
+	switch per = strings.TrimSpace(per); per {
+	case "s":
+		d = time.Second
+	case "m":
+		d = time.Minute
+	case "h":
+		d = time.Hour
+	default:
+		if d, err = time.ParseDuration(per); err != nil || d <= 0 {
+			return fmt.Errorf("rate %q: want N/s, N/m, N/h, N/<duration> or off", s)
+		}
+	}
+	*r = Rate{Requests: requests, Per: d}
+	return nil
+}
+
+// Duration is a time.Duration written as "90s" / "2m" in files and env.
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration { return time.Duration(d) }
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(strings.TrimSpace(string(b)))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Default is the configuration before any file or environment is applied.
+func Default() *Config {
+	return &Config{
+		Env:  "development",
+		Port: "8080",
+		Log:  Log{Level: "info", Format: "json"},
+		Server: Server{
+			ReadHeaderTimeout: Duration(10 * time.Second),
+			ReadTimeout:       Duration(30 * time.Second),
+			WriteTimeout:      Duration(60 * time.Second),
+			IdleTimeout:       Duration(2 * time.Minute),
+			ShutdownTimeout:   Duration(25 * time.Second),
+			QueryTimeout:      Duration(5 * time.Second),
+			HealthTimeout:     Duration(2 * time.Second),
+			TrustedProxies: []string{
+				"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7",
+			},
+		},
+		Database: Database{
+			SSLMode:         "disable",
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: Duration(30 * time.Minute),
+			ConnMaxIdleTime: Duration(5 * time.Minute),
+		},
+		CORS: CORS{MaxAge: Duration(12 * time.Hour)},
+		Auth: Auth{TokenTTL: Duration(24 * time.Hour)},
+		Sync: Sync{
+			Interval:   Duration(2 * time.Minute),
+			FeedPath:   defaultFeedPath(),
+			Timeout:    Duration(10 * time.Minute),
+			StaleAfter: Duration(time.Hour),
+		},
+		Metrics: Metrics{Enabled: true},
+		Tracing: Tracing{Exporter: "none", SampleRatio: 1},
+		Cache: Cache{
+			Enabled:    true,
+			Backend:    "memory",
+			MaxEntries: 10000,
+			TTL:        Duration(5 * time.Minute),
+			KeyPrefix:  "comparehub:cache:",
+		},
+		HTTPCache: HTTPCache{
+			MaxAge:               Duration(time.Minute),
+			SharedMaxAge:         Duration(5 * time.Minute),
+			StaleWhileRevalidate: Duration(time.Minute),
+		},
+		RateLimit: RateLimit{
+			Enabled:          true,
+			Backend:          "memory",
+			KeyPrefix:        "comparehub:ratelimit:",
+			Default:          Rate{Requests: 300, Per: time.Minute},
+			LoginMaxFailures: 5,
+			LoginLockout:     Duration(15 * time.Minute),
+		},
+		Analytics: Analytics{
+			DedupeWindow:   Duration(30 * time.Minute),
+			RollupInterval: Duration(5 * time.Minute),
+			RollupLookback: Duration(48 * time.Hour),
+			Retention:      Duration(90 * 24 * time.Hour),
+			QueueSize:      1000,
+			Workers:        4,
+		},
+	}
+}
+
+// Load builds the configuration. path names a .yaml/.yml/.toml file; when
+// empty, CONFIG_FILE is used and, failing that, no file is read.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalWithOptions(b, c, yaml.Strict())
+	case ".toml":
+		d := toml.NewDecoder(strings.NewReader(string(b)))
+		d.DisallowUnknownFields()
+		err = d.Decode(c)
+	default:
+		return fmt.Errorf("config: %s: unsupported extension (want .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides fields from their `env` variables. Unset and empty
+// variables leave the field alone.
+func applyEnv(v reflect.Value, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(Rate{}) {
+			if err := applyEnv(fv, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		name := f.Tag.Get("env")
+		raw, ok := lookup(name)
+		if name == "" || !ok || strings.TrimSpace(raw) == "" {
+			continue
+		}
+		raw = strings.TrimSpace(raw)
+
+		switch p := fv.Addr().Interface().(type) {
+		case *string:
+			*p = raw
+		case *[]string:
+			*p = nil
+			for _, part := range strings.Split(raw, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					*p = append(*p, part)
+				}
+			}
+		case *int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("config: %s=%q is not an integer", name, raw)
+			}
+			*p = n
+		case *float64:
+			n, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return fmt.Errorf("config: %s=%q is not a number", name, raw)
+			}
+			*p = n
+		case *bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("config: %s=%q is not a boolean", name, raw)
+			}
+			*p = b
+		case *Duration:
+			if err := p.UnmarshalText([]byte(raw)); err != nil {
+				return fmt.Errorf("config: %s=%q is not a duration (e.g. 90s, 2m)", name, raw)
+			}
+		case *Rate:
+			if err := p.UnmarshalText([]byte(raw)); err != nil {
+				return fmt.Errorf("config: %s=%q is not a rate (e.g. 30/m, 5/s, off)", name, raw)
+			}
+		default:
+			return fmt.Errorf("config: unsupported field type %s for %s", f.Type, name)
+		}
+	}
+	return nil
+}
+
+// Validate checks the settings every command needs (database and general).
+func (c *Config) Validate() error {
+	var errs []error
+	switch c.Env {
+	case "development", "staging", "production":
+	default:
+		errs = append(errs, fmt.Errorf("env (APP_ENV) must be development, staging or production, got %q", c.Env))
+	}
+	if c.Database.URL == "" && (c.Database.Host == "" || c.Database.Name == "") {
+		errs = append(errs, errors.New("database: set DATABASE_URL or at least DB_HOST and DB_NAME"))
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level (LOG_LEVEL) must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	if f := strings.ToLower(c.Log.Format); f != "json" && f != "text" {
+		errs = append(errs, fmt.Errorf("log.format (LOG_FORMAT) must be json or text, got %q", c.Log.Format))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter (TRACING_EXPORTER) must be none, stdout or otlp, got %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sampleRatio (TRACING_SAMPLE_RATIO) must be between 0 and 1"))
+	}
+	if c.Cache.Enabled {
+		switch {
+		case c.Cache.Backend != "memory" && c.Cache.Backend != "redis":
+			errs = append(errs, fmt.Errorf("cache.backend (CACHE_BACKEND) must be memory or redis, got %q", c.Cache.Backend))
+		case c.Cache.Backend == "redis" && c.Cache.RedisURL == "":
+			errs = append(errs, errors.New("cache: the redis backend needs REDIS_URL"))
+		}
+		if c.Cache.MaxEntries < 1 || c.Cache.TTL <= 0 {
+			errs = append(errs, errors.New("cache: maxEntries (CACHE_MAX_ENTRIES) and ttl (CACHE_TTL) must be positive"))
+		}
+	}
+	if c.HTTPCache.MaxAge < 0 || c.HTTPCache.SharedMaxAge < 0 || c.HTTPCache.StaleWhileRevalidate < 0 {
+		errs = append(errs, errors.New("httpCache: maxAge, sharedMaxAge and staleWhileRevalidate must not be negative"))
+	}
+	if c.Database.MaxOpenConns < 1 {
+		errs = append(errs, errors.New("database.maxOpenConns (DB_MAX_OPEN_CONNS) must be at least 1"))
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, errors.New("database.maxIdleConns (DB_MAX_IDLE_CONNS) must be between 0 and maxOpenConns"))
+	}
+	return joinErrors(errs)
+}
+
+// ValidateServer additionally checks what serving HTTP needs.
+func (c *Config) ValidateServer() error {
+	errs := []error{c.Validate()}
+	if n, err := strconv.Atoi(c.Port); err != nil || n < 1 || n > 65535 {
+		errs = append(errs, fmt.Errorf("port (PORT) must be 1-65535, got %q", c.Port))
+	}
+	switch {
+	case c.Auth.JWTSecret == "":
+		errs = append(errs, errors.New("auth.jwtSecret (JWT_SECRET) is required"))
+	case len(c.Auth.JWTSecret) < MinJWTSecretLen:
+		errs = append(errs, fmt.Errorf("auth.jwtSecret (JWT_SECRET) must be at least %d characters", MinJWTSecretLen))
+	}
+	if c.Server.QueryTimeout <= 0 || c.Server.ShutdownTimeout <= 0 || c.Server.HealthTimeout <= 0 {
+		errs = append(errs, errors.New("server: queryTimeout (QUERY_TIMEOUT), shutdownTimeout (SHUTDOWN_TIMEOUT) and healthTimeout (HEALTH_TIMEOUT) must be positive"))
+	}
+	for route, d := range c.Server.RouteTimeouts {
+		method, path, ok := strings.Cut(route, " ")
+		if !ok || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/") || d < 0 {
+			errs = append(errs, fmt.Errorf("server.routeTimeouts: %q must look like \"GET /products\" with a duration >= 0", route))
+		}
+	}
+	for route := range c.RateLimit.Routes {
+		method, path, ok := strings.Cut(route, " ")
+		if !ok || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/") {
+			errs = append(errs, fmt.Errorf("rateLimit.routes: %q must look like \"POST /track/click\"", route))
+		}
+	}
+	if c.RateLimit.Enabled {
+		switch {
+		case c.RateLimit.Backend != "memory" && c.RateLimit.Backend != "redis":
+			errs = append(errs, fmt.Errorf("rateLimit.backend (RATE_LIMIT_BACKEND) must be memory or redis, got %q", c.RateLimit.Backend))
+		case c.RateLimit.Backend == "redis" && c.Cache.RedisURL == "":
+			errs = append(errs, errors.New("rateLimit: the redis backend needs REDIS_URL"))
+		}
+		if c.RateLimit.LoginMaxFailures < 1 || c.RateLimit.LoginLockout <= 0 {
+			errs = append(errs, errors.New("rateLimit: loginMaxFailures (LOGIN_MAX_FAILURES) and loginLockout (LOGIN_LOCKOUT) must be positive"))
+		}
+	}
+	if c.Analytics.DedupeWindow < 0 {
+		errs = append(errs, errors.New("analytics.dedupeWindow (CLICK_DEDUPE_WINDOW) must not be negative"))
+	}
+	if c.Analytics.RollupInterval < 0 {
+		errs = append(errs, errors.New("analytics.rollupInterval (ANALYTICS_ROLLUP_INTERVAL) must not be negative"))
+	}
+	if c.Analytics.RollupLookback < Duration(time.Hour) {
+		errs = append(errs, errors.New("analytics.rollupLookback (ANALYTICS_ROLLUP_LOOKBACK) must be at least 1h"))
+	}
+	// Rollups are recomputed from raw events, and the click and view
+	// deduplication reads them, so raw events must outlive both. They hold
+	// stable visitor hashes, so they cannot be kept forever either.
+	if r := c.Analytics.Retention; r < Duration(7*24*time.Hour) || r <= c.Analytics.RollupLookback {
+		errs = append(errs, errors.New("analytics.retention (ANALYTICS_RETENTION) must be at least 168h and longer than rollupLookback"))
+	}
+	if c.Analytics.QueueSize < 1 || c.Analytics.Workers < 1 {
+		errs = append(errs, errors.New("analytics.queueSize (ANALYTICS_QUEUE_SIZE) and analytics.workers (ANALYTICS_WORKERS) must be positive"))
+	}
+	if c.Auth.TokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.tokenTTL (TOKEN_TTL) must be positive"))
+	}
+	if (c.Auth.AdminEmail == "") != (c.Auth.AdminPassword == "") {
+		errs = append(errs, errors.New("auth: ADMIN_EMAIL and ADMIN_PASSWORD must be set together"))
+	}
+	if c.CORS.AllowCredentials && len(c.CORS.Origins(c.Env)) == 0 {
+		errs = append(errs, errors.New("cors: CORS_ALLOW_CREDENTIALS needs at least one allowed origin"))
+	}
+	if c.Metrics.Enabled && c.Metrics.Addr == "" && c.Metrics.Token == "" && c.Env != "development" {
+		errs = append(errs, errors.New("metrics: set METRICS_TOKEN or METRICS_ADDR (an internal port) so /metrics is not public"))
+	}
+	if c.Sync.Timeout <= 0 || c.Sync.StaleAfter <= 0 {
+		errs = append(errs, errors.New("sync.timeout (SYNC_TIMEOUT) and sync.staleAfter (SYNC_STALE_AFTER) must be positive"))
+	}
+	if c.Sync.Enabled && c.Sync.Interval.Std() < 10*time.Second {
+		errs = append(errs, errors.New("sync.interval (SYNC_INTERVAL) must be at least 10s"))
+	}
+	return joinErrors(errs)
+}
+
+func joinErrors(errs []error) error {
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+// DSN is the lib/pq connection string.
+func (d Database) DSN() string {
+	if d.URL != "" {
+		return d.URL
+	}
+	return "host=" + d.Host +
+		" port=" + d.Port +
+		" user=" + d.User +
+		" password=" + d.Password +
+		" dbname=" + d.Name +
+		" sslmode=" + d.SSLMode
+}
+
+// Redacted returns a copy with every non-empty secret replaced.
+func (c *Config) Redacted() *Config {
+	cp := *c
+	redact(reflect.ValueOf(&cp).Elem())
+	return &cp
+}
+
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			redact(fv)
+			continue
+		}
+		if t.Field(i).Tag.Get("secret") == "true" && fv.Kind() == reflect.String && fv.String() != "" {
+			fv.SetString("[redacted]")
+		}
+	}
+}
+
+// YAML renders the configuration in the config file format.
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func defaultFeedPath() string {
+	candidates := []string{
+		"feeds/source_demo.json",                              // when running from backend/
+		filepath.Join("backend", "feeds", "source_demo.json"), // when running from repo root
+	}
+
+	// Also try relative to the executable (useful for built binaries)
+	if exe, err := os.Executable(); err == nil {
+		base := filepath.Dir(exe)
+		candidates = append(candidates, filepath.Join(base, "feeds", "source_demo.json"))
+	}
+
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c
+		}
+	}
+
+	// Fall back to the most common
+	return "feeds/source_demo.json"
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadFileThenEnv(t *testing.T) {
+	files := map[string]string{
+		"app.yaml": `
+port: "9000"
+database:
+  host: db.internal
+  name: comparehub
+auth:
+  jwtSecret: from-file
+  tokenTTL: 2h
+sync:
+  interval: 5m
+server:
+  routeTimeouts:
+    GET /products: 3s
+rateLimit:
+  routes:
+    POST /track/click: 10/m
+`,
+		"app.toml": `
+port = "9000"
+[database]
+host = "db.internal"
+name = "comparehub"
+[auth]
+jwtSecret = "from-file"
+tokenTTL = "2h"
+[sync]
+interval = "5m"
+[server.routeTimeouts]
+"GET /products" = "3s"
+[rateLimit.routes]
+"POST /track/click" = "10/m"
+`,
+	}
+	for name, body := range files {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", "from-env")
+			t.Setenv("ENABLE_SYNC", "true")
+			t.Setenv("PORT", "") // empty means unset
+			t.Setenv("DB_MAX_OPEN_CONNS", "7")
+			t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://*.b.example.com,")
+			t.Setenv("RATE_LIMIT_DEFAULT", "5/10s")
+
+			cfg, err := Load(writeFile(t, name, body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Port != "9000" || cfg.Database.Host != "db.internal" {
+				t.Errorf("file values not applied: %+v", cfg)
+			}
+			if cfg.Auth.JWTSecret != "from-env" || !cfg.Sync.Enabled {
+				t.Errorf("env did not override: %+v", cfg)
+			}
+			if cfg.Auth.TokenTTL.Std() != 2*time.Hour || cfg.Sync.Interval.Std() != 5*time.Minute {
+				t.Errorf("durations: ttl=%v interval=%v", cfg.Auth.TokenTTL.Std(), cfg.Sync.Interval.Std())
+			}
+			if cfg.Server.RouteTimeouts["GET /products"].Std() != 3*time.Second || cfg.Database.MaxOpenConns != 7 {
+				t.Errorf("server/pool: routes=%v maxOpen=%d", cfg.Server.RouteTimeouts, cfg.Database.MaxOpenConns)
+			}
+			if got, want := cfg.RateLimit.Routes["POST /track/click"], (Rate{10, time.Minute}); got != want {
+				t.Errorf("rate limit route = %+v, want %+v", got, want)
+			}
+			if got, want := cfg.RateLimit.Default, (Rate{5, 10 * time.Second}); got != want {
+				t.Errorf("RATE_LIMIT_DEFAULT = %+v, want %+v", got, want)
+			}
+			if got := cfg.CORS.Origins("production"); len(got) != 2 || got[1] != "https://*.b.example.com" {
+				t.Errorf("CORS_ALLOWED_ORIGINS parsed as %q", got)
+			}
+			if cfg.Database.SSLMode != "disable" || cfg.AutoMigrate {
+				t.Errorf("defaults lost: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsBadInput(t *testing.T) {
+	if _, err := Load(writeFile(t, "app.yaml", "prot: 80\n")); err == nil {
+		t.Error("unknown yaml key accepted")
+	}
+	if _, err := Load(writeFile(t, "app.json", "{}")); err == nil {
+		t.Error("unsupported extension accepted")
+	}
+	t.Setenv("SYNC_INTERVAL", "soon")
+	if _, err := Load(""); err == nil {
+		t.Error("bad duration accepted")
+	}
+	t.Setenv("SYNC_INTERVAL", "")
+	for _, bad := range []string{"30", "30/fortnight", "-1/m", "x/s"} {
+		t.Setenv("RATE_LIMIT_DEFAULT", bad)
+		if _, err := Load(""); err == nil {
+			t.Errorf("bad rate %q accepted", bad)
+		}
+	}
+}
+
+func TestValidateServer(t *testing.T) {
+	valid := func() *Config {
+		c := Default()
+		c.Database.URL = "postgres://localhost/comparehub"
+		c.Auth.JWTSecret = strings.Repeat("s", MinJWTSecretLen)
+		return c
+	}
+	if err := valid().ValidateServer(); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+
+	cases := map[string]func(c *Config){
+		"missing secret":      func(c *Config) { c.Auth.JWTSecret = "" },
+		"short secret":        func(c *Config) { c.Auth.JWTSecret = "changeme" },
+		"no database":         func(c *Config) { c.Database.URL = "" },
+		"bad port":            func(c *Config) { c.Port = "http" },
+		"unknown env":         func(c *Config) { c.Env = "prod" },
+		"half admin login":    func(c *Config) { c.Auth.AdminEmail = "a@example.com" },
+		"too many idle conns": func(c *Config) { c.Database.MaxIdleConns = c.Database.MaxOpenConns + 1 },
+		"no query timeout":    func(c *Config) { c.Server.QueryTimeout = 0 },
+		"bad log level":       func(c *Config) { c.Log.Level = "verbose" },
+		"redis without url":   func(c *Config) { c.Cache.Backend = "redis" },
+		"negative max-age":    func(c *Config) { c.HTTPCache.MaxAge = -1 },
+		"no login lockout":    func(c *Config) { c.RateLimit.LoginLockout = 0 },
+		"bad rate limit route": func(c *Config) {
+			c.RateLimit.Routes = map[string]Rate{"/track/click": {Requests: 1, Per: time.Second}}
+		},
+		"bad route timeout": func(c *Config) {
+			c.Server.RouteTimeouts = map[string]Duration{"/products": Duration(time.Second)}
+		},
+		"credentials without origins": func(c *Config) {
+			c.Env = "production"
+			c.Metrics.Token = "metrics-token"
+			c.CORS.AllowCredentials = true
+		},
+		"public metrics in production": func(c *Config) { c.Env = "production" },
+	}
+	for name, mutate := range cases {
+		c := valid()
+		mutate(c)
+		if err := c.ValidateServer(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// Commands that do not serve HTTP only need the database.
+	c := valid()
+	c.Auth.JWTSecret = ""
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate should not check auth: %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.Database.URL = "postgres://user:pw@host/db"
+	c.Auth.JWTSecret = "super-secret"
+	c.Auth.AdminEmail = "ops@example.com"
+
+	out, err := c.Redacted().YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	if strings.Contains(s, "super-secret") || strings.Contains(s, "pw@host") {
+		t.Errorf("secret leaked:\n%s", s)
+	}
+	if !strings.Contains(s, "ops@example.com") || !strings.Contains(s, "tokenTTL: 24h0m0s") {
+		t.Errorf("non-secret values missing:\n%s", s)
+	}
+	if c.Auth.JWTSecret != "super-secret" {
+		t.Error("Redacted modified the original")
+	}
+}
@@ -1,49 +1,41 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"log"
-	"os"
+	"fmt"
+	"log/slog"
+	"time"
 
 	_ "github.com/lib/pq"
+
+	"go-ecommerce-backend/config"
 )
 
-func Open() *sql.DB {
-	// ✅ Prefer DATABASE_URL (Render)
-	databaseURL := os.Getenv("DATABASE_URL")
-
-	var conn *sql.DB
-	var err error
-
-	if databaseURL != "" {
-		// Render / production
-		conn, err = sql.Open("postgres", databaseURL)
-	} else {
-		// Local development fallback
-		host := os.Getenv("DB_HOST")
-		port := os.Getenv("DB_PORT")
-		user := os.Getenv("DB_USER")
-		pass := os.Getenv("DB_PASSWORD")
-		name := os.Getenv("DB_NAME")
-
-		dsn := "host=" + host +
-			" port=" + port +
-			" user=" + user +
-			" password=" + pass +
-			" dbname=" + name +
-			" sslmode=disable"
-
-		conn, err = sql.Open("postgres", dsn)
-	}
+// pingTimeout bounds the startup connectivity check so a black-holed
+// database fails the boot instead of hanging it.
+const pingTimeout = 10 * time.Second
 
+// Open connects with cfg's pool settings and checks the connection.
+func Open(cfg config.Database) (*sql.DB, error) {
+	// DATABASE_URL (Render) wins over the DB_* settings; see config.Database.
+	conn, err := sql.Open("postgres", cfg.DSN())
 	if err != nil {
-		log.Fatal("sql.Open failed:", err)
+		return nil, fmt.Errorf("sql.Open: %w", err)
 	}
 
-	if err := conn.Ping(); err != nil {
-		log.Fatal("db ping failed:", err)
+	conn.SetMaxOpenConns(cfg.MaxOpenConns)
+	conn.SetMaxIdleConns(cfg.MaxIdleConns)
+	conn.SetConnMaxLifetime(cfg.ConnMaxLifetime.Std())
+	conn.SetConnMaxIdleTime(cfg.ConnMaxIdleTime.Std())
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("db ping: %w", err)
 	}
 
-	log.Println("✅ Database connected")
-	return conn
+	slog.Info("database connected", "max_open_conns", cfg.MaxOpenConns, "max_idle_conns", cfg.MaxIdleConns)
+	return conn, nil
 }
@@ -1,10 +1,10 @@
 package handlers
 
 import (
-	"database/sql"
-	"encoding/json"
-
 	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/store"
 )
 
 type CreateProductReq struct {
@@ -28,89 +28,64 @@ type UpsertSpecsReq struct {
 	Specs     map[string]any `json:"specs"`
 }
 
-func AdminCreateProduct(conn *sql.DB) gin.HandlerFunc {
+func AdminCreateProduct(products store.ProductStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var body CreateProductReq
-		if err := c.BindJSON(&body); err != nil || body.Name == "" {
-			c.JSON(400, gin.H{"error": "invalid body"})
+		if err := c.ShouldBindJSON(&body); err != nil || body.Name == "" {
+			api.Fail(c, 400, api.CodeInvalidArgument, "invalid body", gin.H{"required": []string{"name"}})
 			return
 		}
 
-		var id int
-		err := conn.QueryRow(`
-			INSERT INTO products (name, brand, category, description, image_url)
-			VALUES ($1,$2,$3,$4,$5)
-			RETURNING id;
-		`, body.Name, body.Brand, body.Category, body.Description, body.ImageURL).Scan(&id)
+		id, err := products.CreateProduct(c.Request.Context(), store.Product{
+			Name: body.Name, Brand: body.Brand, Category: body.Category,
+			Description: body.Description, ImageURL: body.ImageURL,
+		})
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+			api.Abort(c, err)
 			return
 		}
 
-		c.JSON(200, gin.H{"id": id})
+		api.OK(c, 200, gin.H{"id": id}, nil, gin.H{"id": id})
 	}
 }
 
-func AdminCreateOffer(conn *sql.DB) gin.HandlerFunc {
+func AdminCreateOffer(offers store.OfferStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var body CreateOfferReq
-		if err := c.BindJSON(&body); err != nil || body.ProductID == 0 || body.StoreName == "" || body.Price <= 0 || body.URL == "" {
-			c.JSON(400, gin.H{"error": "invalid body"})
-			return
-		}
-
-		// Upsert store
-		var storeID int
-		err := conn.QueryRow(`
-			INSERT INTO stores (name) VALUES ($1)
-			ON CONFLICT (name) DO UPDATE SET name=EXCLUDED.name
-			RETURNING id;
-		`, body.StoreName).Scan(&storeID)
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+		if err := c.ShouldBindJSON(&body); err != nil || body.ProductID == 0 || body.StoreName == "" || body.Price <= 0 || body.URL == "" {
+			api.Fail(c, 400, api.CodeInvalidArgument, "invalid body", gin.H{"required": []string{"productId", "storeName", "price", "url"}})
 			return
 		}
 
-		_, err = conn.Exec(`
-			INSERT INTO offers (product_id, store_id, price, rating, url, active, last_seen_at)
-			VALUES ($1,$2,$3,$4,$5,true,NOW());
-		`, body.ProductID, storeID, body.Price, body.Rating, body.URL)
+		// The store is created on first use; an unknown productId is a 422.
+		err := offers.CreateOffer(c.Request.Context(), store.NewOffer{
+			ProductID: body.ProductID, StoreName: body.StoreName,
+			Price: body.Price, Rating: body.Rating, URL: body.URL,
+		})
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+			api.Abort(c, err)
 			return
 		}
 
-		c.JSON(200, gin.H{"ok": true})
+		api.OK(c, 200, gin.H{"ok": true}, nil, gin.H{"ok": true})
 	}
 }
 
 // POST /admin/specs
 // Body: { productId: 1, specs: { ... } }
-func AdminUpsertSpecs(conn *sql.DB) gin.HandlerFunc {
+func AdminUpsertSpecs(specs store.SpecStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var body UpsertSpecsReq
-		if err := c.BindJSON(&body); err != nil || body.ProductID == 0 {
-			c.JSON(400, gin.H{"error": "invalid body"})
+		if err := c.ShouldBindJSON(&body); err != nil || body.ProductID == 0 {
+			api.Fail(c, 400, api.CodeInvalidArgument, "invalid body", gin.H{"required": []string{"productId"}})
 			return
 		}
 
-		b, err := json.Marshal(body.Specs)
-		if err != nil {
-			c.JSON(400, gin.H{"error": "specs must be valid JSON"})
-			return
-		}
-
-		_, err = conn.Exec(`
-			INSERT INTO product_specs (product_id, specs_json, last_updated)
-			VALUES ($1, $2::jsonb, NOW())
-			ON CONFLICT (product_id)
-			DO UPDATE SET specs_json = EXCLUDED.specs_json, last_updated = NOW();
-		`, body.ProductID, string(b))
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+		if err := specs.UpsertSpecs(c.Request.Context(), body.ProductID, body.Specs); err != nil {
+			api.Abort(c, err)
 			return
 		}
 
-		c.JSON(200, gin.H{"ok": true})
+		api.OK(c, 200, gin.H{"ok": true}, nil, gin.H{"ok": true})
 	}
 }
@@ -1,152 +1,248 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/config"
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/metrics"
+	"go-ecommerce-backend/rollup"
+	"go-ecommerce-backend/store"
 )
 
-type TrendingProduct struct {
-	ID     int64  `json:"id"`
-	Name   string `json:"name"`
-	Image  string `json:"imageUrl"`
-	Clicks int64  `json:"clicks"`
-}
+// GET /admin/analytics/summary
+// meta.asOf is how far the counts reach (see asOf).
+func AnalyticsSummary(analytics store.AnalyticsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Trending products, store click breakdown, trending searches and
+		// most viewed products over the 7 UTC days before today and today.
+		sum, err := analytics.Summary(c.Request.Context(), 7)
+		if err != nil {
+			api.Abort(c, err)
+			return
+		}
 
-type StoreClicks struct {
-	Store  string `json:"store"`
-	Clicks int64  `json:"clicks"`
+		summary := gin.H{
+			"trendingProducts": sum.TrendingProducts,
+			"storeClicks":      sum.StoreClicks,
+			"topSearches":      sum.TopSearches,
+			"clickCounts":      sum.Clicks,
+			"mostViewed":       sum.MostViewed,
+			"viewCounts":       sum.Views,
+		}
+		api.OK(c, http.StatusOK, summary, gin.H{"windowDays": 7, "asOf": asOf(sum.AsOf)}, summary)
+	}
 }
 
-type TopSearch struct {
-	Query    string `json:"query"`
-	Searches int64  `json:"searches"`
+type TrackClickReq struct {
+	ProductID int64  `json:"productId"`
+	StoreName string `json:"storeName"`
+	URL       string `json:"url"`
+	SearchID  string `json:"searchId"`
+	SessionID string `json:"sessionId"`
 }
 
-// GET /analytics/summary
-func AnalyticsSummary(conn *sql.DB) gin.HandlerFunc {
+// POST /track/click
+// Body: { productId, storeName, url, searchId?, sessionId? }
+// Kept for clients that open store URLs directly; GET /go/:offerId records
+// clicks server-side. We resolve store_id and offer_id internally (best
+// effort). Clicks from bots and repeats within analytics.dedupeWindow are
+// stored but reported as counted: false and left out of analytics.
+func TrackClick(analytics store.AnalyticsStore, cfg config.Analytics) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Trending products (last 7 days)
-		trending := []TrendingProduct{}
-		rows, err := conn.Query(`
-			SELECT p.id, p.name, COALESCE(p.image_url, ''), COUNT(*) AS clicks
-			FROM click_events ce
-			JOIN products p ON p.id = ce.product_id
-			WHERE ce.created_at >= now() - interval '7 days'
-			GROUP BY p.id, p.name, p.image_url
-			ORDER BY clicks DESC
-			LIMIT 6
-		`)
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var t TrendingProduct
-				_ = rows.Scan(&t.ID, &t.Name, &t.Image, &t.Clicks)
-				trending = append(trending, t)
-			}
+		var req TrackClickReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid body", nil)
+			return
+		}
+		if req.ProductID == 0 || strings.TrimSpace(req.StoreName) == "" {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "productId and storeName required", gin.H{"required": []string{"productId", "storeName"}})
+			return
 		}
 
-		// Store click breakdown
-		stores := []StoreClicks{}
-		rows2, err2 := conn.Query(`
-			SELECT s.name, COUNT(*) AS clicks
-			FROM click_events ce
-			JOIN stores s ON s.id = ce.store_id
-			WHERE ce.created_at >= now() - interval '7 days'
-			GROUP BY s.name
-			ORDER BY clicks DESC
-			LIMIT 6
-		`)
-		if err2 == nil {
-			defer rows2.Close()
-			for rows2.Next() {
-				var s StoreClicks
-				_ = rows2.Scan(&s.Store, &s.Clicks)
-				stores = append(stores, s)
-			}
+		// store_id may be NULL if store wasn't found
+		// offer_id may be NULL if we couldn't map it
+		rec, counted, err := recordClick(c, analytics, cfg, req.SessionID, store.ClickEvent{
+			ProductID: req.ProductID,
+			StoreName: req.StoreName,
+			URL:       req.URL,
+			SearchKey: req.SearchID,
+		})
+		if err != nil {
+			api.Abort(c, err)
+			return
 		}
 
-		// Trending searches (last 7 days)
-		searches := []TopSearch{}
-		rows3, err3 := conn.Query(`
-			SELECT lower(trim(query)) AS q, COUNT(*) AS searches
-			FROM search_events
-			WHERE created_at >= now() - interval '7 days'
-			  AND query IS NOT NULL AND query <> ''
-			GROUP BY q
-			ORDER BY searches DESC
-			LIMIT 8
-		`)
-		if err3 == nil {
-			defer rows3.Close()
-			for rows3.Next() {
-				var s TopSearch
-				_ = rows3.Scan(&s.Query, &s.Searches)
-				searches = append(searches, s)
-			}
+		res := gin.H{
+			"ok":      true,
+			"storeId": rec.StoreID,
+			"offerId": rec.OfferID,
+			"counted": counted,
 		}
+		api.OK(c, http.StatusOK, res, nil, res)
+	}
+}
 
-		c.JSON(http.StatusOK, gin.H{
-			"trendingProducts": trending,
-			"storeClicks":      stores,
-			"topSearches":      searches,
-		})
+// recordClick fills in the visitor of c and records ev, reporting whether
+// the click counts (it is neither a bot's nor a duplicate).
+func recordClick(c *gin.Context, analytics store.AnalyticsStore, cfg config.Analytics, sessionID string, ev store.ClickEvent) (store.ClickResult, bool, error) {
+	v := newVisitor(c, cfg.HashKey, sessionID)
+	ev.SessionID, ev.VisitorKey, ev.IPHash = v.SessionID, v.Key, v.IPHash
+	ev.UserAgent, ev.Referrer, ev.Bot = v.UserAgent, v.Referrer, v.Bot
+	ev.DedupeWindow = cfg.DedupeWindow.Std()
+	rec, err := analytics.RecordClick(c.Request.Context(), ev)
+	if err != nil {
+		return rec, false, err
 	}
+	switch {
+	case v.Bot:
+		metrics.Event("click_bot")
+	case rec.Duplicate:
+		metrics.Event("click_duplicate")
+	default:
+		metrics.Event("click")
+	}
+	return rec, !v.Bot && !rec.Duplicate, nil
 }
 
-// POST /track/click
-// Body: { productId, storeName, url }
-// We resolve store_id and offer_id internally (best effort).
-func TrackClick(conn *sql.DB) gin.HandlerFunc {
-	type Req struct {
-		ProductID int64  `json:"productId"`
-		StoreName string `json:"storeName"`
-		URL       string `json:"url"`
+// logViewEvent records a view of the product in the background, like
+// logSearchEvent. Bot views and reloads within analytics.dedupeWindow are
+// stored but not counted.
+func logViewEvent(c *gin.Context, events *EventQueue, analytics store.AnalyticsStore, cfg config.Analytics, productID int) {
+	v := newVisitor(c, cfg.HashKey, "")
+	ev := store.ViewEvent{
+		ProductID: int64(productID),
+		SessionID: v.SessionID, VisitorKey: v.Key, IPHash: v.IPHash,
+		UserAgent: v.UserAgent, Referrer: v.Referrer, Bot: v.Bot,
+		DedupeWindow: cfg.DedupeWindow.Std(),
 	}
+	events.Enqueue(c.Request.Context(), "view", func(ctx context.Context) {
+		dup, err := analytics.RecordView(ctx, ev)
+		if err != nil {
+			logging.FromContext(ctx).Error("view event insert failed", "product_id", productID, "err", err)
+			return
+		}
+		switch {
+		case ev.Bot:
+			metrics.Event("view_bot")
+		case dup:
+			metrics.Event("view_duplicate")
+		default:
+			metrics.Event("view")
+		}
+	})
+}
+
+// maxClickBuckets bounds a /admin/analytics/clicks series: about six weeks
+// hourly, or years daily.
+const maxClickBuckets = 1000
 
+var clickBucketSize = map[string]time.Duration{"hour": time.Hour, "day": 24 * time.Hour, "week": 7 * 24 * time.Hour}
+
+// GET /admin/analytics/clicks?from=2026-09-01&to=2026-10-01&granularity=day&groupBy=store&limit=20
+// Product views, counted outbound clicks and searches per UTC bucket, with
+// click-through rate (clicks / views). from defaults to 30 days before to,
+// which defaults to now; both take a date or an RFC 3339 time and to is
+// exclusive. Counts come from rollups of whole hours (hourly reports) or
+// UTC days, so from is rounded down to one, and events after meta.asOf are
+// not counted yet. Hourly rollups are purged after analytics.retention, so
+// an hourly report cannot start before the retention cutoff. groupBy splits
+// the report by product, store, category or brand, keeping the limit most
+// clicked groups.
+func ClickAnalytics(analytics store.AnalyticsStore, cfg config.Analytics) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req Req
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		q := store.ClickQuery{
+			To:          time.Now().UTC(),
+			Granularity: c.DefaultQuery("granularity", "day"),
+			GroupBy:     c.Query("groupBy"),
+			Limit:       20,
+		}
+		var err error
+		if v := c.Query("to"); v != "" {
+			if q.To, err = parseReportTime(v); err != nil {
+				api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid to", gin.H{"param": "to"})
+				return
+			}
+		}
+		q.From = q.To.AddDate(0, 0, -30)
+		if v := c.Query("from"); v != "" {
+			if q.From, err = parseReportTime(v); err != nil {
+				api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid from", gin.H{"param": "from"})
+				return
+			}
+		}
+		if !q.From.Before(q.To) {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "from must be before to", nil)
 			return
 		}
-		if req.ProductID == 0 || strings.TrimSpace(req.StoreName) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "productId and storeName required"})
+		if !slices.Contains(store.Granularities, q.Granularity) {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid granularity", gin.H{"allowed": store.Granularities})
+			return
+		}
+		if q.GroupBy != "" && !slices.Contains(store.ClickGroupBys, q.GroupBy) {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid groupBy", gin.H{"allowed": store.ClickGroupBys})
+			return
+		}
+		if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 {
+			q.Limit = min(n, 100)
+		}
+		if q.To.Sub(q.From) > maxClickBuckets*clickBucketSize[q.Granularity] {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "range too long for granularity", gin.H{"maxBuckets": maxClickBuckets})
+			return
+		}
+		if cutoff := rollup.Cutoff(time.Now(), cfg.Retention.Std()); q.Granularity == "hour" && q.From.Before(cutoff) {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "hourly counts are not kept that far back; use granularity=day",
+				gin.H{"param": "from", "earliest": cutoff.Format(time.RFC3339)})
 			return
 		}
 
-		// Resolve store_id by name (case-insensitive)
-		var storeID sql.NullInt64
-		_ = conn.QueryRow(`
-			SELECT id FROM stores
-			WHERE lower(name) = lower($1)
-			LIMIT 1
-		`, req.StoreName).Scan(&storeID)
+		rep, err := analytics.ClickReport(c.Request.Context(), q)
+		if err != nil {
+			api.Abort(c, err)
+			return
+		}
 
-		// Resolve offer_id by product_id + store_id + url (best effort)
-		var offerID sql.NullInt64
-		if storeID.Valid && strings.TrimSpace(req.URL) != "" {
-			_ = conn.QueryRow(`
-				SELECT id FROM offers
-				WHERE product_id = $1 AND store_id = $2 AND url = $3
-				LIMIT 1
-			`, req.ProductID, storeID.Int64, req.URL).Scan(&offerID)
+		meta := gin.H{
+			"from":        q.From.Format(time.RFC3339),
+			"to":          q.To.Format(time.RFC3339),
+			"granularity": q.Granularity,
+			"groupBy":     q.GroupBy,
+			"asOf":        asOf(rep.AsOf),
 		}
+		report := gin.H{"totals": rep.Totals, "series": rep.Series, "groups": rep.Groups}
+		legacy := gin.H{}
+		for k, v := range meta {
+			legacy[k] = v
+		}
+		for k, v := range report {
+			legacy[k] = v
+		}
+		api.OK(c, http.StatusOK, report, meta, legacy)
+	}
+}
 
-		// Insert click event
-		// store_id may be NULL if store wasn't found
-		// offer_id may be NULL if we couldn't map it
-		_, _ = conn.Exec(`
-			INSERT INTO click_events (product_id, offer_id, store_id)
-			VALUES ($1, $2, $3)
-		`, req.ProductID, offerID, storeID)
+// asOf renders a report's AsOf: the reports read rollups, so events after
+// it are not counted yet. null before the first rollup.
+func asOf(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
 
-		c.JSON(http.StatusOK, gin.H{
-			"ok":      true,
-			"storeId": storeID,
-			"offerId": offerID,
-		})
+// parseReportTime reads a date (midnight UTC) or an RFC 3339 time.
+func parseReportTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
 	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t.UTC(), err
 }
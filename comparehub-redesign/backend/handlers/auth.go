@@ -1,53 +1,107 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/config"
+	"go-ecommerce-backend/metrics"
+	"go-ecommerce-backend/ratelimit"
+	"go-ecommerce-backend/store"
 )
 
-type loginReq struct {
+type LoginReq struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
-func Login() gin.HandlerFunc {
+// MinAdminPasswordLen is enforced when admin accounts are created.
+const MinAdminPasswordLen = 10
+
+// HashAdminPassword returns the bcrypt hash stored for an admin account.
+func HashAdminPassword(password string) (string, error) {
+	if len(password) < MinAdminPasswordLen {
+		return "", errors.New("password must be at least 10 characters")
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(b), err
+}
+
+// checkAdmin accepts accounts from the admin store first and falls back to
+// the configured ADMIN_EMAIL / ADMIN_PASSWORD pair.
+func checkAdmin(c *gin.Context, admins store.AdminStore, auth config.Auth, email, password string) (bool, error) {
+	if admins != nil {
+		hash, err := admins.AdminPasswordHash(c.Request.Context(), email)
+		if err == nil {
+			return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, nil
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			return false, err
+		}
+	}
+
+	if auth.AdminEmail == "" || auth.AdminPassword == "" {
+		return false, nil
+	}
+	return email == auth.AdminEmail && password == auth.AdminPassword, nil
+}
+
+// Login exchanges admin credentials for a JWT. An account that keeps
+// failing from one client IP is locked out for that IP (see
+// ratelimit.Lockout); while locked, every attempt from there gets a 429
+// without the password being checked.
+func Login(admins store.AdminStore, auth config.Auth, lockout *ratelimit.Lockout) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req loginReq
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		var req LoginReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid json", nil)
 			return
 		}
 
-		adminEmail := os.Getenv("ADMIN_EMAIL")
-		adminPass := os.Getenv("ADMIN_PASSWORD")
-		secret := os.Getenv("JWT_SECRET")
+		secret := auth.JWTSecret
 		if secret == "" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT_SECRET missing"})
+			api.Fail(c, http.StatusInternalServerError, api.CodeInternal, "JWT_SECRET missing", nil)
 			return
 		}
 
-		if req.Email != adminEmail || req.Password != adminPass {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		ctx, ip := c.Request.Context(), c.ClientIP()
+		if wait := lockout.Locked(ctx, req.Email, ip); wait > 0 {
+			metrics.RateLimited("POST /auth/login", "lockout")
+			ratelimit.Reject(c, wait, "too many failed logins; try again later")
+			return
+		}
+
+		ok, err := checkAdmin(c, admins, auth, req.Email, req.Password)
+		if err != nil {
+			api.Abort(c, err)
+			return
+		}
+		if !ok {
+			lockout.Fail(ctx, req.Email, ip)
+			api.Fail(c, http.StatusUnauthorized, api.CodeUnauthorized, "invalid credentials", nil)
 			return
 		}
+		lockout.Reset(ctx, req.Email, ip)
 
 		claims := jwt.MapClaims{
 			"email": req.Email,
 			"role":  "admin",
-			"exp":   time.Now().Add(24 * time.Hour).Unix(),
+			"exp":   time.Now().Add(auth.TokenTTL.Std()).Unix(),
 		}
 
 		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 		signed, err := token.SignedString([]byte(secret))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "token signing failed"})
+			api.Fail(c, http.StatusInternalServerError, api.CodeInternal, "token signing failed", nil)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"token": signed})
+		api.OK(c, http.StatusOK, gin.H{"token": signed}, nil, gin.H{"token": signed})
 	}
 }
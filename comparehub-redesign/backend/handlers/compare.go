@@ -1,22 +1,54 @@
 package handlers
 
 import (
-	"database/sql"
-	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lib/pq"
+
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/store"
 )
 
+// CompareOffer is one store offer in a /compare response.
+type CompareOffer struct {
+	Source string   `json:"source"`
+	Price  float64  `json:"price"`
+	Rating *float64 `json:"rating"`
+	URL    string   `json:"url"`
+	Link   string   `json:"link"` // see GoLink
+}
+
+// BestOffer is the cheapest matching offer; all fields are empty when the
+// product has no offer under the requested filters.
+type BestOffer struct {
+	Source string   `json:"source"`
+	Price  *float64 `json:"price"`
+	Rating *float64 `json:"rating"`
+	URL    *string  `json:"url"`
+	Link   *string  `json:"link"`
+}
+
+// CompareProduct is one column of the compare table.
+type CompareProduct struct {
+	ID          int            `json:"id"`
+	Name        string         `json:"name"`
+	Brand       string         `json:"brand"`
+	Category    string         `json:"category"`
+	Description string         `json:"description"`
+	ImageURL    string         `json:"imageUrl"`
+	Offers      []CompareOffer `json:"offers"`
+	Specs       any            `json:"specs,omitempty"`
+	BestOffer   BestOffer      `json:"bestOffer"`
+}
+
 // GET /compare?ids=1,2,3
-func Compare(conn *sql.DB) gin.HandlerFunc {
+func Compare(products store.ProductStore, offers store.OfferStore, specs store.SpecStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		raw := c.Query("ids")
 		if strings.TrimSpace(raw) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "ids is required, ex: /compare?ids=1,2"})
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "ids is required, ex: /compare?ids=1,2", gin.H{"param": "ids"})
 			return
 		}
 
@@ -30,162 +62,82 @@ func Compare(conn *sql.DB) gin.HandlerFunc {
 			}
 			n, err := strconv.Atoi(s)
 			if err != nil || n <= 0 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ids param"})
+				api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid ids param", gin.H{"param": "ids", "value": s})
 				return
 			}
 			ids = append(ids, n)
 		}
 
 		if len(ids) < 2 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "select at least 2 product ids"})
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "select at least 2 product ids", gin.H{"param": "ids"})
 			return
 		}
 
-		// Build placeholders: $1,$2,$3...
-		ph := make([]string, len(ids))
-		args := make([]any, len(ids))
-		for i, id := range ids {
-			ph[i] = "$" + strconv.Itoa(i+1)
-			args[i] = id
-		}
-
 		condition := parseConditionParam(c.Query("condition"))
 		stores := parseStoresParam(c.Query("stores"))
-		// Normalize store names so the client can send "BestBuy" or "Best Buy"
-		// while still matching DB values.
-		storesNorm := make([]string, 0, len(stores))
-		for _, s := range stores {
-			clean := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), " ", ""))
-			if clean != "" {
-				storesNorm = append(storesNorm, clean)
-			}
-		}
-
-		type Offer struct {
-			Source string   `json:"source"`
-			Price  float64  `json:"price"`
-			Rating *float64 `json:"rating"`
-			URL    string   `json:"url"`
-		}
-
-		type BestOffer struct {
-			Source string   `json:"source"`
-			Price  *float64 `json:"price"`
-			Rating *float64 `json:"rating"`
-			URL    *string  `json:"url"`
-		}
-
-		type Product struct {
-			ID          int       `json:"id"`
-			Name        string    `json:"name"`
-			Brand       string    `json:"brand"`
-			Category    string    `json:"category"`
-			Description string    `json:"description"`
-			ImageURL    string    `json:"imageUrl"`
-			Offers      []Offer   `json:"offers"`
-			Specs       any       `json:"specs,omitempty"`
-			BestOffer   BestOffer `json:"bestOffer"`
-		}
+		filter := store.OfferFilter{Condition: condition, Stores: stores}
+		ctx := c.Request.Context()
 
 		// 1) Load products
-		productSQL := `
-			SELECT id, name, brand, category, description, image_url
-			FROM products
-			WHERE id IN (` + strings.Join(ph, ",") + `)
-			ORDER BY id;
-		`
-
-		rows, err := conn.Query(productSQL, args...)
+		rows, err := products.GetProducts(ctx, ids)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			api.Abort(c, err)
 			return
 		}
-		defer rows.Close()
 
-		products := []Product{}
-		index := map[int]*Product{}
-
-		for rows.Next() {
-			var p Product
-			if err := rows.Scan(&p.ID, &p.Name, &p.Brand, &p.Category, &p.Description, &p.ImageURL); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-			p.Offers = []Offer{}
-			products = append(products, p)
-			index[p.ID] = &products[len(products)-1]
+		list := []CompareProduct{}
+		for _, r := range rows {
+			list = append(list, CompareProduct{
+				ID: r.ID, Name: r.Name, Brand: r.Brand, Category: r.Category,
+				Description: r.Description, ImageURL: r.ImageURL,
+				Offers: []CompareOffer{},
+			})
+		}
+		index := map[int]*CompareProduct{}
+		for i := range list {
+			index[list[i].ID] = &list[i]
 		}
 
 		// 2) Load specs for those products
-		specSQL := `
-			SELECT product_id, specs_json
-			FROM product_specs
-			WHERE product_id IN (` + strings.Join(ph, ",") + `);
-		`
-		specRows, err := conn.Query(specSQL, args...)
+		sp, err := specs.GetSpecs(ctx, ids)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			api.Abort(c, err)
 			return
 		}
-		defer specRows.Close()
-		for specRows.Next() {
-			var pid int
-			var raw []byte
-			if err := specRows.Scan(&pid, &raw); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-			if p := index[pid]; p != nil {
-				var m map[string]any
-				_ = json.Unmarshal(raw, &m)
-				p.Specs = m
+		for pid, s := range sp {
+			if p := index[pid]; p != nil && s.Data != nil {
+				p.Specs = s.Data
 			}
 		}
 
-		// 3) Load offers for those products (filtered)
-		offerSQL := `
-			SELECT o.product_id, s.name, o.price, o.rating, o.url
-			FROM offers o
-			JOIN stores s ON s.id = o.store_id
-			WHERE o.active = true
-			  AND o.condition = $` + strconv.Itoa(len(args)+1) + `
-			  AND lower(replace(s.name, ' ', '')) = ANY($` + strconv.Itoa(len(args)+2) + `)
-			  AND o.product_id IN (` + strings.Join(ph, ",") + `)
-			ORDER BY o.product_id, o.price ASC;
-		`
-		offerArgs := append(append([]any{}, args...), condition, pq.Array(storesNorm))
-		offerRows, err := conn.Query(offerSQL, offerArgs...)
+		// 3) Load offers for those products (filtered). Store names are
+		// matched ignoring case and spaces, so "BestBuy" and "Best Buy" both work.
+		offerRows, err := offers.ListOffers(ctx, ids, filter)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			api.Abort(c, err)
 			return
 		}
-		defer offerRows.Close()
-
-		for offerRows.Next() {
-			var pid int
-			var o Offer
-			if err := offerRows.Scan(&pid, &o.Source, &o.Price, &o.Rating, &o.URL); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-			if p := index[pid]; p != nil {
-				p.Offers = append(p.Offers, o)
+		for _, o := range offerRows {
+			if p := index[o.ProductID]; p != nil {
+				p.Offers = append(p.Offers, CompareOffer{Source: o.Store, Price: o.Price, Rating: o.Rating, URL: o.URL, Link: GoLink(o.ID)})
 			}
 		}
 
 		// 4) Compute best offer per product
-		for i := range products {
-			p := &products[i]
+		for i := range list {
+			p := &list[i]
 			if len(p.Offers) == 0 {
 				p.BestOffer = BestOffer{Source: ""}
 				continue
 			}
 			best := p.Offers[0]
 			price := best.Price
-			url := best.URL
-			p.BestOffer = BestOffer{Source: best.Source, Price: &price, Rating: best.Rating, URL: &url}
+			url, link := best.URL, best.Link
+			p.BestOffer = BestOffer{Source: best.Source, Price: &price, Rating: best.Rating, URL: &url, Link: &link}
 		}
 
-		c.JSON(http.StatusOK, gin.H{"products": products, "filters": gin.H{"condition": condition, "stores": stores}})
+		filters := gin.H{"condition": condition, "stores": stores}
+		setLastModified(c, lastModified(offerRows, sp))
+		api.OK(c, http.StatusOK, list, gin.H{"filters": filters}, gin.H{"products": list, "filters": filters})
 	}
 }
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/metrics"
+)
+
+// EventQueue records analytics events (searches, product views) off the
+// request path on a fixed number of workers. When the queue is full the
+// event is dropped and counted as "<kind>_dropped", so a traffic spike
+// costs analytics rather than goroutines and database connections.
+type EventQueue struct {
+	jobs chan eventJob
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+	closed  bool
+}
+
+type eventJob struct {
+	ctx context.Context
+	run func(context.Context)
+}
+
+// NewEventQueue starts workers reading a queue of size events.
+func NewEventQueue(size, workers int) *EventQueue {
+	q := &EventQueue{jobs: make(chan eventJob, size)}
+	q.idle = sync.NewCond(&q.mu)
+	for range workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+func (q *EventQueue) work() {
+	defer q.wg.Done()
+	for j := range q.jobs {
+		j.run(j.ctx)
+		q.mu.Lock()
+		q.pending--
+		if q.pending == 0 {
+			q.idle.Broadcast()
+		}
+		q.mu.Unlock()
+	}
+}
+
+// Enqueue schedules run, reporting whether it was queued. run gets ctx
+// without its cancellation: the insert outlives the request but keeps its
+// logger (and request_id).
+func (q *EventQueue) Enqueue(ctx context.Context, kind string, run func(context.Context)) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		select {
+		case q.jobs <- eventJob{ctx: context.WithoutCancel(ctx), run: run}:
+			q.pending++
+			return true
+		default:
+		}
+	}
+	metrics.Event(kind + "_dropped")
+	logging.FromContext(ctx).Log(ctx, slog.LevelWarn, "analytics event dropped", "kind", kind)
+	return false
+}
+
+// Flush waits until every queued event has been recorded.
+func (q *EventQueue) Flush() {
+	q.mu.Lock()
+	for q.pending > 0 {
+		q.idle.Wait()
+	}
+	q.mu.Unlock()
+}
+
+// Close stops accepting events and waits, until ctx is done, for the
+// queued ones to be recorded.
+func (q *EventQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/store"
+)
+
+// ExportFormats are the file formats of /admin/analytics/export.
+var ExportFormats = []string{"csv", "ndjson"}
+
+// ExportGranularities are the rollup tables an export can read.
+var ExportGranularities = []string{"hour", "day"}
+
+const (
+	// exportFlushRows is how many rows go out per chunk.
+	exportFlushRows = 500
+	// exportWriteWindow replaces server.writeTimeout for exports: each
+	// chunk must reach the client within it.
+	exportWriteWindow = time.Minute
+)
+
+// GET /admin/analytics/export?dataset=clicks&from=2026-09-01&to=2026-10-01&format=csv
+// Streams the raw click, view or search events, or their hourly or daily
+// rollups (granularity), created in [from, to) as a CSV or NDJSON
+// download. from and to work as in /admin/analytics/clicks. Rows are
+// written in chunks as the database returns them, so the size of the range
+// does not matter. Once the first chunk is out an error can only end the
+// stream early; it is logged.
+func AnalyticsExport(analytics store.AnalyticsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := store.ExportQuery{
+			Dataset:     c.Query("dataset"),
+			Granularity: c.DefaultQuery("granularity", "day"),
+			To:          time.Now().UTC(),
+		}
+		format := c.DefaultQuery("format", "csv")
+		if !slices.Contains(store.ExportDatasets, q.Dataset) {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid dataset", gin.H{"allowed": store.ExportDatasets})
+			return
+		}
+		if !slices.Contains(ExportFormats, format) {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid format", gin.H{"allowed": ExportFormats})
+			return
+		}
+		if !slices.Contains(ExportGranularities, q.Granularity) {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid granularity", gin.H{"allowed": ExportGranularities})
+			return
+		}
+		var err error
+		if v := c.Query("to"); v != "" {
+			if q.To, err = parseReportTime(v); err != nil {
+				api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid to", gin.H{"param": "to"})
+				return
+			}
+		}
+		q.From = q.To.AddDate(0, 0, -30)
+		if v := c.Query("from"); v != "" {
+			if q.From, err = parseReportTime(v); err != nil {
+				api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid from", gin.H{"param": "from"})
+				return
+			}
+		}
+		if !q.From.Before(q.To) {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "from must be before to", nil)
+			return
+		}
+
+		w := newExportWriter(c, q, format)
+		err = analytics.Export(c.Request.Context(), q, w.row)
+		if err == nil {
+			err = w.close()
+		}
+		if err == nil {
+			return
+		}
+		if !w.started {
+			api.Abort(c, err)
+			return
+		}
+		level := slog.LevelError
+		if c.Request.Context().Err() != nil {
+			level = slog.LevelInfo // the client went away
+		}
+		logging.FromContext(c.Request.Context()).Log(c.Request.Context(), level, "analytics export interrupted",
+			"dataset", q.Dataset, "rows", w.rows, "err", err)
+	}
+}
+
+// exportWriter encodes rows onto the response. Headers go out with the
+// first row (or at the end of an empty export), so an export failing
+// up front still gets a proper error response.
+type exportWriter struct {
+	c       *gin.Context
+	q       store.ExportQuery
+	format  string
+	columns []string
+	started bool
+	rows    int
+
+	buf  *bufio.Writer
+	csv  *csv.Writer
+	ctrl *http.ResponseController
+}
+
+func newExportWriter(c *gin.Context, q store.ExportQuery, format string) *exportWriter {
+	return &exportWriter{c: c, q: q, format: format, columns: store.ExportColumns[q.Dataset]}
+}
+
+func (w *exportWriter) start() error {
+	w.started = true
+	name := fmt.Sprintf("comparehub-%s-%s-%s.%s", w.q.Dataset,
+		w.q.From.UTC().Format("20060102"), w.q.To.UTC().Format("20060102"), w.format)
+	h := w.c.Writer.Header()
+	if w.format == "csv" {
+		h.Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		h.Set("Content-Type", "application/x-ndjson")
+	}
+	h.Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	h.Set("Cache-Control", "no-store")
+	w.c.Status(http.StatusOK)
+
+	w.ctrl = http.NewResponseController(w.c.Writer)
+	w.extendDeadline()
+	w.buf = bufio.NewWriter(w.c.Writer)
+	if w.format == "csv" {
+		w.csv = csv.NewWriter(w.buf)
+		return w.csv.Write(w.columns)
+	}
+	return nil
+}
+
+// extendDeadline pushes the write deadline out by exportWriteWindow. It
+// is a no-op where the writer does not support deadlines (tests).
+func (w *exportWriter) extendDeadline() {
+	_ = w.ctrl.SetWriteDeadline(time.Now().Add(exportWriteWindow))
+}
+
+func (w *exportWriter) row(r store.ExportRow) error {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	var err error
+	if w.csv != nil {
+		rec := make([]string, len(r))
+		for i, v := range r {
+			rec[i] = csvValue(v)
+		}
+		err = w.csv.Write(rec)
+	} else {
+		err = w.writeJSON(r)
+	}
+	if err != nil {
+		return err
+	}
+	w.rows++
+	if w.rows%exportFlushRows == 0 {
+		return w.flush()
+	}
+	return nil
+}
+
+// writeJSON writes r as one object with the keys in column order.
+func (w *exportWriter) writeJSON(r store.ExportRow) error {
+	w.buf.WriteByte('{')
+	for i, v := range r {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		if t, ok := v.(time.Time); ok {
+			v = t.UTC().Format(time.RFC3339)
+		}
+		k, _ := json.Marshal(w.columns[i])
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		w.buf.Write(k)
+		w.buf.WriteByte(':')
+		w.buf.Write(b)
+	}
+	w.buf.WriteString("}\n")
+	return nil
+}
+
+func (w *exportWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	w.c.Writer.Flush()
+	w.extendDeadline()
+	return nil
+}
+
+func (w *exportWriter) close() error {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	return w.flush()
+}
+
+// csvValue formats v for a spreadsheet. Text starting with a formula
+// character (searches are typed by anyone) is prefixed with a quote so
+// spreadsheet apps do not evaluate it.
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,962 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/cache"
+	"go-ecommerce-backend/config"
+	"go-ecommerce-backend/handlers"
+	"go-ecommerce-backend/middleware"
+	"go-ecommerce-backend/ratelimit"
+	"go-ecommerce-backend/routes"
+	"go-ecommerce-backend/store"
+	"go-ecommerce-backend/store/memory"
+)
+
+var testAuth = config.Auth{
+	JWTSecret:     "test-secret-test-secret-test-secret",
+	AdminEmail:    "admin@example.com",
+	AdminPassword: "hunter2",
+	TokenTTL:      config.Duration(time.Hour),
+}
+
+// testRouter is the production route table (routes.Mount) over the
+// in-memory store.
+type testRouter struct {
+	*gin.Engine
+	events *handlers.EventQueue
+}
+
+// flush waits for the searches and views queued so far to be recorded.
+func (r testRouter) flush() { r.events.Flush() }
+
+func newRouter(mem *memory.Store) testRouter {
+	return newRouterWithAuth(mem, testAuth)
+}
+
+func newRouterWithAuth(mem *memory.Store, auth config.Auth) testRouter {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	cfg.Auth = auth
+	rc, err := cache.New(cfg.Cache)
+	if err != nil {
+		panic(err)
+	}
+	r := testRouter{Engine: gin.New(), events: handlers.NewEventQueue(100, 1)}
+	r.Use(middleware.RequestID())
+	routes.Mount(r.Engine, routes.Deps{Config: cfg, Stores: mem.Stores(), Cache: rc, Events: r.events})
+	return r
+}
+
+func ptr(f float64) *float64 { return &f }
+
+// seed creates three phones and one laptop with offers across stores.
+func seed(t *testing.T, mem *memory.Store) {
+	t.Helper()
+	ctx := context.Background()
+	products := []store.Product{
+		{Name: "Pixel 8", Brand: "Google", Category: "phones"},
+		{Name: "iPhone 15", Brand: "Apple", Category: "phones"},
+		{Name: "Galaxy S24", Brand: "Samsung", Category: "phones"},
+		{Name: "MacBook Air", Brand: "Apple", Category: "laptops"},
+	}
+	for _, p := range products {
+		if _, err := mem.CreateProduct(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offers := []store.NewOffer{
+		{ProductID: 1, StoreName: "Amazon", Price: 599, Rating: ptr(4.5), URL: "https://a.example/pixel"},
+		{ProductID: 1, StoreName: "Best Buy", Price: 579, Rating: ptr(4.4), URL: "https://b.example/pixel"},
+		{ProductID: 2, StoreName: "Walmart", Price: 799, Rating: ptr(4.8), URL: "https://w.example/iphone"},
+		{ProductID: 2, StoreName: "Amazon", Price: 649, Rating: ptr(4.7), URL: "https://a.example/iphone-used", Condition: "Used"},
+		{ProductID: 3, StoreName: "Amazon", Price: 699, Rating: ptr(4.6), URL: "https://a.example/galaxy"},
+		{ProductID: 4, StoreName: "Walmart", Price: 999, Rating: ptr(4.9), URL: "https://w.example/mba"},
+	}
+	for _, o := range offers {
+		if err := mem.CreateOffer(ctx, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mem.UpsertSpecs(ctx, 1, map[string]any{"screen": "6.2in", "review_count": 120}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func do(r http.Handler, method, path string, body any, header http.Header) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return v
+}
+
+// adminAuth logs in as the test admin and returns the Authorization
+// header for the admin routes.
+func adminAuth(t *testing.T, r http.Handler) http.Header {
+	t.Helper()
+	w := do(r, http.MethodPost, "/auth/login", gin.H{"email": "admin@example.com", "password": "hunter2"}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+	login := decode[struct {
+		Token string `json:"token"`
+	}](t, w)
+	return http.Header{"Authorization": {"Bearer " + login.Token}}
+}
+
+func names(rows []store.ProductRow) []string {
+	out := make([]string, len(rows))
+	for i, r := range rows {
+		out[i] = r.Name
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestListProducts(t *testing.T) {
+	mem := memory.New()
+	seed(t, mem)
+	r := newRouter(mem)
+
+	cases := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"default sort is price ascending", "/products", []string{"Pixel 8", "iPhone 15", "Galaxy S24", "MacBook Air"}},
+		{"high", "/products?sort=high", []string{"MacBook Air", "Galaxy S24", "iPhone 15", "Pixel 8"}},
+		{"rating", "/products?sort=rating", []string{"MacBook Air", "iPhone 15", "Galaxy S24", "Pixel 8"}},
+		{"search matches brand", "/products?q=apple", []string{"iPhone 15", "MacBook Air"}},
+		{"category", "/products?category=laptops", []string{"MacBook Air"}},
+		{"price range", "/products?minPrice=600&maxPrice=800", []string{"iPhone 15", "Galaxy S24"}},
+		// Products without a matching offer are still listed (best price 0)
+		// unless a price bound excludes them.
+		{"store filter", "/products?stores=walmart", []string{"Pixel 8", "Galaxy S24", "iPhone 15", "MacBook Air"}},
+		{"store filter with price bound", "/products?stores=walmart&minPrice=1", []string{"iPhone 15", "MacBook Air"}},
+		{"used only", "/products?condition=Used&minPrice=1", []string{"iPhone 15"}},
+		{"new only", "/products?condition=New&sort=high", []string{"MacBook Air", "iPhone 15", "Galaxy S24", "Pixel 8"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(r, http.MethodGet, tc.query, nil, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body.String())
+			}
+			got := names(decode[[]store.ProductRow](t, w))
+			if !equal(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("best offer and review count", func(t *testing.T) {
+		rows := decode[[]store.ProductRow](t, do(r, http.MethodGet, "/products?q=pixel", nil, nil))
+		if len(rows) != 1 || rows[0].BestPrice != 579 || rows[0].BestSource != "Best Buy" {
+			t.Fatalf("unexpected row %+v", rows)
+		}
+		if rows[0].ReviewCount == nil || *rows[0].ReviewCount != 120 {
+			t.Fatalf("review count = %v, want 120", rows[0].ReviewCount)
+		}
+	})
+
+	t.Run("search event recorded", func(t *testing.T) {
+		w := do(r, http.MethodGet, "/products?q=nothing-matches", nil, nil)
+		key := w.Header().Get("X-Search-ID")
+		if key == "" {
+			t.Fatal("missing X-Search-ID header")
+		}
+		r.flush()
+		for _, ev := range mem.Searches() {
+			if ev.Key == key {
+				if ev.Query != "nothing-matches" || ev.ResultCount != 0 {
+					t.Fatalf("search event = %+v", ev)
+				}
+				return
+			}
+		}
+		t.Fatalf("search event %s not recorded", key)
+	})
+
+	t.Run("only first pages of searches are logged", func(t *testing.T) {
+		before := len(mem.Searches())
+		for _, req := range []struct {
+			path   string
+			header http.Header
+		}{
+			{"/products?category=phones", nil},
+			{"/products?q=apple&page=2&limit=1", nil},
+			{"/products?q=apple", http.Header{"If-None-Match": {`"x"`}}},
+		} {
+			if w := do(r, http.MethodGet, req.path, nil, req.header); w.Header().Get("X-Search-ID") != "" {
+				t.Errorf("%s: X-Search-ID set", req.path)
+			}
+		}
+		w := do(r, http.MethodGet, "/products?q=apple&limit=1", nil, nil)
+		key := w.Header().Get("X-Search-ID")
+		r.flush()
+		got := mem.Searches()[before:]
+		// ResultCount is every match, not the one-row page.
+		if len(got) != 1 || got[0].Key != key || got[0].ResultCount != 2 {
+			t.Fatalf("search events = %+v", got)
+		}
+	})
+}
+
+func TestListProductsCursorPaging(t *testing.T) {
+	mem := memory.New()
+	seed(t, mem)
+	r := newRouter(mem)
+
+	type envelope struct {
+		Data []store.ProductRow `json:"data"`
+		Meta struct {
+			NextCursor string `json:"nextCursor"`
+			HasMore    bool   `json:"hasMore"`
+			Total      *int64 `json:"total"`
+		} `json:"meta"`
+	}
+
+	var got []string
+	url := "/v1/products?limit=3&withTotal=true"
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging did not terminate")
+		}
+		w := do(r, http.MethodGet, url, nil, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		env := decode[envelope](t, w)
+		if env.Meta.Total == nil || *env.Meta.Total != 4 {
+			t.Fatalf("total = %v, want 4", env.Meta.Total)
+		}
+		got = append(got, names(env.Data)...)
+		if !env.Meta.HasMore {
+			break
+		}
+		url = "/v1/products?limit=3&withTotal=true&cursor=" + env.Meta.NextCursor
+	}
+	want := []string{"Pixel 8", "iPhone 15", "Galaxy S24", "MacBook Air"}
+	if !equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	t.Run("cursor from another sort is rejected", func(t *testing.T) {
+		page := decode[envelope](t, do(r, http.MethodGet, "/v1/products?limit=1", nil, nil))
+		w := do(r, http.MethodGet, "/v1/products?sort=rating&cursor="+page.Meta.NextCursor, nil, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("status %d, want 400", w.Code)
+		}
+	})
+}
+
+func TestGetProductAndOffers(t *testing.T) {
+	mem := memory.New()
+	seed(t, mem)
+	r := newRouter(mem)
+
+	w := do(r, http.MethodGet, "/products/1", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	p := decode[handlers.ProductDetail](t, w)
+	if p.Name != "Pixel 8" || len(p.Offers) != 2 || p.Offers[0].Store != "Best Buy" {
+		t.Fatalf("unexpected product %+v", p)
+	}
+	if p.Specs == nil || p.LastUpdated == nil {
+		t.Fatal("specs missing")
+	}
+
+	if w := do(r, http.MethodGet, "/products/99", nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("missing product: status %d, want 404", w.Code)
+	}
+	if w := do(r, http.MethodGet, "/products/abc", nil, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad id: status %d, want 400", w.Code)
+	}
+
+	t.Run("offers honour filters", func(t *testing.T) {
+		body := decode[struct {
+			Offers []handlers.OfferRow `json:"offers"`
+		}](t, do(r, http.MethodGet, "/products/2/offers", nil, nil))
+		if len(body.Offers) != 2 || body.Offers[0].Price != 649 {
+			t.Fatalf("any condition: %+v", body.Offers)
+		}
+
+		body = decode[struct {
+			Offers []handlers.OfferRow `json:"offers"`
+		}](t, do(r, http.MethodGet, "/products/2/offers?condition=New", nil, nil))
+		if len(body.Offers) != 1 || body.Offers[0].Store != "Walmart" {
+			t.Fatalf("new only: %+v", body.Offers)
+		}
+	})
+
+	t.Run("inactive offers are hidden", func(t *testing.T) {
+		mem.SetOfferActive(2, false) // Best Buy Pixel
+		p := decode[handlers.ProductDetail](t, do(r, http.MethodGet, "/products/1", nil, nil))
+		if len(p.Offers) != 1 || p.Offers[0].Store != "Amazon" {
+			t.Fatalf("offers = %+v", p.Offers)
+		}
+	})
+}
+
+func TestConditionalGET(t *testing.T) {
+	mem := memory.New()
+	seededAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mem.Now = func() time.Time { return seededAt }
+	seed(t, mem)
+	r := newRouter(mem)
+
+	w := do(r, http.MethodGet, "/v1/products/1", nil, nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Cache-Control") == "" {
+		t.Fatalf("status %d, ETag %q, Cache-Control %q", w.Code, etag, w.Header().Get("Cache-Control"))
+	}
+	if lm := w.Header().Get("Last-Modified"); lm != seededAt.Format(http.TimeFormat) {
+		t.Errorf("Last-Modified = %q", lm)
+	}
+
+	cases := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"matching etag", http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{"other etag", http.Header{"If-None-Match": {`"stale"`}}, http.StatusOK},
+		{"not modified since", http.Header{"If-Modified-Since": {seededAt.Format(http.TimeFormat)}}, http.StatusNotModified},
+		{"modified since", http.Header{"If-Modified-Since": {seededAt.Add(-time.Second).Format(http.TimeFormat)}}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		w := do(r, http.MethodGet, "/v1/products/1", nil, tc.header)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want)
+		}
+		if w.Code == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("ETag") != etag) {
+			t.Errorf("%s: 304 with body %q, ETag %q", tc.name, w.Body, w.Header().Get("ETag"))
+		}
+	}
+
+	// A new offer changes the body, and with it the ETag.
+	mem.Now = func() time.Time { return seededAt.Add(time.Hour) }
+	if err := mem.CreateOffer(context.Background(), store.NewOffer{ProductID: 1, StoreName: "Walmart", Price: 499, URL: "https://w.example/pixel"}); err != nil {
+		t.Fatal(err)
+	}
+	w = do(r, http.MethodGet, "/v1/products/1", nil, http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("after a new offer: status %d, ETag %q (was %q)", w.Code, w.Header().Get("ETag"), etag)
+	}
+
+	// Searches may be stored but are revalidated, so each one reaches the
+	// server.
+	w = do(r, http.MethodGet, "/products", nil, nil)
+	if cc := w.Header().Get("Cache-Control"); cc != middleware.Revalidate {
+		t.Errorf("/products Cache-Control = %q", cc)
+	}
+	if vary := w.Header().Values("Vary"); len(vary) == 0 || vary[len(vary)-1] != "X-API-Version" {
+		t.Errorf("legacy /products Vary = %q", vary)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	mem := memory.New()
+	seed(t, mem)
+	r := newRouter(mem)
+
+	w := do(r, http.MethodGet, "/compare?ids=1,2&condition=Any", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	body := decode[struct {
+		Products []handlers.CompareProduct `json:"products"`
+	}](t, w)
+	if len(body.Products) != 2 {
+		t.Fatalf("got %d products", len(body.Products))
+	}
+	pixel, iphone := body.Products[0], body.Products[1]
+	if pixel.BestOffer.Source != "Best Buy" || *pixel.BestOffer.Price != 579 {
+		t.Fatalf("pixel best offer %+v", pixel.BestOffer)
+	}
+	if iphone.BestOffer.Source != "Amazon" || *iphone.BestOffer.Price != 649 {
+		t.Fatalf("iphone best offer %+v", iphone.BestOffer)
+	}
+	if pixel.Specs == nil {
+		t.Fatal("pixel specs missing")
+	}
+
+	for _, q := range []string{"", "?ids=1", "?ids=1,x"} {
+		if w := do(r, http.MethodGet, "/compare"+q, nil, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("/compare%s: status %d, want 400", q, w.Code)
+		}
+	}
+}
+
+func TestAdminFlows(t *testing.T) {
+	mem := memory.New()
+	r := newRouter(mem)
+
+	if w := do(r, http.MethodPost, "/admin/products", gin.H{"name": "x"}, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: status %d, want 401", w.Code)
+	}
+	if w := do(r, http.MethodPost, "/auth/login", gin.H{"email": "admin@example.com", "password": "nope"}, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("bad password: status %d, want 401", w.Code)
+	}
+
+	login := decode[struct {
+		Token string `json:"token"`
+	}](t, do(r, http.MethodPost, "/auth/login", gin.H{"email": "admin@example.com", "password": "hunter2"}, nil))
+	auth := http.Header{"Authorization": {"Bearer " + login.Token}}
+
+	w := do(r, http.MethodPost, "/admin/products", gin.H{"name": "Pixel 9", "brand": "Google", "category": "phones"}, auth)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create product: status %d: %s", w.Code, w.Body.String())
+	}
+	id := decode[struct {
+		ID int `json:"id"`
+	}](t, w).ID
+
+	offer := gin.H{"productId": id, "storeName": "Amazon", "price": 899, "rating": 4.6, "url": "https://a.example/pixel9"}
+	if w := do(r, http.MethodPost, "/admin/offers", offer, auth); w.Code != http.StatusOK {
+		t.Fatalf("create offer: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(r, http.MethodPost, "/admin/specs", gin.H{"productId": id, "specs": gin.H{"ram": "12GB"}}, auth); w.Code != http.StatusOK {
+		t.Fatalf("upsert specs: status %d: %s", w.Code, w.Body.String())
+	}
+
+	p := decode[handlers.ProductDetail](t, do(r, http.MethodGet, "/products/1", nil, nil))
+	if p.Name != "Pixel 9" || len(p.Offers) != 1 || p.Specs == nil {
+		t.Fatalf("created product %+v", p)
+	}
+
+	cases := []struct {
+		name string
+		path string
+		body gin.H
+		want int
+		code api.Code
+	}{
+		{"product without name", "/v1/admin/products", gin.H{"brand": "x"}, http.StatusBadRequest, api.CodeInvalidArgument},
+		{"offer without price", "/v1/admin/offers", gin.H{"productId": id, "storeName": "Amazon", "url": "u"}, http.StatusBadRequest, api.CodeInvalidArgument},
+		{"offer for unknown product", "/v1/admin/offers", gin.H{"productId": 42, "storeName": "Amazon", "price": 1, "url": "u"}, http.StatusUnprocessableEntity, api.CodeInvalidArgument},
+		{"duplicate offer", "/v1/admin/offers", offer, http.StatusConflict, api.CodeConflict},
+		{"specs for unknown product", "/v1/admin/specs", gin.H{"productId": 42, "specs": gin.H{}}, http.StatusUnprocessableEntity, api.CodeInvalidArgument},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(r, http.MethodPost, tc.path, tc.body, auth)
+			if w.Code != tc.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tc.want, w.Body.String())
+			}
+			env := decode[api.Envelope](t, w)
+			if env.Error == nil || env.Error.Code != tc.code {
+				t.Fatalf("error = %+v, want code %s", env.Error, tc.code)
+			}
+		})
+	}
+}
+
+func TestLoginWithStoredAdmin(t *testing.T) {
+	mem := memory.New()
+	hash, err := handlers.HashAdminPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.UpsertAdmin(context.Background(), "Ops@Example.com", hash); err != nil {
+		t.Fatal(err)
+	}
+	// No bootstrap login configured.
+	auth := testAuth
+	auth.AdminEmail, auth.AdminPassword = "", ""
+	r := newRouterWithAuth(mem, auth)
+
+	cases := []struct {
+		email, password string
+		want            int
+	}{
+		{"ops@example.com", "correct horse battery", http.StatusOK},
+		{"ops@example.com", "wrong password!!", http.StatusUnauthorized},
+		// An unset bootstrap login must not accept empty credentials.
+		{"", "", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		w := do(r, http.MethodPost, "/auth/login", gin.H{"email": tc.email, "password": tc.password}, nil)
+		if w.Code != tc.want {
+			t.Errorf("login %q: status %d, want %d", tc.email, w.Code, tc.want)
+		}
+	}
+
+	if _, err := handlers.HashAdminPassword("short"); err == nil {
+		t.Error("short password accepted")
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	lockout := ratelimit.NewLockout(ratelimit.NewMemory(func() time.Time { return now }), 3, 15*time.Minute)
+	r := gin.New()
+	r.POST("/auth/login", handlers.Login(memory.New().Stores().Admins, testAuth, lockout))
+
+	login := func(email, password string) *httptest.ResponseRecorder {
+		return do(r, http.MethodPost, "/auth/login", gin.H{"email": email, "password": password}, nil)
+	}
+	for i := range 3 {
+		if w := login("admin@example.com", "nope"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status %d, want 401", i+1, w.Code)
+		}
+	}
+	// Locked: even the right password is refused, whatever the case.
+	w := login("ADMIN@example.com", "hunter2")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "900" {
+		t.Fatalf("locked: status %d Retry-After %q, want 429 and 900", w.Code, w.Header().Get("Retry-After"))
+	}
+	// Only for the client that failed: the admin can still log in from
+	// another address.
+	other := http.Header{"X-Forwarded-For": {"198.51.100.7"}}
+	if w := do(r, http.MethodPost, "/auth/login", gin.H{"email": "admin@example.com", "password": "hunter2"}, other); w.Code != http.StatusOK {
+		t.Fatalf("other client: status %d, want 200", w.Code)
+	}
+
+	now = now.Add(15 * time.Minute)
+	if w := login("admin@example.com", "hunter2"); w.Code != http.StatusOK {
+		t.Fatalf("after lockout: status %d, want 200", w.Code)
+	}
+	// Success resets the count.
+	for range 2 {
+		login("admin@example.com", "nope")
+	}
+	if w := login("admin@example.com", "hunter2"); w.Code != http.StatusOK {
+		t.Fatalf("after reset: status %d, want 200", w.Code)
+	}
+}
+
+func TestTrackClickFiltersBotsAndDuplicates(t *testing.T) {
+	mem := memory.New()
+	seed(t, mem)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	mem.Now = func() time.Time { return now }
+	r := newRouter(mem)
+
+	const browser = "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"
+	click := func(session, ua string, productID int) bool {
+		t.Helper()
+		body := gin.H{"productId": productID, "storeName": "Amazon", "url": "https://a.example/pixel", "sessionId": session}
+		w := do(r, http.MethodPost, "/track/click", body, http.Header{"User-Agent": {ua}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("click: status %d: %s", w.Code, w.Body.String())
+		}
+		return decode[struct {
+			Counted bool `json:"counted"`
+		}](t, w).Counted
+	}
+
+	if !click("s1", browser, 1) {
+		t.Error("first click not counted")
+	}
+	if click("s1", browser, 1) {
+		t.Error("reload within the window counted")
+	}
+	if !click("s2", browser, 1) || !click("s1", browser, 2) {
+		t.Error("another session or product was deduplicated")
+	}
+	for _, ua := range []string{"Googlebot/2.1 (+http://www.google.com/bot.html)", "curl/8.5.0", ""} {
+		if click("s3", ua, 1) {
+			t.Errorf("bot %q counted", ua)
+		}
+	}
+	now = now.Add(31 * time.Minute)
+	if !click("s1", browser, 1) {
+		t.Error("click after the window not counted")
+	}
+
+	sum := decode[struct {
+		Trending []store.TrendingProduct `json:"trendingProducts"`
+		Counts   store.ClickCounts       `json:"clickCounts"`
+	}](t, do(r, http.MethodGet, "/admin/analytics/summary", nil, adminAuth(t, r)))
+	if want := (store.ClickCounts{Raw: 8, Bots: 3, Duplicates: 1, Counted: 4}); sum.Counts != want {
+		t.Errorf("clickCounts = %+v, want %+v", sum.Counts, want)
+	}
+	if len(sum.Trending) == 0 || sum.Trending[0].ID != 1 || sum.Trending[0].Clicks != 3 {
+		t.Errorf("trending = %+v, want product 1 with 3 counted clicks", sum.Trending)
+	}
+}
+
+func TestGoRedirect(t *testing.T) {
+	mem := memory.New()
+	seed(t, mem)
+	mem.SetAffiliateParams("Amazon", map[string]string{"tag": "comparehub-20"})
+	r := newRouter(mem)
+	browser := http.Header{"User-Agent": {"Mozilla/5.0 Firefox/128.0"}}
+
+	// Offers link to /go/ instead of the store.
+	p := decode[handlers.ProductDetail](t, do(r, http.MethodGet, "/products/1", nil, nil))
+	if len(p.Offers) != 2 || p.Offers[0].Link != "/go/2" || p.Offers[1].Link != "/go/1" {
+		t.Fatalf("offer links = %+v, want /go/2 (Best Buy) and /go/1 (Amazon)", p.Offers)
+	}
+	rows := decode[[]store.ProductRow](t, do(r, http.MethodGet, "/products?q=pixel", nil, nil))
+	if len(rows) != 1 || rows[0].BestLink != "/go/2" {
+		t.Fatalf("listing best link = %+v, want /go/2", rows)
+	}
+
+	w := do(r, http.MethodGet, "/go/1?s=search-1&sid=tab-1", nil, browser)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://a.example/pixel?tag=comparehub-20" {
+		t.Fatalf("status %d Location %q, want 302 to the tagged Amazon URL", w.Code, w.Header().Get("Location"))
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", cc)
+	}
+	// Stores without affiliate params get the URL unchanged.
+	if w := do(r, http.MethodGet, "/go/2", nil, browser); w.Header().Get("Location") != "https://b.example/pixel" {
+		t.Errorf("Best Buy Location = %q", w.Header().Get("Location"))
+	}
+	for path, want := range map[string]int{"/go/99": http.StatusNotFound, "/go/abc": http.StatusBadRequest} {
+		if w := do(r, http.MethodGet, path, nil, browser); w.Code != want {
+			t.Errorf("%s: status %d, want %d", path, w.Code, want)
+		}
+	}
+
+	sum := decode[struct {
+		Stores []store.StoreClicks `json:"storeClicks"`
+		Counts store.ClickCounts   `json:"clickCounts"`
+	}](t, do(r, http.MethodGet, "/admin/analytics/summary", nil, adminAuth(t, r)))
+	if sum.Counts.Counted != 2 || len(sum.Stores) != 2 {
+		t.Errorf("summary = %+v, want the two redirects counted for two stores", sum)
+	}
+
+	// The summary's old path is an alias, admin only like the new one.
+	for _, path := range []string{"/analytics/summary", "/v1/analytics/summary"} {
+		if w := do(r, http.MethodGet, path, nil, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s without a token: status %d, want 401", path, w.Code)
+		}
+	}
+	legacy := decode[struct {
+		Counts store.ClickCounts `json:"clickCounts"`
+	}](t, do(r, http.MethodGet, "/analytics/summary", nil, adminAuth(t, r)))
+	if legacy.Counts != sum.Counts {
+		t.Errorf("legacy summary clickCounts = %+v, want %+v", legacy.Counts, sum.Counts)
+	}
+}
+
+func TestClickAnalytics(t *testing.T) {
+	mem := memory.New()
+	seed(t, mem)
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	mem.Now = func() time.Time { return now }
+	r := newRouter(mem)
+	browser := http.Header{"User-Agent": {"Mozilla/5.0 Firefox/128.0"}}
+	auth := adminAuth(t, r)
+
+	if w := do(r, http.MethodGet, "/admin/analytics/clicks", nil, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: status %d, want 401", w.Code)
+	}
+
+	type report struct {
+		Totals store.ClickTotals  `json:"totals"`
+		Series []store.ClickPoint `json:"series"`
+		Groups []store.ClickGroup `json:"groups"`
+	}
+	get := func(query string) report {
+		t.Helper()
+		w := do(r, http.MethodGet, "/admin/analytics/clicks?from=2026-03-02&to=2026-03-04"+query, nil, auth)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		return decode[report](t, w)
+	}
+
+	view := func(path, session string) {
+		do(r, http.MethodGet, path, nil, http.Header{"User-Agent": browser["User-Agent"], "X-Session-ID": {session}})
+	}
+	view("/products/1", "s1")
+	view("/products/1", "s2")
+	view("/products/2", "s1")
+	do(r, http.MethodGet, "/products/1", nil, http.Header{"User-Agent": {"Googlebot/2.1"}})
+	r.flush()
+
+	click := func(productID int, storeName, session string) {
+		t.Helper()
+		body := gin.H{"productId": productID, "storeName": storeName, "sessionId": session}
+		if w := do(r, http.MethodPost, "/track/click", body, browser); w.Code != http.StatusOK {
+			t.Fatalf("click: status %d", w.Code)
+		}
+	}
+	click(1, "Amazon", "s1")
+	click(2, "Walmart", "s2")
+	now = now.Add(24 * time.Hour)
+	click(1, "Best Buy", "s3")
+
+	rep := get("&groupBy=product")
+	if rep.Totals.Views != 3 || rep.Totals.Clicks != 3 || rep.Totals.CTR == nil || *rep.Totals.CTR != 1 {
+		t.Fatalf("totals = %+v", rep.Totals)
+	}
+	if len(rep.Series) != 2 || rep.Series[0].Views != 3 || rep.Series[0].Clicks != 2 ||
+		rep.Series[1].Clicks != 1 || rep.Series[1].CTR != nil {
+		t.Errorf("series = %+v", rep.Series)
+	}
+	if len(rep.Groups) != 2 || rep.Groups[0].Label != "Pixel 8" || rep.Groups[0].Totals.Views != 2 || rep.Groups[0].Totals.Clicks != 2 {
+		t.Errorf("groups = %+v", rep.Groups)
+	}
+
+	// The memory store reads the events themselves, so it is never behind.
+	v1 := decode[struct {
+		Meta struct {
+			AsOf string `json:"asOf"`
+		} `json:"meta"`
+	}](t, do(r, http.MethodGet, "/v1/admin/analytics/clicks", nil, auth))
+	if want := now.Format(time.RFC3339); v1.Meta.AsOf != want {
+		t.Errorf("meta.asOf = %q, want %q", v1.Meta.AsOf, want)
+	}
+
+	rep = get("&groupBy=store&granularity=week")
+	if len(rep.Series) != 1 || len(rep.Groups) != 3 || rep.Groups[0].Totals.Views != 0 || rep.Groups[0].Totals.CTR != nil {
+		t.Errorf("store report = %+v", rep)
+	}
+
+	for _, q := range []string{
+		"/admin/analytics/clicks?granularity=month",
+		"/admin/analytics/clicks?groupBy=color",
+		"/admin/analytics/clicks?from=2026-03-04&to=2026-03-02",
+		"/admin/analytics/clicks?from=2026-01-01&to=2026-03-01&granularity=hour",
+	} {
+		if w := do(r, http.MethodGet, q, nil, auth); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, w.Code)
+		}
+	}
+
+	// Hourly rollups only reach back to the retention cutoff (90 days by
+	// default); daily ones are kept.
+	status := func(from time.Time, granularity string) int {
+		q := "/admin/analytics/clicks?granularity=" + granularity +
+			"&from=" + from.Format(time.DateOnly) + "&to=" + from.AddDate(0, 0, 2).Format(time.DateOnly)
+		return do(r, http.MethodGet, q, nil, auth).Code
+	}
+	today := time.Now().UTC()
+	if code := status(today.AddDate(0, 0, -100), "hour"); code != http.StatusBadRequest {
+		t.Errorf("hourly past retention: status %d, want 400", code)
+	}
+	if code := status(today.AddDate(0, 0, -100), "day"); code != http.StatusOK {
+		t.Errorf("daily past retention: status %d, want 200", code)
+	}
+	if code := status(today.AddDate(0, 0, -3), "hour"); code != http.StatusOK {
+		t.Errorf("hourly within retention: status %d, want 200", code)
+	}
+}
+
+func TestAnalyticsExport(t *testing.T) {
+	mem := memory.New()
+	seed(t, mem)
+	now := time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC)
+	mem.Now = func() time.Time { return now }
+	r := newRouter(mem)
+	ctx := context.Background()
+
+	mustClick := func(ev store.ClickEvent) {
+		t.Helper()
+		if _, err := mem.RecordClick(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustClick(store.ClickEvent{ProductID: 1, StoreName: "Amazon", SessionID: "s1", VisitorKey: "s1", DedupeWindow: time.Minute})
+	mustClick(store.ClickEvent{ProductID: 1, StoreName: "Amazon", SessionID: "s1", VisitorKey: "s1", DedupeWindow: time.Minute})
+	now = now.Add(time.Hour)
+	mustClick(store.ClickEvent{ProductID: 2, StoreName: "Walmart", Bot: true})
+	if err := mem.RecordSearch(ctx, store.SearchEvent{Key: "k1", Query: "=HYPERLINK(\"x\")", ResultCount: 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	login := decode[struct {
+		Token string `json:"token"`
+	}](t, do(r, http.MethodPost, "/auth/login", gin.H{"email": "admin@example.com", "password": "hunter2"}, nil))
+	auth := http.Header{"Authorization": {"Bearer " + login.Token}}
+	const rng = "&from=2026-03-02&to=2026-03-03"
+
+	if w := do(r, http.MethodGet, "/admin/analytics/export?dataset=clicks"+rng, nil, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: status %d, want 401", w.Code)
+	}
+
+	w := do(r, http.MethodGet, "/v1/admin/analytics/export?dataset=clicks"+rng, nil, auth)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("csv: status %d, type %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="comparehub-clicks-20260302-20260303.csv"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	want := "id,created_at,product_id,product,store_id,store,offer_id,search_key,session_id,referrer,bot,duplicate\n" +
+		"1,2026-03-02T10:30:00Z,1,Pixel 8,1,Amazon,,,s1,,false,false\n" +
+		"2,2026-03-02T10:30:00Z,1,Pixel 8,1,Amazon,,,s1,,false,true\n" +
+		"3,2026-03-02T11:30:00Z,2,iPhone 15,3,Walmart,,,,,true,false\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("csv =\n%s\nwant\n%s", got, want)
+	}
+
+	// Formulas typed into the search box must not run in a spreadsheet.
+	w = do(r, http.MethodGet, "/admin/analytics/export?dataset=searches"+rng, nil, auth)
+	if !strings.Contains(w.Body.String(), `"'=HYPERLINK(""x"")"`) {
+		t.Errorf("searches csv = %s", w.Body.String())
+	}
+
+	w = do(r, http.MethodGet, "/admin/analytics/export?dataset=event-rollups&granularity=hour&format=ndjson"+rng, nil, auth)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("ndjson: status %d: %s", w.Code, w.Body.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"bucket":"2026-03-02T10:00:00Z","product_id":1,`) {
+		t.Fatalf("ndjson = %s", w.Body.String())
+	}
+	var row map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &row); err != nil {
+		t.Fatal(err)
+	}
+	if row["clicks"] != 1.0 || row["click_duplicates"] != 1.0 || row["store"] != "Amazon" {
+		t.Errorf("rollup row = %v", row)
+	}
+
+	// An empty range still gets the header row.
+	w = do(r, http.MethodGet, "/admin/analytics/export?dataset=views"+rng, nil, auth)
+	if w.Code != http.StatusOK || w.Body.String() != "id,created_at,product_id,product,session_id,referrer,bot,duplicate\n" {
+		t.Errorf("empty export: status %d: %q", w.Code, w.Body.String())
+	}
+
+	for _, q := range []string{
+		"?dataset=orders",
+		"?dataset=clicks&format=xlsx",
+		"?dataset=event-rollups&granularity=week",
+		"?dataset=clicks&from=2026-03-03&to=2026-03-02",
+	} {
+		if w := do(r, http.MethodGet, "/admin/analytics/export"+q, nil, auth); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, w.Code)
+		}
+	}
+}
+
+func TestAlsoViewed(t *testing.T) {
+	mem := memory.New()
+	seed(t, mem)
+	r := newRouter(mem)
+
+	// View the products in order, waiting for each insert so the co-view
+	// pairing sees the earlier ones.
+	view := func(productID int, session string) {
+		t.Helper()
+		h := http.Header{"User-Agent": {"Mozilla/5.0 Firefox/128.0"}, "X-Session-ID": {session}}
+		if w := do(r, http.MethodGet, fmt.Sprintf("/products/%d", productID), nil, h); w.Code != http.StatusOK {
+			t.Fatalf("view: status %d", w.Code)
+		}
+		r.flush()
+	}
+	view(1, "a")
+	view(2, "a")
+	view(1, "a") // reload: a duplicate, pairs nothing
+	view(3, "a")
+	view(1, "b")
+	view(3, "b")
+	view(4, "c")
+
+	rows := decode[[]handlers.AlsoViewedProduct](t, do(r, http.MethodGet, "/products/1/also-viewed", nil, nil))
+	if len(rows) != 2 || rows[0].ID != 3 || rows[0].Visitors != 2 || rows[1].ID != 2 || rows[1].Visitors != 1 {
+		t.Fatalf("also viewed = %+v", rows)
+	}
+	if rows[0].BestPrice == nil || *rows[0].BestPrice != 699 || *rows[0].BestLink != "/go/5" {
+		t.Errorf("best offer = %v %v", rows[0].BestPrice, rows[0].BestLink)
+	}
+	if rows := decode[[]handlers.AlsoViewedProduct](t, do(r, http.MethodGet, "/products/4/also-viewed", nil, nil)); len(rows) != 0 {
+		t.Errorf("product 4 also viewed = %+v", rows)
+	}
+	if w := do(r, http.MethodGet, "/products/99/also-viewed", nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown product: status %d", w.Code)
+	}
+
+	sum := decode[struct {
+		MostViewed []store.ViewedProduct `json:"mostViewed"`
+		Counts     store.ViewCounts      `json:"viewCounts"`
+	}](t, do(r, http.MethodGet, "/admin/analytics/summary", nil, adminAuth(t, r)))
+	if want := (store.ViewCounts{Raw: 7, Duplicates: 1, Counted: 6}); sum.Counts != want {
+		t.Errorf("viewCounts = %+v, want %+v", sum.Counts, want)
+	}
+	if len(sum.MostViewed) != 4 || sum.MostViewed[0].ID != 1 || sum.MostViewed[0].Views != 2 {
+		t.Errorf("mostViewed = %+v", sum.MostViewed)
+	}
+}
+
+func TestEventQueue(t *testing.T) {
+	q := handlers.NewEventQueue(1, 1)
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	var ran atomic.Int32
+	run := func(context.Context) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		ran.Add(1)
+	}
+	ctx := context.Background()
+
+	// The worker blocks on the first event and the second fills the
+	// queue, so the third is dropped.
+	q.Enqueue(ctx, "test", run)
+	<-started
+	if !q.Enqueue(ctx, "test", run) {
+		t.Fatal("queue refused an event with room for it")
+	}
+	if q.Enqueue(ctx, "test", run) {
+		t.Fatal("full queue accepted an event")
+	}
+	close(release)
+	q.Flush()
+	if n := ran.Load(); n != 2 {
+		t.Fatalf("ran %d events, want 2", n)
+	}
+
+	// Close records what is queued and refuses the rest.
+	q.Enqueue(ctx, "test", run)
+	if err := q.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := ran.Load(); n != 3 {
+		t.Fatalf("ran %d events after Close, want 3", n)
+	}
+	if q.Enqueue(ctx, "test", run) {
+		t.Error("closed queue accepted an event")
+	}
+}
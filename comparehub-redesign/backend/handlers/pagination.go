@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/store"
+)
+
+const (
+	defaultPageSize = 24
+	maxPageSize     = 100
+)
+
+// ProductPage is the paginated /products response (API version 2).
+// Version 1 clients keep receiving the bare []store.ProductRow.
+type ProductPage struct {
+	Items      []store.ProductRow `json:"items"`
+	NextCursor string             `json:"nextCursor,omitempty"`
+	HasMore    bool               `json:"hasMore"`
+	Total      *int64             `json:"total,omitempty"`
+}
+
+// productCursor marks the last row of a page: the sort it was produced
+// under, that row's sort key and its id (the tie-breaker).
+type productCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   int    `json:"id"`
+}
+
+var errBadCursor = errors.New("invalid cursor")
+
+func encodeCursor(cur productCursor) string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(raw, sort string) (*productCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	var cur productCursor
+	if err := json.Unmarshal(b, &cur); err != nil || cur.ID <= 0 {
+		return nil, errBadCursor
+	}
+	// A cursor is only meaningful for the ordering that produced it.
+	if cur.Sort != sort {
+		return nil, errBadCursor
+	}
+	if _, err := strconv.ParseFloat(cur.Key, 64); err != nil {
+		return nil, errBadCursor
+	}
+	return &cur, nil
+}
+
+// parsePageSize reads ?limit=, falling back to the default and capping at
+// maxPageSize.
+func parsePageSize(raw string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || n < 1 {
+		return defaultPageSize
+	}
+	if n > maxPageSize {
+		return maxPageSize
+	}
+	return n
+}
+
+// wantsPagedEnvelope reports whether the client opted into the paginated
+// response shape with "X-API-Version: 2".
+func wantsPagedEnvelope(c *gin.Context) bool {
+	v, err := strconv.Atoi(strings.TrimSpace(c.GetHeader("X-API-Version")))
+	return err == nil && v >= 2
+}
@@ -1,36 +1,39 @@
 package handlers
 
 import (
-	"database/sql"
-	"encoding/json"
+	"context"
+	"errors"
+	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lib/pq"
-)
-
-type ProductRow struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	Brand       string `json:"brand"`
-	Category    string `json:"category"`
-	Description string `json:"description"`
-	ImageURL    string `json:"imageUrl"`
-
-	BestPrice  float64 `json:"bestPrice"`
-	BestSource string  `json:"bestSource"`
-	BestRating float64 `json:"bestRating"`
-	BestURL    string  `json:"bestUrl"`
 
-	ReviewCount *int64 `json:"reviewCount,omitempty"`
-}
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/config"
+	"go-ecommerce-backend/store"
+)
 
 type OfferRow struct {
 	Store  string   `json:"source"` // React expects o.source
 	Price  float64  `json:"price"`
 	Rating *float64 `json:"rating"`
 	URL    string   `json:"url"`
+	Link   string   `json:"link"` // see GoLink
+}
+
+// ProductDetail is the /products/:id response.
+type ProductDetail struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Brand       string     `json:"brand"`
+	Category    string     `json:"category"`
+	Description string     `json:"description"`
+	ImageURL    string     `json:"imageUrl"`
+	Offers      []OfferRow `json:"offers"`
+	Specs       any        `json:"specs,omitempty"`
+	LastUpdated *string    `json:"lastUpdated,omitempty"`
 }
 
 // Normalize store names (UI -> DB)
@@ -62,16 +65,71 @@ func normalizeStores(stores []string) []string {
 	return out
 }
 
-// If you already have this in another file, remove this duplicate.
+// offerFilterFromQuery reads ?condition= and ?stores=, defaulting the stores
+// to the three core retailers.
+func offerFilterFromQuery(c *gin.Context) store.OfferFilter {
+	stores := normalizeStores(parseStoresParam(c.Query("stores")))
+	if len(stores) == 0 {
+		stores = []string{"Amazon", "BestBuy", "Walmart"}
+	}
+	return store.OfferFilter{
+		Condition: parseConditionParam(c.Query("condition")),
+		Stores:    stores,
+	}
+}
 
-func ListProducts(conn *sql.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		condition := parseConditionParam(c.Query("condition"))
+func toOfferRows(offers []store.Offer) []OfferRow {
+	out := make([]OfferRow, 0, len(offers))
+	for _, o := range offers {
+		out = append(out, OfferRow{Store: o.Store, Price: o.Price, Rating: o.Rating, URL: o.URL, Link: GoLink(o.ID)})
+	}
+	return out
+}
 
-		stores := normalizeStores(parseStoresParam(c.Query("stores")))
-		if len(stores) == 0 {
-			stores = []string{"Amazon", "BestBuy", "Walmart"}
+// lastModified is the latest change among offers and specs. Offer times
+// are when a sync last confirmed the offer, never earlier than its real
+// change, so a cache using them revalidates too often rather than too
+// rarely; the ETag set by middleware.Conditional is the precise check.
+func lastModified(offers []store.Offer, specs map[int]store.Specs) time.Time {
+	var t time.Time
+	for _, o := range offers {
+		if o.LastSeenAt.After(t) {
+			t = o.LastSeenAt
+		}
+	}
+	for _, s := range specs {
+		if s.LastUpdated.After(t) {
+			t = s.LastUpdated
 		}
+	}
+	return t
+}
+
+// setLastModified sets the Last-Modified header unless t is unknown.
+func setLastModified(c *gin.Context, t time.Time) {
+	if !t.IsZero() {
+		c.Header("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseProductID reads the :id path parameter.
+func parseProductID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		api.Abort(c, api.InvalidArgument("invalid product id", gin.H{"param": "id"}))
+		return 0, false
+	}
+	return id, true
+}
+
+// GET /products
+// Legacy clients get a bare array and may page with ?page=N. Clients sending
+// "X-API-Version: 2" get a ProductPage and page with ?cursor= (keyset on the
+// sort key + product id); ?withTotal=true adds the total match count.
+func ListProducts(products store.ProductStore, analytics store.AnalyticsStore, events *EventQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		filter := offerFilterFromQuery(c)
 
 		q := c.Query("q")
 		category := c.DefaultQuery("category", "all")
@@ -82,13 +140,32 @@ func ListProducts(conn *sql.DB) gin.HandlerFunc {
 		minRatingStr := c.Query("minRating")
 		pageStr := c.DefaultQuery("page", "1")
 
+		paged := api.IsV1(c) || wantsPagedEnvelope(c)
+		if !api.IsV1(c) {
+			c.Writer.Header().Add("Vary", "X-API-Version") // the legacy body depends on it
+		}
+		limit := parsePageSize(c.Query("limit"))
+
 		page, _ := strconv.Atoi(pageStr)
 		if page < 1 {
 			page = 1
 		}
-		limit := 24
 		offset := (page - 1) * limit
 
+		var after *store.Keyset
+		if paged {
+			offset = 0
+			if raw := c.Query("cursor"); raw != "" {
+				cur, err := decodeCursor(raw, sort)
+				if err != nil {
+					api.Abort(c, api.InvalidArgument(err.Error(), gin.H{"param": "cursor"}))
+					return
+				}
+				key, _ := strconv.ParseFloat(cur.Key, 64)
+				after = &store.Keyset{Key: key, ID: cur.ID}
+			}
+		}
+
 		var minPrice *float64
 		var maxPrice *float64
 		var minRating *float64
@@ -109,204 +186,254 @@ func ListProducts(conn *sql.DB) gin.HandlerFunc {
 			}
 		}
 
-		order := "best_price ASC"
-		if sort == "high" {
-			order = "best_price DESC"
-		} else if sort == "rating" {
-			order = "best_rating DESC"
-		}
-
-		// ✅ FIX: COALESCE(o.condition,'New') so NULL condition rows still match
-		query := `
-			SELECT
-			  p.id, p.name, COALESCE(p.brand,''), COALESCE(p.category,''), COALESCE(p.description,''), COALESCE(p.image_url,''),
-			  COALESCE(bo.best_price, 0) AS best_price,
-			  COALESCE(bo.best_source, '') AS best_source,
-			  COALESCE(bo.best_rating, 0) AS best_rating,
-			  COALESCE(bo.best_url, '') AS best_url,
-			  (ps.specs_json->>'review_count')::bigint AS review_count
-			FROM products p
-			LEFT JOIN product_specs ps ON ps.product_id = p.id
-			LEFT JOIN LATERAL (
-			  SELECT
-			    o.price AS best_price,
-			    s.name  AS best_source,
-			    COALESCE(o.rating, 0) AS best_rating,
-			    o.url   AS best_url
-			  FROM offers o
-			  JOIN stores s ON s.id = o.store_id
-			  WHERE o.product_id = p.id
-			    AND o.active = true
-			    AND o.condition = $9
-			    AND s.name = ANY($10)
-			  ORDER BY o.price ASC
-			  LIMIT 1
-			) bo ON true
-			WHERE
-			  ($1 = '' OR LOWER(p.name) LIKE LOWER('%' || $1 || '%') OR LOWER(p.brand) LIKE LOWER('%' || $1 || '%'))
-			  AND ($2 = 'all' OR p.category = $2)
-			  AND ($3 = 'all' OR LOWER(p.brand) = LOWER($3))
-			  AND ($4::numeric IS NULL OR bo.best_price >= $4)
-			  AND ($5::numeric IS NULL OR bo.best_price <= $5)
-			  AND ($6::numeric IS NULL OR bo.best_rating >= $6)
-			ORDER BY ` + order + `
-			LIMIT $7 OFFSET $8;
-		`
-
-		rows, err := conn.Query(
-			query,
-			q, category, brand, minPrice, maxPrice, minRating, limit, offset,
-			condition, pq.Array(stores),
-		)
+		query := store.ProductQuery{
+			Search:    q,
+			Category:  category,
+			Brand:     brand,
+			MinPrice:  minPrice,
+			MaxPrice:  maxPrice,
+			MinRating: minRating,
+			Sort:      sort,
+			Offers:    filter,
+			// One extra row tells us whether another page exists.
+			Limit:  limit + 1,
+			Offset: offset,
+			After:  after,
+		}
+		out, err := products.ListProducts(c.Request.Context(), query)
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+			api.Abort(c, err)
 			return
 		}
-		defer rows.Close()
-
-		out := []ProductRow{}
-		for rows.Next() {
-			var r ProductRow
-			if err := rows.Scan(
-				&r.ID, &r.Name, &r.Brand, &r.Category, &r.Description, &r.ImageURL,
-				&r.BestPrice, &r.BestSource, &r.BestRating, &r.BestURL,
-				&r.ReviewCount,
-			); err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
+
+		hasMore := len(out) > limit
+		if hasMore {
+			out = out[:limit]
+		}
+		for i := range out {
+			if out[i].BestOfferID != 0 {
+				out[i].BestLink = GoLink(out[i].BestOfferID)
+			}
+		}
+
+		// A search is logged once, when its first page is fetched; browsing
+		// without a query, later pages and revalidations are not searches.
+		if strings.TrimSpace(q) != "" && after == nil && page == 1 && !isRevalidation(c) {
+			searchKey := newSearchKey()
+			ev := store.SearchEvent{
+				Key:      searchKey,
+				Query:    q,
+				Category: category,
+				Sort:     sort,
+				Filters: map[string]any{
+					"brand":     brand,
+					"minPrice":  minPrice,
+					"maxPrice":  maxPrice,
+					"minRating": minRating,
+					"condition": filter.Condition,
+					"stores":    filter.Stores,
+				},
+				ResultCount: len(out),
+				Latency:     time.Since(started),
+			}
+			// Past the first page the total takes a count, which the
+			// worker runs rather than the request.
+			var count func(context.Context) (int64, error)
+			if hasMore {
+				count = func(ctx context.Context) (int64, error) { return products.CountProducts(ctx, query) }
+			}
+			logSearchEvent(c.Request.Context(), events, analytics, ev, count)
+			c.Header("X-Search-ID", searchKey)
+		}
+
+		if !paged {
+			api.OK(c, 200, out, nil, out)
+			return
+		}
+
+		resp := ProductPage{Items: out, HasMore: hasMore}
+		if hasMore {
+			last := out[len(out)-1]
+			resp.NextCursor = encodeCursor(productCursor{
+				Sort: sort,
+				Key:  strconv.FormatFloat(store.SortValue(sort, last), 'f', -1, 64),
+				ID:   last.ID,
+			})
+		}
+
+		if c.Query("withTotal") == "true" {
+			total, err := products.CountProducts(c.Request.Context(), query)
+			if err != nil {
+				api.Abort(c, err)
 				return
 			}
-			out = append(out, r)
+			resp.Total = &total
 		}
 
-		c.JSON(200, out)
+		api.OK(c, 200, resp.Items, gin.H{
+			"nextCursor": resp.NextCursor,
+			"hasMore":    resp.HasMore,
+			"total":      resp.Total,
+			"limit":      limit,
+		}, resp)
 	}
 }
 
-func GetProduct(conn *sql.DB) gin.HandlerFunc {
+func GetProduct(products store.ProductStore, offers store.OfferStore, specs store.SpecStore, analytics store.AnalyticsStore, events *EventQueue, cfg config.Analytics) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		condition := parseConditionParam(c.Query("condition"))
-
-		stores := normalizeStores(parseStoresParam(c.Query("stores")))
-		if len(stores) == 0 {
-			stores = []string{"Amazon", "BestBuy", "Walmart"}
-		}
-
-		var p struct {
-			ID          int        `json:"id"`
-			Name        string     `json:"name"`
-			Brand       string     `json:"brand"`
-			Category    string     `json:"category"`
-			Description string     `json:"description"`
-			ImageURL    string     `json:"imageUrl"`
-			Offers      []OfferRow `json:"offers"`
-			Specs       any        `json:"specs,omitempty"`
-			LastUpdated *string    `json:"lastUpdated,omitempty"`
-		}
-
-		err := conn.QueryRow(`
-			SELECT id, name, COALESCE(brand,''), COALESCE(category,''), COALESCE(description,''), COALESCE(image_url,'')
-			FROM products
-			WHERE id = $1;
-		`, id).Scan(&p.ID, &p.Name, &p.Brand, &p.Category, &p.Description, &p.ImageURL)
-
-		if err == sql.ErrNoRows {
-			c.JSON(404, gin.H{"error": "product not found"})
+		id, ok := parseProductID(c)
+		if !ok {
+			return
+		}
+		filter := offerFilterFromQuery(c)
+		ctx := c.Request.Context()
+
+		prod, err := products.GetProduct(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			api.Abort(c, api.NotFound("product not found"))
 			return
 		}
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+			api.Abort(c, err)
 			return
 		}
 
-		rows, err := conn.Query(`
-			SELECT s.name, o.price, o.rating, o.url
-			FROM offers o
-			JOIN stores s ON s.id = o.store_id
-			WHERE o.product_id = $1
-			  AND o.active = true
-			  AND o.condition = $2
-			  AND s.name = ANY($3)
-			ORDER BY o.price ASC;
-		`, id, condition, pq.Array(stores))
+		p := ProductDetail{
+			ID: prod.ID, Name: prod.Name, Brand: prod.Brand, Category: prod.Category,
+			Description: prod.Description, ImageURL: prod.ImageURL,
+		}
+
+		list, err := offers.ListOffers(ctx, []int{id}, filter)
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+			api.Abort(c, err)
 			return
 		}
-		defer rows.Close()
+		p.Offers = toOfferRows(list)
 
-		offers := []OfferRow{}
-		for rows.Next() {
-			var o OfferRow
-			if err := rows.Scan(&o.Store, &o.Price, &o.Rating, &o.URL); err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			offers = append(offers, o)
-		}
-		p.Offers = offers
-
-		var raw json.RawMessage
-		var last sql.NullString
-		err = conn.QueryRow(`
-			SELECT specs_json, to_char(last_updated, 'YYYY-MM-DD')
-			FROM product_specs
-			WHERE product_id = $1;
-		`, id).Scan(&raw, &last)
-
-		if err == nil {
-			var m map[string]any
-			if e := json.Unmarshal(raw, &m); e == nil {
-				p.Specs = m
-			}
-			if last.Valid {
-				p.LastUpdated = &last.String
-			}
-		} else if err != sql.ErrNoRows {
-			c.JSON(500, gin.H{"error": err.Error()})
+		sp, err := specs.GetSpecs(ctx, []int{id})
+		if err != nil {
+			api.Abort(c, err)
 			return
 		}
+		if s, ok := sp[id]; ok {
+			if s.Data != nil {
+				p.Specs = s.Data
+			}
+			last := s.LastUpdated.Format("2006-01-02")
+			p.LastUpdated = &last
+		}
 
-		c.JSON(200, p)
+		logViewEvent(c, events, analytics, cfg, id)
+		setLastModified(c, lastModified(list, sp))
+		api.OK(c, 200, p, nil, p)
 	}
 }
 
-func GetOffers(conn *sql.DB) gin.HandlerFunc {
+func GetOffers(offers store.OfferStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		condition := parseConditionParam(c.Query("condition"))
-
-		stores := normalizeStores(parseStoresParam(c.Query("stores")))
-		if len(stores) == 0 {
-			stores = []string{"Amazon", "BestBuy", "Walmart"}
-		}
-
-		rows, err := conn.Query(`
-			SELECT s.name, o.price, o.rating, o.url
-			FROM offers o
-			JOIN stores s ON s.id = o.store_id
-			WHERE o.product_id = $1
-			  AND o.active = true
-			  AND o.condition = $2
-			  AND s.name = ANY($3)
-			ORDER BY o.price ASC;
-		`, id, condition, pq.Array(stores))
+		id, ok := parseProductID(c)
+		if !ok {
+			return
+		}
+		filter := offerFilterFromQuery(c)
+
+		list, err := offers.ListOffers(c.Request.Context(), []int{id}, filter)
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+			api.Abort(c, err)
 			return
 		}
-		defer rows.Close()
+		out := toOfferRows(list)
 
-		out := []OfferRow{}
-		for rows.Next() {
-			var o OfferRow
-			if err := rows.Scan(&o.Store, &o.Price, &o.Rating, &o.URL); err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
+		setLastModified(c, lastModified(list, nil))
+		api.OK(c, 200, out, gin.H{"condition": filter.Condition, "stores": filter.Stores}, gin.H{"offers": out})
+	}
+}
+
+// AlsoViewedProduct is a /products/:id/also-viewed row: a product viewed
+// by the same visitors, with its best offer under the request's filters.
+type AlsoViewedProduct struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Brand    string `json:"brand"`
+	Category string `json:"category"`
+	ImageURL string `json:"imageUrl"`
+	// Visitors viewed both products within a day.
+	Visitors   int64    `json:"visitors"`
+	BestPrice  *float64 `json:"bestPrice"`
+	BestSource *string  `json:"bestSource"`
+	BestLink   *string  `json:"bestLink"`
+}
+
+// GET /products/:id/also-viewed?limit=6
+// "People who viewed this also viewed", most shared visitors first.
+func AlsoViewed(products store.ProductStore, offers store.OfferStore, analytics store.AnalyticsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseProductID(c)
+		if !ok {
+			return
+		}
+		limit := 6
+		if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 {
+			limit = min(n, 24)
+		}
+		filter := offerFilterFromQuery(c)
+		ctx := c.Request.Context()
+
+		if _, err := products.GetProduct(ctx, id); errors.Is(err, store.ErrNotFound) {
+			api.Abort(c, api.NotFound("product not found"))
+			return
+		} else if err != nil {
+			api.Abort(c, err)
+			return
+		}
+
+		coviews, err := analytics.AlsoViewed(ctx, id, limit)
+		if err != nil {
+			api.Abort(c, err)
+			return
+		}
+		ids := make([]int, 0, len(coviews))
+		for _, cv := range coviews {
+			ids = append(ids, cv.ProductID)
+		}
+		rows, err := products.GetProducts(ctx, ids)
+		if err != nil {
+			api.Abort(c, err)
+			return
+		}
+		byID := map[int]store.Product{}
+		for _, p := range rows {
+			byID[p.ID] = p
+		}
+		list, err := offers.ListOffers(ctx, ids, filter)
+		if err != nil {
+			api.Abort(c, err)
+			return
+		}
+		// Offers come cheapest first per product.
+		best := map[int]store.Offer{}
+		for _, o := range list {
+			if _, ok := best[o.ProductID]; !ok {
+				best[o.ProductID] = o
 			}
-			out = append(out, o)
 		}
 
-		c.JSON(200, gin.H{"offers": out})
+		out := []AlsoViewedProduct{}
+		for _, cv := range coviews {
+			p, ok := byID[cv.ProductID]
+			if !ok {
+				continue
+			}
+			row := AlsoViewedProduct{
+				ID: p.ID, Name: p.Name, Brand: p.Brand, Category: p.Category, ImageURL: p.ImageURL,
+				Visitors: cv.Visitors,
+			}
+			if o, ok := best[p.ID]; ok {
+				link := GoLink(o.ID)
+				row.BestPrice, row.BestSource, row.BestLink = &o.Price, &o.Store, &link
+			}
+			out = append(out, row)
+		}
+		api.OK(c, 200, out, gin.H{"condition": filter.Condition, "stores": filter.Stores}, out)
 	}
 }
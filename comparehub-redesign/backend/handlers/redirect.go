@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/config"
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/store"
+)
+
+// GoLink is the outbound link of an offer, relative to the API base URL.
+// Responses carry it next to the raw store URL so every outbound click
+// goes through GoRedirect.
+func GoLink(offerID int64) string {
+	return "/go/" + strconv.FormatInt(offerID, 10)
+}
+
+// GET /go/:offerId?s=<searchId>&sid=<sessionId>
+// Records the click server-side, so ad blockers cannot drop it, and
+// redirects to the offer URL with the store's affiliate parameters. A
+// failure to record is logged; the shopper is redirected regardless.
+func GoRedirect(offers store.OfferStore, analytics store.AnalyticsStore, cfg config.Analytics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("offerId"), 10, 64)
+		if err != nil || id < 1 {
+			api.Fail(c, http.StatusBadRequest, api.CodeInvalidArgument, "invalid offer id", gin.H{"param": "offerId"})
+			return
+		}
+		ctx := c.Request.Context()
+		link, err := offers.GetOfferLink(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			api.Abort(c, api.NotFound("offer not found"))
+			return
+		}
+		if err != nil {
+			api.Abort(c, err)
+			return
+		}
+		target, err := affiliateURL(link.URL, link.AffiliateParams)
+		if err != nil {
+			logging.FromContext(ctx).Warn("offer has an unusable url", "offer", id, "err", err)
+			api.Abort(c, api.NotFound("offer has no valid link"))
+			return
+		}
+
+		_, _, err = recordClick(c, analytics, cfg, c.Query("sid"), store.ClickEvent{
+			ProductID: link.ProductID,
+			OfferID:   link.OfferID,
+			StoreID:   link.StoreID,
+			URL:       link.URL,
+			SearchKey: c.Query("s"),
+		})
+		if err != nil {
+			logging.FromContext(ctx).Warn("recording outbound click failed", "offer", id, "err", err)
+		}
+
+		// Every click must reach the server, and crawlers should not index
+		// the redirect.
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Robots-Tag", "noindex, nofollow")
+		c.Redirect(http.StatusFound, target)
+	}
+}
+
+// affiliateURL adds params to raw, replacing parameters of the same name.
+// Only absolute http(s) URLs are accepted, so a bad offer row cannot turn
+// the redirect into a javascript: or relative link.
+func affiliateURL(raw string, params map[string]string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("not an absolute http(s) url")
+	}
+	if len(params) > 0 {
+		q := u.Query()
+		for k, v := range params {
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/metrics"
+	"go-ecommerce-backend/store"
+)
+
+// newSearchKey returns a random id for a search. It is sent back to the
+// client as X-Search-ID so a later click can be attributed to the search.
+func newSearchKey() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// logSearchEvent stores the event in the background so the listing response
+// never waits on the analytics insert. A non-nil count replaces
+// ev.ResultCount (the page length) with the total number of matches.
+func logSearchEvent(ctx context.Context, events *EventQueue, analytics store.AnalyticsStore, ev store.SearchEvent, count func(context.Context) (int64, error)) {
+	events.Enqueue(ctx, "search", func(ctx context.Context) {
+		if count != nil {
+			n, err := count(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Error("search result count failed", "search_id", ev.Key, "err", err)
+				return
+			}
+			ev.ResultCount = int(n)
+		}
+		if err := analytics.RecordSearch(ctx, ev); err != nil {
+			logging.FromContext(ctx).Error("search event insert failed", "search_id", ev.Key, "err", err)
+			return
+		}
+		metrics.Event("search")
+	})
+}
+
+// isRevalidation reports whether c is a conditional request: the client
+// is checking a response it already has (and whose search was logged).
+func isRevalidation(c *gin.Context) bool {
+	return c.GetHeader("If-None-Match") != "" || c.GetHeader("If-Modified-Since") != ""
+}
+
+// GET /admin/analytics/searches?days=7
+// Zero-result queries, queries that never led to a click, and
+// search-to-click conversion per query over the days whole UTC days before
+// today and today so far, as of meta.asOf.
+func SearchAnalytics(analytics store.AnalyticsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
+		if days < 1 {
+			days = 7
+		}
+		if days > 90 {
+			days = 90
+		}
+
+		rep, err := analytics.SearchReport(c.Request.Context(), days)
+		if err != nil {
+			api.Abort(c, err)
+			return
+		}
+
+		noClicks := []store.QueryConversion{}
+		for _, q := range rep.Conversion {
+			if q.Clicks == 0 {
+				noClicks = append(noClicks, q)
+			}
+		}
+
+		report := gin.H{
+			"zeroResults": rep.ZeroResults,
+			"noClicks":    noClicks,
+			"conversion":  rep.Conversion,
+		}
+		api.OK(c, http.StatusOK, report, gin.H{"days": days, "asOf": asOf(rep.AsOf)}, gin.H{
+			"days":        days,
+			"asOf":        asOf(rep.AsOf),
+			"zeroResults": rep.ZeroResults,
+			"noClicks":    noClicks,
+			"conversion":  rep.Conversion,
+		})
+	}
+}
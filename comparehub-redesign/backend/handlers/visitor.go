@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// botUserAgents are lower-case fragments of user agents that are not
+// shoppers: crawlers, link previews, monitors and HTTP libraries.
+var botUserAgents = []string{
+	"bot", "crawl", "spider", "slurp", "mediapartners", "facebookexternalhit",
+	"embedly", "preview", "headless", "lighthouse", "pingdom", "uptime",
+	"monitor", "curl/", "wget/", "python-requests", "python-urllib",
+	"go-http-client", "java/", "axios/", "node-fetch", "libwww",
+	"httpclient", "scrapy", "phantomjs", "postman",
+}
+
+// isBot reports whether ua looks automated; an empty user agent does.
+func isBot(ua string) bool {
+	ua = strings.ToLower(strings.TrimSpace(ua))
+	if ua == "" {
+		return true
+	}
+	for _, b := range botUserAgents {
+		if strings.Contains(ua, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// visitor is who triggered an event, anonymized before it is stored.
+type visitor struct {
+	SessionID string // hash of the client's session id, empty without one
+	Key       string // SessionID, or a hash of IP and user agent
+	IPHash    string
+	UserAgent string
+	Referrer  string // scheme, host and path only
+	Bot       bool
+}
+
+// newVisitor describes the client of c. sessionID is the random id the
+// frontend keeps per browser session (X-Session-ID when empty); hashKey
+// keys the hashes. They do not change at midnight, so deduplication and
+// co-views work across it; analytics.retention bounds how long the raw
+// events holding them are kept.
+func newVisitor(c *gin.Context, hashKey, sessionID string) visitor {
+	if sessionID = strings.TrimSpace(sessionID); sessionID == "" {
+		sessionID = strings.TrimSpace(c.GetHeader("X-Session-ID"))
+	}
+	ua := truncate(strings.TrimSpace(c.Request.UserAgent()), 512)
+	hash := func(kind, v string) string {
+		m := hmac.New(sha256.New, []byte(hashKey))
+		m.Write([]byte(kind + "\x00" + v))
+		return hex.EncodeToString(m.Sum(nil)[:16])
+	}
+
+	v := visitor{
+		IPHash:    hash("ip", c.ClientIP()),
+		UserAgent: ua,
+		Referrer:  referrer(c.Request.Referer()),
+		Bot:       isBot(ua),
+	}
+	if sessionID != "" {
+		v.SessionID = hash("session", truncate(sessionID, 128))
+		v.Key = v.SessionID
+	} else {
+		v.Key = hash("visitor", c.ClientIP()+"\x00"+ua)
+	}
+	return v
+}
+
+// referrer strips the query and fragment, which can carry personal data.
+func referrer(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return truncate(u.Scheme+"://"+u.Host+u.EscapedPath(), 512)
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		s = strings.ToValidUTF8(s[:n], "")
+	}
+	return s
+}
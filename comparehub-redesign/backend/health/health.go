@@ -0,0 +1,216 @@
+// Package health serves the liveness (/livez) and readiness (/readyz)
+// probes.
+//
+// Liveness only says the process is up and which build it is. Readiness
+// checks what a request needs: the database answers within a timeout and
+// every migration is applied. A feed source whose last successful sync is
+// older than StaleAfter makes the instance "degraded" but still ready, since
+// stale prices are better than no answer.
+package health
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version and Commit are set at build time:
+//
+//	go build -ldflags "-X go-ecommerce-backend/health.Version=1.4.0 -X go-ecommerce-backend/health.Commit=$(git rev-parse HEAD)"
+//
+// Without -ldflags, Commit falls back to the VCS revision Go embeds.
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+const (
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+	statusSkipped     = "skipped"
+)
+
+// BuildInfo identifies the running binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Build reports Version, Commit and the Go toolchain.
+func Build() BuildInfo {
+	b := BuildInfo{Version: Version, Commit: Commit}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		b.GoVersion = info.GoVersion
+		if b.Commit == "" {
+			for _, s := range info.Settings {
+				if s.Key == "vcs.revision" {
+					b.Commit = s.Value
+				}
+			}
+		}
+	}
+	return b
+}
+
+// Check is the outcome of one readiness check.
+type Check struct {
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+	Details    any     `json:"details,omitempty"`
+}
+
+// SourceStatus is the sync freshness of one feed source.
+type SourceStatus struct {
+	Source      string    `json:"source"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	AgeSeconds  int64     `json:"ageSeconds"`
+	Stale       bool      `json:"stale"`
+}
+
+// Report is the /readyz body.
+type Report struct {
+	Status string           `json:"status"`
+	Build  BuildInfo        `json:"build"`
+	Checks map[string]Check `json:"checks"`
+}
+
+// Pinger is satisfied by *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Checker runs the readiness checks. Pending and LastSync are usually
+// migrate.Migrator.Pending and syncer.LastSuccess bound to the pool.
+type Checker struct {
+	DB       Pinger
+	Pending  func(ctx context.Context) (int, error)
+	LastSync func(ctx context.Context) (map[string]time.Time, error)
+
+	// Timeout bounds each check.
+	Timeout    time.Duration
+	StaleAfter time.Duration
+	// ExpectSync means the sync worker is enabled, so having no successful
+	// sync at all is reported as degraded too.
+	ExpectSync bool
+
+	Now func() time.Time // defaults to time.Now
+}
+
+func (h *Checker) now() time.Time {
+	if h.Now != nil {
+		return h.Now()
+	}
+	return time.Now()
+}
+
+// run times fn under the check timeout.
+func (h *Checker) run(ctx context.Context, fn func(ctx context.Context) Check) Check {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+	start := time.Now()
+	c := fn(ctx)
+	c.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	return c
+}
+
+// Ready runs every check. Later checks are skipped when the database is
+// unreachable, since they would only time out too.
+func (h *Checker) Ready(ctx context.Context) Report {
+	rep := Report{Status: StatusOK, Build: Build(), Checks: map[string]Check{}}
+
+	db := h.run(ctx, func(ctx context.Context) Check {
+		if err := h.DB.PingContext(ctx); err != nil {
+			return Check{Status: StatusUnavailable, Error: err.Error()}
+		}
+		return Check{Status: StatusOK}
+	})
+	rep.Checks["database"] = db
+	if db.Status != StatusOK {
+		rep.Status = StatusUnavailable
+		rep.Checks["migrations"] = Check{Status: statusSkipped}
+		rep.Checks["sync"] = Check{Status: statusSkipped}
+		return rep
+	}
+
+	mig := h.run(ctx, func(ctx context.Context) Check {
+		n, err := h.Pending(ctx)
+		switch {
+		case err != nil:
+			return Check{Status: StatusUnavailable, Error: err.Error()}
+		case n > 0:
+			return Check{Status: StatusUnavailable, Details: gin.H{"pending": n}}
+		}
+		return Check{Status: StatusOK, Details: gin.H{"pending": 0}}
+	})
+	rep.Checks["migrations"] = mig
+	if mig.Status != StatusOK {
+		rep.Status = StatusUnavailable
+	}
+
+	sync := h.run(ctx, h.checkSync)
+	rep.Checks["sync"] = sync
+	if sync.Status != StatusOK && rep.Status == StatusOK {
+		rep.Status = StatusDegraded
+	}
+	return rep
+}
+
+func (h *Checker) checkSync(ctx context.Context) Check {
+	last, err := h.LastSync(ctx)
+	if err != nil {
+		return Check{Status: StatusDegraded, Error: err.Error()}
+	}
+	now := h.now()
+	sources := make([]SourceStatus, 0, len(last))
+	status := StatusOK
+	for source, at := range last {
+		age := now.Sub(at)
+		s := SourceStatus{Source: source, LastSuccess: at, AgeSeconds: int64(age.Seconds()), Stale: age > h.StaleAfter}
+		if s.Stale {
+			status = StatusDegraded
+		}
+		sources = append(sources, s)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Source < sources[j].Source })
+
+	c := Check{Status: status, Details: gin.H{"sources": sources, "staleAfterSeconds": int64(h.StaleAfter.Seconds())}}
+	if len(sources) == 0 && h.ExpectSync {
+		c.Status = StatusDegraded
+		c.Error = "no successful sync yet"
+	}
+	return c
+}
+
+// GET /livez
+func Livez() gin.HandlerFunc {
+	started := time.Now()
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{
+			"status":        StatusOK,
+			"build":         Build(),
+			"uptimeSeconds": int64(time.Since(started).Seconds()),
+		})
+	}
+}
+
+// GET /readyz
+// 200 when ok or degraded, 503 when the instance should not get traffic.
+func Readyz(h *Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rep := h.Ready(c.Request.Context())
+		code := http.StatusOK
+		if rep.Status == StatusUnavailable {
+			code = http.StatusServiceUnavailable
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(code, rep)
+	}
+}
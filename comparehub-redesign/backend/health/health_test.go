@@ -0,0 +1,95 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type pingFunc func(ctx context.Context) error
+
+func (f pingFunc) PingContext(ctx context.Context) error { return f(ctx) }
+
+func TestReadyz(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	healthy := func() *Checker {
+		return &Checker{
+			DB:      pingFunc(func(context.Context) error { return nil }),
+			Pending: func(context.Context) (int, error) { return 0, nil },
+			LastSync: func(context.Context) (map[string]time.Time, error) {
+				return map[string]time.Time{"demo": now.Add(-10 * time.Minute)}, nil
+			},
+			Timeout:    50 * time.Millisecond,
+			StaleAfter: time.Hour,
+			Now:        func() time.Time { return now },
+		}
+	}
+
+	cases := []struct {
+		name       string
+		mutate     func(h *Checker)
+		wantCode   int
+		wantStatus string
+	}{
+		{"healthy", func(*Checker) {}, 200, StatusOK},
+		{"db down", func(h *Checker) {
+			h.DB = pingFunc(func(context.Context) error { return errors.New("connection refused") })
+		}, 503, StatusUnavailable},
+		{"db hangs", func(h *Checker) {
+			h.DB = pingFunc(func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() })
+		}, 503, StatusUnavailable},
+		{"pending migrations", func(h *Checker) {
+			h.Pending = func(context.Context) (int, error) { return 2, nil }
+		}, 503, StatusUnavailable},
+		{"stale source", func(h *Checker) {
+			h.Now = func() time.Time { return now.Add(2 * time.Hour) }
+		}, 200, StatusDegraded},
+		{"never synced with sync enabled", func(h *Checker) {
+			h.LastSync = func(context.Context) (map[string]time.Time, error) { return nil, nil }
+			h.ExpectSync = true
+		}, 200, StatusDegraded},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := healthy()
+			tc.mutate(h)
+			r := gin.New()
+			r.GET("/readyz", Readyz(h))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+			if w.Code != tc.wantCode {
+				t.Errorf("status code = %d, want %d", w.Code, tc.wantCode)
+			}
+			var rep Report
+			if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil {
+				t.Fatal(err)
+			}
+			if rep.Status != tc.wantStatus {
+				t.Errorf("status = %q, want %q (%s)", rep.Status, tc.wantStatus, w.Body)
+			}
+			if rep.Build.Version == "" {
+				t.Error("build version missing")
+			}
+		})
+	}
+}
+
+func TestLivezIgnoresDependencies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/livez", Livez())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/livez", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
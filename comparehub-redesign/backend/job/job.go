@@ -0,0 +1,83 @@
+// Package job runs background jobs (feed syncs, analytics rollups) inside
+// the server: one run at a time per job, on a schedule or on demand, and
+// shutdown can wait for the run in progress instead of cutting it off
+// halfway.
+package job
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Runner serializes the runs of one job in a process: the scheduled loop
+// and on-demand runs never overlap. Jobs shared between instances take
+// their own advisory lock on top.
+type Runner[T any] struct {
+	run     func(ctx context.Context) (T, error)
+	timeout time.Duration
+
+	mu sync.Mutex     // held for the duration of a run
+	wg sync.WaitGroup // counts RunEvery loops and runs in progress
+}
+
+// New returns a Runner for run. Each run is bounded by timeout (0 means no
+// limit).
+func New[T any](run func(ctx context.Context) (T, error), timeout time.Duration) *Runner[T] {
+	return &Runner[T]{run: run, timeout: timeout}
+}
+
+// RunOnce performs one run, waiting for a run already in progress first.
+// The run is detached from ctx's cancellation so that a client hanging up
+// or the server shutting down does not abort it midway; only the Runner's
+// timeout stops it.
+func (r *Runner[T]) RunOnce(ctx context.Context) (T, error) {
+	r.wg.Add(1)
+	defer r.wg.Done()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx = context.WithoutCancel(ctx)
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	return r.run(ctx)
+}
+
+// RunEvery runs immediately and then every interval until ctx is done,
+// passing each outcome to done (for logging). A run in progress when ctx
+// is cancelled is allowed to finish; use Wait to block until it has.
+func (r *Runner[T]) RunEvery(ctx context.Context, interval time.Duration, done func(ctx context.Context, res T, err error)) {
+	r.wg.Add(1)
+	defer r.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		res, err := r.RunOnce(ctx)
+		done(ctx, res, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Wait blocks until every RunEvery loop has returned and no run is in
+// progress, or until ctx is done.
+func (r *Runner[T]) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,72 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunsNeverOverlap(t *testing.T) {
+	var running, overlaps atomic.Int32
+	r := New(func(context.Context) (int, error) {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		return 0, nil
+	}, 0)
+
+	done := make(chan struct{})
+	for range 4 {
+		go func() {
+			r.RunOnce(context.Background())
+			done <- struct{}{}
+		}()
+	}
+	for range 4 {
+		<-done
+	}
+	if n := overlaps.Load(); n != 0 {
+		t.Errorf("%d runs overlapped", n)
+	}
+}
+
+func TestRunIsDetachedButTimed(t *testing.T) {
+	r := New(func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}, 10*time.Millisecond)
+
+	// A cancelled caller does not stop the run; the timeout does.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.RunOnce(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunOnce = %v, want the runner's timeout", err)
+	}
+}
+
+func TestRunEveryStopsOnCancel(t *testing.T) {
+	runs := make(chan int, 1)
+	r := New(func(context.Context) (int, error) { return 1, nil }, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go r.RunEvery(ctx, time.Hour, func(_ context.Context, res int, _ error) {
+		select {
+		case runs <- res:
+		default:
+		}
+	})
+	if res := <-runs; res != 1 {
+		t.Fatalf("first run reported %d", res)
+	}
+	cancel()
+
+	wctx, wcancel := context.WithTimeout(context.Background(), time.Second)
+	defer wcancel()
+	if err := r.Wait(wctx); err != nil {
+		t.Fatalf("RunEvery did not stop after cancel: %v", err)
+	}
+}
@@ -1,178 +1,323 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
+	"go-ecommerce-backend/cache"
+	"go-ecommerce-backend/config"
 	"go-ecommerce-backend/db"
 	"go-ecommerce-backend/handlers"
+	"go-ecommerce-backend/health"
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/metrics"
 	"go-ecommerce-backend/middleware"
+	"go-ecommerce-backend/migrate"
+	"go-ecommerce-backend/openapi"
+	"go-ecommerce-backend/ratelimit"
+	"go-ecommerce-backend/rollup"
+	"go-ecommerce-backend/routes"
+	"go-ecommerce-backend/store/postgres"
 	syncer "go-ecommerce-backend/sync"
+	"go-ecommerce-backend/tracing"
 )
 
-func runSchema(conn *sql.DB) {
-	schemaBytes, err := os.ReadFile("sql/schema.sql")
-	if err != nil {
-		log.Fatal("Could not read schema.sql:", err)
+// routeTimeouts are the built-in per-route request deadlines; everything
+// else gets server.queryTimeout. Entries in server.routeTimeouts override
+// these, and 0 disables the deadline.
+var routeTimeouts = map[string]time.Duration{
+	"GET /products":                 10 * time.Second,
+	"GET /compare":                  10 * time.Second,
+	"GET /admin/analytics/summary":  15 * time.Second,
+	"GET /admin/analytics/searches": 15 * time.Second,
+	"GET /admin/analytics/clicks":   15 * time.Second,
+	// Sync runs are bounded by sync.timeout instead (see syncer.Runner).
+	"POST /admin/sync-now": 0,
+	// Exports stream for as long as the client keeps reading.
+	"GET /admin/analytics/export": 0,
+}
+
+// timeoutMiddleware merges routeTimeouts with the configured overrides.
+func timeoutMiddleware(cfg config.Server) gin.HandlerFunc {
+	merged := make(map[string]time.Duration, len(routeTimeouts)+len(cfg.RouteTimeouts))
+	for k, d := range routeTimeouts {
+		merged[k] = d
 	}
-	if _, err := conn.Exec(string(schemaBytes)); err != nil {
-		log.Fatal("Could not run schema.sql:", err)
+	for k, d := range cfg.RouteTimeouts {
+		merged[k] = d.Std()
 	}
-	log.Println("✅ DB schema ready")
+	return middleware.Timeout(cfg.QueryTimeout.Std(), merged)
 }
 
-func runSeed(conn *sql.DB) {
-	seedFiles := []string{"sql/seed.sql", "sql/seed_specs.sql"}
-	for _, f := range seedFiles {
-		b, err := os.ReadFile(f)
-		if err != nil {
-			log.Println("Could not read", f, ":", err)
-			continue
-		}
-		if _, err := conn.Exec(string(b)); err != nil {
-			log.Println("Could not run", f, ":", err)
-			continue
-		}
+// routeLimits are the built-in per-route rate limits (per client IP);
+// everything else gets rateLimit.default. Entries in rateLimit.routes
+// override these, and "off" (the zero Rate) disables limiting. Probes and
+// scrapes come from a handful of addresses and must never be refused.
+var routeLimits = map[string]config.Rate{
+	"POST /auth/login":  {Requests: 10, Per: time.Minute},
+	"POST /track/click": {Requests: 30, Per: time.Minute},
+	"GET /go/:offerId":  {Requests: 30, Per: time.Minute},
+	"GET /health":       {},
+	"GET /livez":        {},
+	"GET /readyz":       {},
+	"GET /metrics":      {},
+}
+
+// rateLimitMiddleware merges routeLimits with the configured overrides.
+func rateLimitMiddleware(cfg config.RateLimit, rl ratelimit.Backend) gin.HandlerFunc {
+	merged := make(map[string]ratelimit.Limit, len(routeLimits)+len(cfg.Routes))
+	for k, r := range routeLimits {
+		merged[k] = ratelimit.FromRate(r)
+	}
+	for k, r := range cfg.Routes {
+		merged[k] = ratelimit.FromRate(r)
 	}
-	log.Println("🌱 Demo seed data ready")
+	return ratelimit.Middleware(rl, ratelimit.FromRate(cfg.Default), merged)
 }
 
-func resolveFeedPath() string {
-	// 1) Allow override via env
-	if p := os.Getenv("FEED_PATH"); p != "" {
-		return p
+// setupRouter builds the gin engine with middleware and every route. A
+// nil rl turns rate limiting and login lockouts off.
+func setupRouter(cfg *config.Config, conn *sql.DB, runner *syncer.Runner, rc *cache.Cache, rl ratelimit.Backend, events *handlers.EventQueue) (*gin.Engine, error) {
+	r := gin.New()
+	// ClientIP (rate limits, logs) trusts X-Forwarded-For only from these.
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("server.trustedProxies: %w", err)
 	}
+	r.Use(tracing.Middleware(), middleware.RequestID(), middleware.AccessLog(), middleware.Recovery())
+	r.Use(metrics.Middleware())
+	r.Use(timeoutMiddleware(cfg.Server))
+	r.Use(cache.Middleware(cfg.Cache.AllowBypass))
 
-	candidates := []string{
-		"feeds/source_demo.json",                              // when running from backend/
-		filepath.Join("backend", "feeds", "source_demo.json"), // when running from repo root
+	// ✅ CORS: explicit allowlist per environment (see config.CORS)
+	corsMW, err := middleware.CORS(cfg.CORS, cfg.Env)
+	if err != nil {
+		return nil, err
 	}
+	r.Use(corsMW)
 
-	// 2) Also try relative to the executable (useful for built binaries)
-	if exe, err := os.Executable(); err == nil {
-		base := filepath.Dir(exe)
-		candidates = append(candidates, filepath.Join(base, "feeds", "source_demo.json"))
+	// After CORS, so browsers can read a 429.
+	var lockout *ratelimit.Lockout
+	if rl != nil {
+		r.Use(rateLimitMiddleware(cfg.RateLimit, rl))
+		lockout = ratelimit.NewLockout(rl, cfg.RateLimit.LoginMaxFailures, cfg.RateLimit.LoginLockout.Std())
 	}
 
-	for _, c := range candidates {
-		if _, err := os.Stat(c); err == nil {
-			return c
-		}
+	// /health is the historical shallow probe; orchestrators should use
+	// /livez for liveness and /readyz for readiness.
+	r.GET("/health", func(c *gin.Context) { c.JSON(200, gin.H{"status": "ok"}) })
+	r.GET("/livez", health.Livez())
+	r.GET("/readyz", health.Readyz(&health.Checker{
+		DB:         conn,
+		Pending:    migrate.New(conn).Pending,
+		LastSync:   func(ctx context.Context) (map[string]time.Time, error) { return syncer.LastSuccess(ctx, conn) },
+		Timeout:    cfg.Server.HealthTimeout.Std(),
+		StaleAfter: cfg.Sync.StaleAfter.Std(),
+		ExpectSync: cfg.Sync.Enabled,
+	}))
+
+	// Catalog reads go through the response cache (see cache.Wrap); admin
+	// writes through it invalidate it.
+	routes.Mount(r, routes.Deps{
+		Config:  cfg,
+		Stores:  cache.Wrap(postgres.Stores(conn), rc),
+		Runner:  runner,
+		Cache:   rc,
+		Lockout: lockout,
+		Events:  events,
+	})
+
+	r.GET("/openapi.json", openapi.Handler())
+
+	// /metrics moves to its own listener when metrics.addr is set (see
+	// serve); on the public port it is guarded by METRICS_TOKEN.
+	if cfg.Metrics.Enabled && cfg.Metrics.Addr == "" {
+		r.GET("/metrics", metrics.Handler(cfg.Metrics.Token))
 	}
 
-	// Fall back to the most common
-	return "feeds/source_demo.json"
+	return r, nil
 }
 
-func main() {
-	_ = godotenv.Load()
+// serve runs the HTTP server (the default command).
+func serve(cfg *config.Config, args []string) error {
+	fs := newFlagSet("serve")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := cfg.ValidateServer(); err != nil {
+		return err
+	}
+
+	// gin's own debug output (route table, warnings) is plain text; keep
+	// it for LOG_LEVEL=debug only.
+	if !strings.EqualFold(cfg.Log.Level, "debug") {
+		gin.SetMode(gin.ReleaseMode)
+	}
 
-	conn := db.Open()
-	runSchema(conn)
-	runSeed(conn)
+	conn, err := db.Open(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	// Pending migrations are applied at boot only when autoMigrate is on
+	// (AUTO_MIGRATE=true); otherwise "migrate up" must run first.
+	if cfg.AutoMigrate {
+		if err := runMigrate(conn, []string{"up"}); err != nil {
+			return fmt.Errorf("migrations failed: %w", err)
+		}
+	} else if n, err := migrate.New(conn).Pending(context.Background()); err != nil {
+		return fmt.Errorf("migration status: %w", err)
+	} else if n > 0 {
+		return fmt.Errorf("%d pending migration(s); run \"comparehub migrate up\" first", n)
+	}
+
+	// SIGTERM (Render, Kubernetes) and Ctrl-C start a graceful shutdown.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	rc, err := cache.New(cfg.Cache)
+	if err != nil {
+		return err
+	}
+
+	runner := syncer.NewRunner(conn, cfg.Sync.FeedPath, cfg.Sync.Timeout.Std())
+	runner.OnSync = func(ctx context.Context, _ syncer.Result, _ error) {
+		if err := rc.Invalidate(ctx); err != nil {
+			logging.FromContext(ctx).Warn("cache invalidation after sync failed", "err", err)
+		}
+	}
 
 	// Auto-sync worker is OFF by default.
 	// Turn it on only when you explicitly want to demo feed ingestion.
-	feedPath := resolveFeedPath()
-	if strings.EqualFold(os.Getenv("ENABLE_SYNC"), "true") {
-		go syncer.RunEvery(conn, 2*time.Minute, feedPath)
-		log.Println("🔁 ENABLE_SYNC=true (auto-sync worker running)")
+	if cfg.Sync.Enabled {
+		go runner.RunEvery(ctx, cfg.Sync.Interval.Std())
+		slog.Info("auto-sync worker running", "interval", cfg.Sync.Interval.Std().String(), "feed", cfg.Sync.FeedPath)
 	} else {
-		log.Println("ℹ️ ENABLE_SYNC is off (use /admin/sync-now to import feed)")
+		slog.Info("auto-sync is off; use \"comparehub sync\" or /admin/sync-now to import the feed")
 	}
 
-	r := gin.Default()
+	// Analytics read rollups, so the rollup job is on by default.
+	rollups := rollup.NewRunner(conn, rollupOptions(cfg.Analytics))
+	if cfg.Analytics.RollupInterval > 0 {
+		go rollups.RunEvery(ctx, cfg.Analytics.RollupInterval.Std())
+		slog.Info("analytics rollup worker running", "interval", cfg.Analytics.RollupInterval.Std().String(),
+			"retention", cfg.Analytics.Retention.Std().String())
+	} else {
+		slog.Info("analytics rollups are off; run \"comparehub rollup\" to refresh analytics")
+	}
 
-	// ✅ CORS: allow local dev + allow your deployed frontend via env
-	allowedOrigins := []string{"http://localhost:5173"} // keep local dev
-	if o := os.Getenv("FRONTEND_ORIGIN"); o != "" {
-		// Example: https://comparehub.vercel.app
-		allowedOrigins = append(allowedOrigins, o)
+	var rl ratelimit.Backend
+	if cfg.RateLimit.Enabled {
+		if rl, err = ratelimit.New(cfg.RateLimit, cfg.Cache.RedisURL); err != nil {
+			return err
+		}
 	}
 
-	r.Use(cors.New(cors.Config{
-  AllowOriginFunc: func(origin string) bool {
+	// Searches and product views are recorded off the request path.
+	events := handlers.NewEventQueue(cfg.Analytics.QueueSize, cfg.Analytics.Workers)
 
-    // local dev
-    if origin == "http://localhost:5173" {
-      return true
-    }
+	r, err := setupRouter(cfg, conn, runner, rc, rl, events)
+	if err != nil {
+		return err
+	}
 
-    // allow frontend from env
-    if o := os.Getenv("FRONTEND_ORIGIN"); o != "" && origin == o {
-      return true
-    }
+	// ✅ Render requires PORT and listening on 0.0.0.0
+	srv := &http.Server{
+		Addr:              "0.0.0.0:" + cfg.Port,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Std(),
+		ReadTimeout:       cfg.Server.ReadTimeout.Std(),
+		WriteTimeout:      cfg.Server.WriteTimeout.Std(),
+		IdleTimeout:       cfg.Server.IdleTimeout.Std(),
+	}
+	servers := []*http.Server{srv}
 
-    // allow Render frontend
-    if strings.HasSuffix(origin, ".onrender.com") {
-      return true
-    }
+	if err := metrics.RegisterDB(conn); err != nil {
+		return err
+	}
+	if cfg.Metrics.Enabled && cfg.Metrics.Addr != "" {
+		mr := gin.New()
+		mr.GET("/metrics", metrics.Handler(cfg.Metrics.Token))
+		servers = append(servers, &http.Server{
+			Addr: cfg.Metrics.Addr, Handler: mr, ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Std(),
+		})
+		slog.Info("metrics listener", "addr", cfg.Metrics.Addr)
+	}
 
-    // allow Vercel
-    if strings.HasSuffix(origin, ".vercel.app") {
-      return true
-    }
+	errc := make(chan error, len(servers))
+	for _, s := range servers {
+		go func() { errc <- s.ListenAndServe() }()
+	}
+	slog.Info("backend running", "port", cfg.Port, "env", cfg.Env)
 
-    return false
-  },
-  AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-  AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-  AllowCredentials: false,
-}))
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	return shutdown(servers, runner, rollups, events, conn, rc, rl, cfg.Server.ShutdownTimeout.Std())
+}
 
-	r.GET("/health", func(c *gin.Context) { c.JSON(200, gin.H{"status": "ok"}) })
+// shutdown stops accepting connections, lets in-flight requests finish,
+// records the queued analytics events, waits for a sync or analytics
+// rollup in progress and closes the pool, the cache and the rate limiter's
+// connection, all within timeout.
+func shutdown(servers []*http.Server, runner *syncer.Runner, rollups *rollup.Runner, events *handlers.EventQueue, conn *sql.DB, rc *cache.Cache, rl ratelimit.Backend, timeout time.Duration) error {
+	slog.Info("shutting down", "timeout", timeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	// -----------------------
-	// Public APIs
-	// -----------------------
-	r.GET("/products", handlers.ListProducts(conn))
-	r.GET("/products/:id", handlers.GetProduct(conn))
-	r.GET("/products/:id/offers", handlers.GetOffers(conn))
-	r.GET("/compare", handlers.Compare(conn))
-	r.GET("/analytics/top-deals", handlers.TopDeals(conn))
-
-	// -----------------------
-	// Analytics
-	// -----------------------
-	r.GET("/analytics/summary", handlers.AnalyticsSummary(conn))
-	r.POST("/track/click", handlers.TrackClick(conn))
-
-	// -----------------------
-	// Public auth
-	// -----------------------
-	r.POST("/auth/login", handlers.Login())
-
-	// -----------------------
-	// Protected admin APIs
-	// -----------------------
-	admin := r.Group("/admin", middleware.RequireAdmin())
-	{
-		admin.POST("/products", handlers.AdminCreateProduct(conn))
-		admin.POST("/offers", handlers.AdminCreateOffer(conn))
-		admin.POST("/specs", handlers.AdminUpsertSpecs(conn))
-
-		admin.POST("/sync-now", func(c *gin.Context) {
-			syncer.RunOnce(conn, feedPath)
-			c.JSON(200, gin.H{"ok": true})
-		})
+	var errs []error
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("http shutdown %s: %w", srv.Addr, err))
+		}
 	}
-
-	// ✅ Render requires PORT and listening on 0.0.0.0
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080" // local fallback
+	if err := events.Close(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("analytics events not recorded: %w", err))
+	}
+	if err := runner.Wait(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("sync still running: %w", err))
+	}
+	if err := rollups.Wait(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("analytics rollup still running: %w", err))
+	}
+	if err := conn.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := rc.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("cache close: %w", err))
 	}
+	if c, ok := rl.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("rate limiter close: %w", err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	slog.Info("shutdown complete")
+	return nil
+}
+
+func main() {
+	_ = godotenv.Load()
 
-	log.Println("🚀 Backend running on port:", port)
-	if err := r.Run("0.0.0.0:" + port); err != nil {
-		log.Fatal(err)
+	if err := run(os.Args[1:]); err != nil {
+		slog.Error("exiting", "err", err)
+		os.Exit(1)
 	}
 }
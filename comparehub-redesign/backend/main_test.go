@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/cache"
+	"go-ecommerce-backend/config"
+	"go-ecommerce-backend/handlers"
+	"go-ecommerce-backend/openapi"
+	"go-ecommerce-backend/ratelimit"
+)
+
+// Every route registered on the engine must be described in the OpenAPI
+// document, and the document must not describe routes that do not exist.
+func TestOpenAPICoversRegisteredRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	rc, err := cache.New(cfg.Cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := setupRouter(cfg, nil, nil, rc, ratelimit.NewMemory(nil), handlers.NewEventQueue(1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered := map[string]bool{}
+	for _, rt := range r.Routes() {
+		registered[rt.Method+" "+openapi.PathFromGin(rt.Path)] = true
+	}
+
+	documented := map[string]bool{}
+	for _, op := range openapi.Operations(openapi.Document()) {
+		documented[op] = true
+	}
+
+	for op := range registered {
+		if !documented[op] {
+			t.Errorf("route %s is registered but missing from the OpenAPI document", op)
+		}
+	}
+	for op := range documented {
+		if !registered[op] {
+			t.Errorf("OpenAPI document describes %s, which is not registered", op)
+		}
+	}
+}
+
+// Outbound links are limited per client IP like clicks, so a script cannot
+// inflate click counts through /go.
+func TestGoRedirectRateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	rc, err := cache.New(cfg.Cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := setupRouter(cfg, nil, nil, rc, ratelimit.NewMemory(nil), handlers.NewEventQueue(1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An invalid offer id is refused before the database, so no conn is
+	// needed; it still takes a token.
+	for i := range 31 {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/go/x", nil))
+		want := http.StatusBadRequest
+		if i == 30 {
+			want = http.StatusTooManyRequests
+		}
+		if w.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package metrics holds the Prometheus collectors exported on /metrics.
+//
+// Collectors are package-level and registered on Registry (not the global
+// default registry), so only what is listed here is exposed.
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "comparehub"
+
+// Registry is what Handler exposes.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"method", "route"})
+
+	syncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "sync_run_duration_seconds",
+		Help:    "Duration of feed sync and import runs by source and outcome.",
+		Buckets: []float64{.1, .5, 1, 5, 15, 30, 60, 120, 300, 600},
+	}, []string{"source", "result"})
+
+	syncRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "sync_records_total",
+		Help: "Records written by sync runs, by source and kind (product, new_product, offer, new_offer, deactivated).",
+	}, []string{"source", "kind"})
+
+	syncErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "sync_errors_total",
+		Help: "Rows that failed during sync runs, by source.",
+	}, []string{"source"})
+
+	syncLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Name: "sync_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful sync run per source.",
+	}, []string{"source"})
+
+	events = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "events_total",
+		Help: "Recorded analytics events by type (click, click_bot, click_duplicate, search).",
+	}, []string{"type"})
+
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "cache_lookups_total",
+		Help: "Cache lookups by cache name and result (hit, miss).",
+	}, []string{"cache", "result"})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "rate_limited_total",
+		Help: "Requests refused with 429 by route and reason (rate, lockout).",
+	}, []string{"route", "reason"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		syncDuration, syncRecords, syncErrors, syncLastSuccess,
+		events, cacheLookups, rateLimited,
+	)
+}
+
+// RegisterDB exports the pool statistics of conn (open, in-use and idle
+// connections, waits and wait time).
+func RegisterDB(conn *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(conn, namespace))
+}
+
+// Middleware records request counts and latency. Routes are labelled with
+// the registered pattern (/products/:id), never the raw path, to keep the
+// label set bounded.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// SyncRun is what a sync or import run reports once it has finished.
+type SyncRun struct {
+	Source      string
+	Duration    time.Duration
+	Products    int
+	NewProducts int
+	Offers      int
+	NewOffers   int
+	Deactivated int64
+	Errors      int
+	Failed      bool
+}
+
+// ObserveSync records a finished (non dry-run) sync.
+func ObserveSync(r SyncRun) {
+	result := "ok"
+	if r.Failed {
+		result = "error"
+	} else {
+		syncLastSuccess.WithLabelValues(r.Source).SetToCurrentTime()
+	}
+	syncDuration.WithLabelValues(r.Source, result).Observe(r.Duration.Seconds())
+	syncRecords.WithLabelValues(r.Source, "product").Add(float64(r.Products))
+	syncRecords.WithLabelValues(r.Source, "new_product").Add(float64(r.NewProducts))
+	syncRecords.WithLabelValues(r.Source, "offer").Add(float64(r.Offers))
+	syncRecords.WithLabelValues(r.Source, "new_offer").Add(float64(r.NewOffers))
+	syncRecords.WithLabelValues(r.Source, "deactivated").Add(float64(r.Deactivated))
+	syncErrors.WithLabelValues(r.Source).Add(float64(r.Errors))
+}
+
+// Event counts one recorded analytics event ("click", "search", "view";
+// filtered events as "click_bot", "click_duplicate", "view_bot" and
+// "view_duplicate"; events lost to a full queue as "search_dropped" and
+// "view_dropped").
+func Event(kind string) {
+	events.WithLabelValues(kind).Inc()
+}
+
+// CacheLookup counts a lookup in the named cache.
+func CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// RateLimited counts a request refused on route for reason ("rate" for an
+// empty token bucket, "lockout" for a locked login).
+func RateLimited(route, reason string) {
+	rateLimited.WithLabelValues(route, reason).Inc()
+}
+
+// Handler serves Registry in the Prometheus text format. A non-empty token
+// must be presented as "Authorization: Bearer <token>".
+func Handler(token string) gin.HandlerFunc {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		if token != "" {
+			got := c.GetHeader("Authorization")
+			if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) != 1 {
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
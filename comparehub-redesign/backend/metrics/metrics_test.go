@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandlerAndMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/products/:id", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+	r.GET("/metrics", Handler("s3cret"))
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/products/42", nil))
+	ObserveSync(SyncRun{Source: "demo", Duration: time.Second, Products: 3, Errors: 1})
+	Event("click")
+	CacheLookup("products", true)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("without token: status = %d, want 401", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("with token: status = %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`comparehub_http_requests_total{method="GET",route="/products/:id",status="404"} 1`,
+		`comparehub_sync_records_total{kind="product",source="demo"} 3`,
+		`comparehub_sync_errors_total{source="demo"} 1`,
+		`comparehub_events_total{type="click"} 1`,
+		`comparehub_cache_lookups_total{cache="products",result="hit"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s", want)
+		}
+	}
+}
@@ -2,27 +2,25 @@ package middleware
 
 import (
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+
+	"go-ecommerce-backend/api"
 )
 
-func RequireAdmin() gin.HandlerFunc {
+func RequireAdmin(secret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.GetHeader("Authorization")
 		if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
-			c.Abort()
+			api.Fail(c, http.StatusUnauthorized, api.CodeUnauthorized, "missing token", nil)
 			return
 		}
 
 		tokenStr := strings.TrimPrefix(auth, "Bearer ")
-		secret := os.Getenv("JWT_SECRET")
 		if secret == "" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT_SECRET missing"})
-			c.Abort()
+			api.Fail(c, http.StatusInternalServerError, api.CodeInternal, "JWT_SECRET missing", nil)
 			return
 		}
 
@@ -31,15 +29,13 @@ func RequireAdmin() gin.HandlerFunc {
 		})
 
 		if err != nil || !tok.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-			c.Abort()
+			api.Fail(c, http.StatusUnauthorized, api.CodeUnauthorized, "invalid token", nil)
 			return
 		}
 
 		claims, ok := tok.Claims.(jwt.MapClaims)
 		if !ok || claims["role"] != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
-			c.Abort()
+			api.Fail(c, http.StatusForbidden, api.CodeForbidden, "admin only", nil)
 			return
 		}
 
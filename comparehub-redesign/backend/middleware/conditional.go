@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/config"
+)
+
+// Revalidate is the Cache-Control of responses that caches may store but
+// must check with the server before every reuse.
+const Revalidate = "public, no-cache"
+
+// CacheControl is the Cache-Control value for cfg.
+func CacheControl(cfg config.HTTPCache) string {
+	secs := func(d config.Duration) string { return strconv.Itoa(int(d.Std() / time.Second)) }
+	v := "public, max-age=" + secs(cfg.MaxAge) + ", s-maxage=" + secs(cfg.SharedMaxAge)
+	if cfg.StaleWhileRevalidate > 0 {
+		v += ", stale-while-revalidate=" + secs(cfg.StaleWhileRevalidate)
+	}
+	return v
+}
+
+// Conditional makes a GET route cacheable over HTTP. It buffers the
+// response and, when the handler answers 200, tags it with an ETag (a hash
+// of the body) and cacheControl. A request whose If-None-Match matches the
+// ETag, or whose If-Modified-Since is not older than the Last-Modified the
+// handler set, gets a bodiless 304 instead. Other statuses pass through
+// untouched.
+func Conditional(cacheControl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+		w := &bufferWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.status != http.StatusOK {
+			w.flush()
+			return
+		}
+		sum := sha256.Sum256(w.body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		h := w.Header()
+		h.Set("ETag", etag)
+		h.Set("Cache-Control", cacheControl)
+
+		if notModified(c.Request, etag, h.Get("Last-Modified")) {
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			w.ResponseWriter.WriteHeader(http.StatusNotModified)
+			w.ResponseWriter.WriteHeaderNow()
+			return
+		}
+		w.flush()
+	}
+}
+
+// notModified applies RFC 9110's precedence: If-None-Match when present,
+// otherwise If-Modified-Since against lastModified.
+func notModified(r *http.Request, etag, lastModified string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, t := range strings.Split(inm, ",") {
+			t = strings.TrimPrefix(strings.TrimSpace(t), "W/") // weak comparison
+			if t == "*" || t == etag {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified == "" {
+		return false
+	}
+	lm, err := http.ParseTime(lastModified)
+	return err == nil && !lm.After(ims)
+}
+
+// bufferWriter holds the status and body until Conditional has decided
+// between the response and a 304.
+type bufferWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferWriter) WriteHeaderNow() { w.written = true }
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.body.Write(b)
+}
+
+func (w *bufferWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferWriter) Status() int   { return w.status }
+func (w *bufferWriter) Size() int     { return w.body.Len() }
+func (w *bufferWriter) Written() bool { return w.written }
+
+// Flush is a no-op: a buffered response cannot be streamed.
+func (w *bufferWriter) Flush() {}
+
+func (w *bufferWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	_, _ = w.ResponseWriter.Write(w.body.Bytes())
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/config"
+)
+
+func TestCacheControl(t *testing.T) {
+	got := CacheControl(config.HTTPCache{
+		MaxAge:               config.Duration(time.Minute),
+		SharedMaxAge:         config.Duration(5 * time.Minute),
+		StaleWhileRevalidate: config.Duration(30 * time.Second),
+	})
+	if want := "public, max-age=60, s-maxage=300, stale-while-revalidate=30"; got != want {
+		t.Errorf("CacheControl = %q, want %q", got, want)
+	}
+}
+
+func TestConditionalPassesErrorsThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/missing", Conditional("public, max-age=60"), func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set("If-None-Match", "*")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound || w.Body.Len() == 0 {
+		t.Errorf("status %d body %q, want the 404 unchanged", w.Code, w.Body)
+	}
+	if w.Header().Get("ETag") != "" || w.Header().Get("Cache-Control") != "" {
+		t.Errorf("error response got caching headers: %v", w.Header())
+	}
+}
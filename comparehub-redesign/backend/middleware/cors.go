@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/config"
+)
+
+// OriginMatcher decides which browser origins may call the API.
+//
+// An entry is either an exact origin ("https://comparehub.app",
+// "http://localhost:5173") or a pattern whose leftmost host label is "*"
+// ("https://*.comparehub.app"). A pattern matches any subdomain at any depth
+// but not the bare domain, and scheme and port must match exactly. Matching
+// ignores case and a trailing slash.
+type OriginMatcher struct {
+	exact    map[string]bool
+	wildcard []originPattern
+}
+
+type originPattern struct {
+	scheme string
+	suffix string // ".comparehub.app" (plus ":port" when given)
+}
+
+// NewOriginMatcher validates entries; a malformed or overly broad entry
+// (bare "*", "https://*", "https://*.app") is an error rather than being
+// silently ignored.
+func NewOriginMatcher(entries []string) (*OriginMatcher, error) {
+	m := &OriginMatcher{exact: map[string]bool{}}
+	var errs []error
+	for _, e := range entries {
+		e = normalizeOrigin(e)
+		if e == "" {
+			continue
+		}
+		u, err := url.Parse(e)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			errs = append(errs, fmt.Errorf("cors: %q is not an origin like https://example.com", e))
+			continue
+		}
+
+		host := u.Host
+		if !strings.Contains(host, "*") {
+			m.exact[e] = true
+			continue
+		}
+		rest, ok := strings.CutPrefix(host, "*.")
+		hostname := strings.Split(rest, ":")[0]
+		if !ok || strings.Contains(rest, "*") || !strings.Contains(hostname, ".") {
+			errs = append(errs, fmt.Errorf("cors: %q: a wildcard must be the whole leftmost label of a domain with at least two labels, e.g. https://*.example.com", e))
+			continue
+		}
+		m.wildcard = append(m.wildcard, originPattern{scheme: u.Scheme, suffix: "." + rest})
+	}
+	return m, errors.Join(errs...)
+}
+
+func normalizeOrigin(s string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "/")
+}
+
+// Allow reports whether origin may make cross-origin requests.
+func (m *OriginMatcher) Allow(origin string) bool {
+	origin = normalizeOrigin(origin)
+	if m.exact[origin] {
+		return true
+	}
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok {
+		return false
+	}
+	for _, p := range m.wildcard {
+		if scheme != p.scheme || !strings.HasSuffix(host, p.suffix) {
+			continue
+		}
+		sub := strings.TrimSuffix(host, p.suffix)
+		// The subdomain part must be a real label: no port, path or
+		// empty labels sneaking in.
+		if sub != "" && !strings.ContainsAny(sub, ":/@") && !strings.HasPrefix(sub, ".") &&
+			!strings.HasSuffix(sub, ".") && !strings.Contains(sub, "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS applies cfg's policy for the active environment (see
+// config.CORS.Origins).
+func CORS(cfg config.CORS, env string) (gin.HandlerFunc, error) {
+	m, err := NewOriginMatcher(cfg.Origins(env))
+	if err != nil {
+		return nil, err
+	}
+	return cors.New(cors.Config{
+		AllowOriginFunc:  m.Allow,
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Version", "X-Request-ID", "X-Cache-Bypass", "If-None-Match", "If-Modified-Since", "X-Session-ID"},
+		ExposeHeaders:    []string{"X-Search-ID", "X-Request-ID", "X-Cache", "ETag", "Retry-After"},
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge.Std(),
+	}), nil
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/config"
+)
+
+func TestOriginMatcher(t *testing.T) {
+	m, err := NewOriginMatcher([]string{
+		"https://comparehub.app",
+		"http://localhost:5173/",
+		"https://*.comparehub.app",
+		"https://*.preview.example.com:8443",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://comparehub.app", true},
+		{"HTTPS://CompareHub.app/", true},
+		{"http://localhost:5173", true},
+		{"http://localhost:5174", false},
+		{"http://comparehub.app", false}, // scheme must match
+		{"https://www.comparehub.app", true},
+		{"https://a.b.comparehub.app", true},
+		{"https://evilcomparehub.app", false},        // not a subdomain
+		{"https://comparehub.app.evil.com", false},   // suffix only
+		{"https://www.comparehub.app:444", false},    // port must match
+		{"https://x.preview.example.com:8443", true}, // pattern with port
+		{"https://x.preview.example.com", false},     // ... and only that port
+		{"https://my-app.vercel.app", false},         // no implicit hosting domains
+		{"https://.comparehub.app", false},           // empty label
+		{"https://user@x.comparehub.app", false},     // userinfo
+		{"null", false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		if got := m.Allow(tc.origin); got != tc.want {
+			t.Errorf("Allow(%q) = %v, want %v", tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestOriginMatcherRejectsBadEntries(t *testing.T) {
+	bad := []string{
+		"*",
+		"https://*",
+		"https://*.app",               // too broad
+		"https://foo*.example.com",    // partial label
+		"https://api.*.example.com",   // not leftmost
+		"comparehub.app",              // no scheme
+		"ftp://comparehub.app",        // not http(s)
+		"https://comparehub.app/path", // not an origin
+	}
+	for _, e := range bad {
+		if _, err := NewOriginMatcher([]string{e}); err == nil {
+			t.Errorf("NewOriginMatcher(%q) accepted", e)
+		}
+	}
+}
+
+func TestCORSProfilesAndCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.CORS{
+		AllowedOrigins:   []string{"https://*.comparehub.app"},
+		Profiles:         map[string][]string{"staging": {"https://staging-ui.example.com"}},
+		AllowCredentials: true,
+	}
+
+	preflight := func(env, origin string) *httptest.ResponseRecorder {
+		mw, err := CORS(cfg, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := gin.New()
+		r.Use(mw)
+		r.GET("/products", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		req := httptest.NewRequest(http.MethodOptions, "/products", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	cases := []struct {
+		env, origin string
+		allowed     bool
+	}{
+		{"staging", "https://staging-ui.example.com", true},
+		{"production", "https://staging-ui.example.com", false},
+		{"production", "https://www.comparehub.app", true},
+		{"development", "http://localhost:5173", true}, // built-in profile
+		{"production", "http://localhost:5173", false},
+	}
+	for _, tc := range cases {
+		w := preflight(tc.env, tc.origin)
+		got := w.Header().Get("Access-Control-Allow-Origin")
+		if tc.allowed {
+			if got != tc.origin || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+				t.Errorf("%s %s: allow-origin=%q credentials=%q", tc.env, tc.origin, got, w.Header().Get("Access-Control-Allow-Credentials"))
+			}
+		} else if got != "" || w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: status %d allow-origin=%q, want rejection", tc.env, tc.origin, w.Code, got)
+		}
+	}
+}
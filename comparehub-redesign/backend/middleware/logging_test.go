@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/api"
+)
+
+func TestLogsCarryRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(prev)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID(), AccessLog(), Recovery())
+	r.GET("/fail", func(c *gin.Context) { api.Abort(c, errors.New("boom")) })
+	r.GET("/panic", func(c *gin.Context) { panic("kaboom") })
+
+	for _, path := range []string{"/fail", "/panic"} {
+		buf.Reset()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(RequestIDHeader, "trace-"+path[1:])
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != 500 {
+			t.Errorf("%s: status = %d", path, w.Code)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("%s: want an error line and an access line, got %q", path, lines)
+		}
+		for _, line := range lines {
+			var rec map[string]any
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatalf("%s: not JSON: %s", path, line)
+			}
+			if rec["request_id"] != "trace-"+path[1:] {
+				t.Errorf("%s: request_id = %v in %s", path, rec["request_id"], line)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/logging"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID reuses a well-formed incoming X-Request-ID (so ids survive a
+// proxy hop) or generates one, stores it under api.RequestIDKey and echoes
+// it on the response. The request context carries a logger tagged with the
+// id, and with the trace id when tracing is on (see logging.FromContext).
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(api.RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		logger := slog.Default().With("request_id", id)
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+			trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("request_id", id))
+		}
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), logger))
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts short ids made of [A-Za-z0-9._-] so a client cannot
+// inject arbitrary text into our logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
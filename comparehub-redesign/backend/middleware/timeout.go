@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Timeout bounds the request context, and with it every query the handler
+// runs. Routes are looked up as "METHOD /path" using the registered path
+// without the /v1 prefix, so one entry covers both API versions. A route
+// mapped to 0 gets no deadline; unlisted routes get def.
+func Timeout(def time.Duration, routes map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d := def
+		if rd, ok := routes[c.Request.Method+" "+strings.TrimPrefix(c.FullPath(), "/v1")]; ok {
+			d = rd
+		}
+		if d <= 0 {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
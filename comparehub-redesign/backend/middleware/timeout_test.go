@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/api"
+)
+
+func TestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Timeout(20*time.Millisecond, map[string]time.Duration{
+		"GET /unbounded": 0,
+	}))
+	// slow behaves like a handler whose query outlives the deadline.
+	slow := func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+			api.Abort(c, c.Request.Context().Err())
+		case <-time.After(time.Second):
+			c.Status(http.StatusOK)
+		}
+	}
+	r.GET("/slow", slow)
+	r.GET("/v1/slow", api.V1(), slow)
+	r.GET("/unbounded", func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); ok {
+			t.Error("route mapped to 0 got a deadline")
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/slow", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", w.Code)
+	}
+	var env api.Envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil || env.Error == nil || env.Error.Code != api.CodeTimeout {
+		t.Errorf("body = %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/unbounded", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("unbounded: status = %d", w.Code)
+	}
+
+	// A client that hangs up gets nothing written back.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil).WithContext(ctx))
+	if w.Code != api.StatusClientClosedRequest || w.Body.Len() != 0 {
+		t.Errorf("cancelled: status = %d body = %q", w.Code, w.Body)
+	}
+}
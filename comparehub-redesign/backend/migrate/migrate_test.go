@@ -0,0 +1,58 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrationsAreContiguous(t *testing.T) {
+	migs := Embedded()
+	if len(migs) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+	for i, m := range migs {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d; versions must start at 1 without gaps", i, m.Version)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("%04d_%s has an empty up or down script", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("up2")},
+		"0002_second.down.sql": {Data: []byte("down2")},
+		"0001_first.up.sql":    {Data: []byte("up1")},
+		"0001_first.down.sql":  {Data: []byte("down1")},
+	}
+	migs, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) != 2 || migs[0].Name != "first" || migs[1].Up != "up2" || migs[0].Down != "down1" {
+		t.Fatalf("unexpected migrations %+v", migs)
+	}
+}
+
+func TestLoadRejectsBadSets(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"missing down": {
+			"0001_first.up.sql": {Data: []byte("up")},
+		},
+		"name mismatch": {
+			"0001_first.up.sql":   {Data: []byte("up")},
+			"0001_other.down.sql": {Data: []byte("down")},
+		},
+		"stray file": {
+			"README.md": {Data: []byte("hi")},
+		},
+	}
+	for name, fsys := range cases {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS click_events;
+DROP TABLE IF EXISTS search_events;
+DROP TABLE IF EXISTS product_specs;
+DROP TABLE IF EXISTS offers;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS stores;
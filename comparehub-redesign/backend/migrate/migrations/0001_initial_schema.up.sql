@@ -1,6 +1,8 @@
 -- ============================
 -- CompareHub schema (tables + indexes only)
 -- ============================
+-- IF NOT EXISTS lets databases created by the old boot-time schema.sql adopt
+-- this baseline without errors.
 
 CREATE TABLE IF NOT EXISTS stores (
   id SERIAL PRIMARY KEY,
@@ -33,7 +35,7 @@ CREATE TABLE IF NOT EXISTS offers (
   UNIQUE(product_id, store_id, url)
 );
 
--- Migration for existing databases (CREATE TABLE won't apply changes).
+-- Databases created before offers.condition existed.
 ALTER TABLE offers
   ADD COLUMN IF NOT EXISTS condition TEXT NOT NULL DEFAULT 'New';
 
@@ -83,4 +85,3 @@ CREATE TABLE IF NOT EXISTS click_events (
 
 CREATE INDEX IF NOT EXISTS idx_click_events_time
 ON click_events (created_at DESC);
-
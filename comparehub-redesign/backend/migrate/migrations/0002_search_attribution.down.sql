@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_click_events_search_key;
+ALTER TABLE click_events DROP COLUMN IF EXISTS search_key;
+
+DROP INDEX IF EXISTS idx_search_events_key;
+ALTER TABLE search_events
+  DROP COLUMN IF EXISTS search_key,
+  DROP COLUMN IF EXISTS latency_ms,
+  DROP COLUMN IF EXISTS result_count,
+  DROP COLUMN IF EXISTS filters;
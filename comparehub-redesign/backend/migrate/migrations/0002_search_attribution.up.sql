@@ -0,0 +1,17 @@
+-- Filters, result size, timing and the key returned to the client as
+-- X-Search-ID so clicks can be attributed to the search that led to them.
+ALTER TABLE search_events
+  ADD COLUMN IF NOT EXISTS filters JSONB NOT NULL DEFAULT '{}'::jsonb,
+  ADD COLUMN IF NOT EXISTS result_count INT,
+  ADD COLUMN IF NOT EXISTS latency_ms INT,
+  ADD COLUMN IF NOT EXISTS search_key TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_search_events_key
+ON search_events (search_key);
+
+-- Set when the click came from a product reached through a search.
+ALTER TABLE click_events
+  ADD COLUMN IF NOT EXISTS search_key TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_click_events_search_key
+ON click_events (search_key);
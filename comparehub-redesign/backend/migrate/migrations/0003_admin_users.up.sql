@@ -0,0 +1,9 @@
+-- Admin accounts created with "comparehub create-admin". Emails are stored
+-- lower-cased. The ADMIN_EMAIL / ADMIN_PASSWORD env login keeps working.
+CREATE TABLE admin_users (
+  id SERIAL PRIMARY KEY,
+  email TEXT NOT NULL UNIQUE,
+  password_hash TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
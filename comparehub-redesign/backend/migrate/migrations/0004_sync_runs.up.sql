@@ -0,0 +1,16 @@
+-- One row per finished (non dry-run) sync or import, so readiness can
+-- report how long ago each feed source last synced successfully.
+CREATE TABLE sync_runs (
+  id BIGSERIAL PRIMARY KEY,
+  run_id TEXT NOT NULL,
+  source TEXT NOT NULL,
+  started_at TIMESTAMPTZ NOT NULL,
+  finished_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  ok BOOLEAN NOT NULL,
+  products INT NOT NULL DEFAULT 0,
+  offers INT NOT NULL DEFAULT 0,
+  errors INT NOT NULL DEFAULT 0,
+  error TEXT
+);
+
+CREATE INDEX idx_sync_runs_source_finished ON sync_runs (source, finished_at DESC) WHERE ok;
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS stores_best_offer_key ON stores;
+DROP FUNCTION IF EXISTS stores_refresh_best_offer_key();
+DROP TRIGGER IF EXISTS offers_best_offer_update ON offers;
+DROP TRIGGER IF EXISTS offers_best_offer_insert_delete ON offers;
+DROP FUNCTION IF EXISTS offers_refresh_best_offer();
+DROP FUNCTION IF EXISTS refresh_best_offer(INT, TEXT, INT);
+DROP TABLE IF EXISTS best_offers;
@@ -0,0 +1,94 @@
+-- Cheapest active offer per (product, condition, store), so listings and
+-- top deals take a min over a handful of rows per product instead of
+-- scanning and sorting every offer on each request. Kept current by a
+-- trigger on offers, inside the transaction of the write that changed it
+-- (sync upserts and deactivation, admin inserts, seed scripts alike).
+CREATE TABLE best_offers (
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  condition TEXT NOT NULL,
+  store_id INT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+  -- store.StoreKey of the store name, matched against the ?stores filter.
+  store_key TEXT NOT NULL,
+  offer_id INT NOT NULL,
+  price NUMERIC(10,2) NOT NULL,
+  rating NUMERIC(3,1),
+  url TEXT NOT NULL,
+  PRIMARY KEY (product_id, condition, store_id)
+);
+
+CREATE INDEX idx_best_offers_price ON best_offers (price, product_id);
+
+-- refresh_best_offer recomputes one (product, condition, store) cell. The
+-- product row lock serializes concurrent writers to the same product, and
+-- each statement below takes a fresh snapshot, so the last writer always
+-- sees the others' committed offers.
+CREATE FUNCTION refresh_best_offer(p_product INT, p_condition TEXT, p_store INT) RETURNS void
+LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM 1 FROM products WHERE id = p_product FOR NO KEY UPDATE;
+
+  DELETE FROM best_offers
+  WHERE product_id = p_product AND condition = p_condition AND store_id = p_store;
+
+  INSERT INTO best_offers (product_id, condition, store_id, store_key, offer_id, price, rating, url)
+  SELECT o.product_id, o.condition, o.store_id, lower(replace(s.name, ' ', '')), o.id, o.price, o.rating, o.url
+  FROM offers o
+  JOIN stores s ON s.id = o.store_id
+  JOIN products p ON p.id = o.product_id
+  WHERE o.product_id = p_product AND o.condition = p_condition AND o.store_id = p_store AND o.active
+  ORDER BY o.price ASC, o.rating DESC NULLS LAST, o.id ASC
+  LIMIT 1;
+END;
+$$;
+
+CREATE FUNCTION offers_refresh_best_offer() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+  IF TG_OP IN ('UPDATE', 'DELETE') THEN
+    PERFORM refresh_best_offer(OLD.product_id, OLD.condition, OLD.store_id);
+  END IF;
+  IF TG_OP IN ('INSERT', 'UPDATE') AND
+     (TG_OP = 'INSERT' OR (OLD.product_id, OLD.condition, OLD.store_id) IS DISTINCT FROM (NEW.product_id, NEW.condition, NEW.store_id)) THEN
+    PERFORM refresh_best_offer(NEW.product_id, NEW.condition, NEW.store_id);
+  END IF;
+  RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER offers_best_offer_insert_delete
+AFTER INSERT OR DELETE ON offers
+FOR EACH ROW EXECUTE FUNCTION offers_refresh_best_offer();
+
+-- Sync touches last_seen_at on every offer of every run; only changes that
+-- can move the best offer pay for a refresh.
+CREATE TRIGGER offers_best_offer_update
+AFTER UPDATE ON offers
+FOR EACH ROW
+WHEN ((OLD.product_id, OLD.store_id, OLD.condition, OLD.price, OLD.rating, OLD.url, OLD.active)
+      IS DISTINCT FROM
+      (NEW.product_id, NEW.store_id, NEW.condition, NEW.price, NEW.rating, NEW.url, NEW.active))
+EXECUTE FUNCTION offers_refresh_best_offer();
+
+-- Store upserts rewrite the name on every sync; only a real rename has to
+-- rewrite the keys.
+CREATE FUNCTION stores_refresh_best_offer_key() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+  UPDATE best_offers SET store_key = lower(replace(NEW.name, ' ', '')) WHERE store_id = NEW.id;
+  RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER stores_best_offer_key
+AFTER UPDATE OF name ON stores
+FOR EACH ROW
+WHEN (OLD.name IS DISTINCT FROM NEW.name)
+EXECUTE FUNCTION stores_refresh_best_offer_key();
+
+INSERT INTO best_offers (product_id, condition, store_id, store_key, offer_id, price, rating, url)
+SELECT DISTINCT ON (o.product_id, o.condition, o.store_id)
+  o.product_id, o.condition, o.store_id, lower(replace(s.name, ' ', '')), o.id, o.price, o.rating, o.url
+FROM offers o
+JOIN stores s ON s.id = o.store_id
+WHERE o.active
+ORDER BY o.product_id, o.condition, o.store_id, o.price ASC, o.rating DESC NULLS LAST, o.id ASC;
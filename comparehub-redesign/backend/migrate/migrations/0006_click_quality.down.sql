@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_click_events_visitor;
+ALTER TABLE click_events
+  DROP COLUMN IF EXISTS is_duplicate,
+  DROP COLUMN IF EXISTS is_bot,
+  DROP COLUMN IF EXISTS referrer,
+  DROP COLUMN IF EXISTS user_agent,
+  DROP COLUMN IF EXISTS ip_hash,
+  DROP COLUMN IF EXISTS visitor_key,
+  DROP COLUMN IF EXISTS session_id;
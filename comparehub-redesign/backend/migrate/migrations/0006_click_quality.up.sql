@@ -0,0 +1,18 @@
+-- Who clicked, anonymized, and whether the click counts. Bot clicks and
+-- repeats of a counted click by the same visitor are kept for the raw
+-- totals but left out of analytics. session_id and ip_hash are keyed
+-- hashes; visitor_key is session_id or, without a session, a hash of IP
+-- and user agent.
+ALTER TABLE click_events
+  ADD COLUMN IF NOT EXISTS session_id TEXT,
+  ADD COLUMN IF NOT EXISTS visitor_key TEXT,
+  ADD COLUMN IF NOT EXISTS ip_hash TEXT,
+  ADD COLUMN IF NOT EXISTS user_agent TEXT,
+  ADD COLUMN IF NOT EXISTS referrer TEXT,
+  ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS is_duplicate BOOLEAN NOT NULL DEFAULT false;
+
+-- The duplicate check looks for a recent counted click by the visitor.
+CREATE INDEX IF NOT EXISTS idx_click_events_visitor
+ON click_events (visitor_key, product_id, created_at DESC)
+WHERE NOT is_bot AND NOT is_duplicate;
@@ -0,0 +1,5 @@
+-- Query parameters GET /go/:offerId adds to a store's offer URLs, e.g.
+-- {"tag": "comparehub-20"}. A parameter already in the URL is replaced.
+ALTER TABLE stores
+  ADD COLUMN IF NOT EXISTS affiliate_params JSONB NOT NULL DEFAULT '{}'::jsonb
+  CHECK (jsonb_typeof(affiliate_params) = 'object');
@@ -0,0 +1,17 @@
+-- Product detail views, the denominator of click-through rates. Visitor
+-- fields are anonymized like click_events'; bot views are kept but not
+-- counted.
+CREATE TABLE product_views (
+  id BIGSERIAL PRIMARY KEY,
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  session_id TEXT,
+  visitor_key TEXT,
+  ip_hash TEXT,
+  user_agent TEXT,
+  referrer TEXT,
+  is_bot BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_product_views_time ON product_views (created_at DESC);
+CREATE INDEX idx_product_views_product ON product_views (product_id, created_at DESC);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS product_views_coview ON product_views;
+DROP FUNCTION IF EXISTS product_views_coview();
+DROP TABLE IF EXISTS product_coviews;
+DROP INDEX IF EXISTS idx_product_views_visitor;
+ALTER TABLE product_views DROP COLUMN IF EXISTS is_duplicate;
@@ -0,0 +1,57 @@
+-- A view repeating a counted view by the same visitor within the dedupe
+-- window is kept but not counted, like a duplicate click.
+ALTER TABLE product_views ADD COLUMN is_duplicate BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX idx_product_views_visitor
+ON product_views (visitor_key, created_at DESC)
+WHERE NOT is_bot AND NOT is_duplicate;
+
+-- "Viewed together": visitors is the number of visitors (visitor keys
+-- rotate daily, so visitor-days) with counted views of both products
+-- within a day. Rows come in pairs, one per direction.
+CREATE TABLE product_coviews (
+  product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  other_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  visitors BIGINT NOT NULL DEFAULT 0,
+  last_viewed_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (product_id, other_id)
+);
+
+CREATE INDEX idx_product_coviews_rank ON product_coviews (product_id, visitors DESC);
+
+-- A visitor's first counted view of a product in a day pairs it with every
+-- other product the visitor viewed that day; later views add nothing.
+CREATE FUNCTION product_views_coview() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+  IF NEW.is_bot OR NEW.is_duplicate OR NEW.visitor_key IS NULL THEN
+    RETURN NULL;
+  END IF;
+  PERFORM 1 FROM product_views
+  WHERE visitor_key = NEW.visitor_key AND product_id = NEW.product_id AND id <> NEW.id
+    AND NOT is_bot AND NOT is_duplicate
+    AND created_at >= NEW.created_at - interval '1 day';
+  IF FOUND THEN
+    RETURN NULL;
+  END IF;
+
+  INSERT INTO product_coviews (product_id, other_id, visitors, last_viewed_at)
+  SELECT pair.a, pair.b, 1, NEW.created_at
+  FROM (
+    SELECT DISTINCT product_id AS other
+    FROM product_views
+    WHERE visitor_key = NEW.visitor_key AND product_id <> NEW.product_id
+      AND NOT is_bot AND NOT is_duplicate
+      AND created_at >= NEW.created_at - interval '1 day'
+  ) o,
+  LATERAL (VALUES (NEW.product_id, o.other), (o.other, NEW.product_id)) AS pair(a, b)
+  ON CONFLICT (product_id, other_id) DO UPDATE
+  SET visitors = product_coviews.visitors + 1,
+      last_viewed_at = GREATEST(product_coviews.last_viewed_at, EXCLUDED.last_viewed_at);
+  RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER product_views_coview
+AFTER INSERT ON product_views
+FOR EACH ROW EXECUTE FUNCTION product_views_coview();
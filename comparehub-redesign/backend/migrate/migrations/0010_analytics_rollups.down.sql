@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS analytics_rollup_state;
+DROP TABLE IF EXISTS search_rollups_daily;
+DROP TABLE IF EXISTS search_rollups_hourly;
+DROP TABLE IF EXISTS event_rollups_daily;
+DROP TABLE IF EXISTS event_rollups_hourly;
@@ -0,0 +1,46 @@
+-- Aggregates of the raw analytics events, maintained by the rollup job
+-- (package rollup). Buckets are UTC hours and UTC days. Analytics queries
+-- read these instead of scanning click_events, product_views and
+-- search_events, which are purged after analytics.retention.
+
+-- Views and clicks per product and store. product_id is 0 for clicks
+-- without a product; store_id is 0 for views and for clicks on an unknown
+-- store. views and clicks are the counted ones.
+CREATE TABLE event_rollups_hourly (
+  bucket TIMESTAMPTZ NOT NULL,
+  product_id BIGINT NOT NULL,
+  store_id BIGINT NOT NULL,
+  views BIGINT NOT NULL DEFAULT 0,
+  view_bots BIGINT NOT NULL DEFAULT 0,
+  view_duplicates BIGINT NOT NULL DEFAULT 0,
+  clicks BIGINT NOT NULL DEFAULT 0,
+  click_bots BIGINT NOT NULL DEFAULT 0,
+  click_duplicates BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (bucket, product_id, store_id)
+);
+
+CREATE TABLE event_rollups_daily (LIKE event_rollups_hourly INCLUDING ALL);
+
+-- Searches per normalized query (lower(trim(query)), '' when browsing).
+-- clicked_searches and clicks cover searches with results and the counted
+-- clicks attributed to them through search_key, as far as they had
+-- happened when the bucket was last rolled up.
+CREATE TABLE search_rollups_hourly (
+  bucket TIMESTAMPTZ NOT NULL,
+  query TEXT NOT NULL,
+  searches BIGINT NOT NULL DEFAULT 0,
+  zero_results BIGINT NOT NULL DEFAULT 0,
+  clicked_searches BIGINT NOT NULL DEFAULT 0,
+  clicks BIGINT NOT NULL DEFAULT 0,
+  last_zero_result_at TIMESTAMPTZ,
+  PRIMARY KEY (bucket, query)
+);
+
+CREATE TABLE search_rollups_daily (LIKE search_rollups_hourly INCLUDING ALL);
+
+-- Raw events before rolled_until have been rolled up. A single row.
+CREATE TABLE analytics_rollup_state (
+  id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+  rolled_until TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
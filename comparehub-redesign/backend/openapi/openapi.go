@@ -0,0 +1,503 @@
+// Package openapi builds the OpenAPI 3 document served at /openapi.json.
+//
+// Request and response schemas are reflected from the handler types, so a
+// field added to store.ProductRow shows up in the spec without edits here.
+// Routes themselves are listed in Routes; main_test.go fails when a route
+// registered on the gin engine is missing from that list.
+package openapi
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/cache"
+	"go-ecommerce-backend/handlers"
+	"go-ecommerce-backend/health"
+	"go-ecommerce-backend/store"
+)
+
+// Param is a query, path or header parameter.
+type Param struct {
+	Name        string
+	In          string // query | path | header
+	Type        string // string | integer | number | boolean
+	Description string
+	Required    bool
+	Enum        []string
+}
+
+// Route documents one endpoint. Path uses gin syntax (/products/:id).
+type Route struct {
+	Method  string
+	Path    string
+	Tag     string
+	Summary string
+	Params  []Param
+	Body    any // request body (Go zero value or Schema), nil if none
+	Data    any // v1 "data" payload
+	Legacy  any // legacy response body; nil means same as Data
+	Admin   bool
+	// Unversioned routes are not mounted under /v1.
+	Unversioned bool
+	// Redirect describes where the route sends the client with a 302
+	// instead of answering 200 with Data.
+	Redirect string
+	// Download lists the media types of a file the route streams instead
+	// of a JSON body (Data is unused).
+	Download []string
+}
+
+var filterParams = []Param{
+	{Name: "condition", In: "query", Type: "string", Description: "Offer condition (New, Used, Any). Defaults to Any."},
+	{Name: "stores", In: "query", Type: "string", Description: "Comma-separated store names, e.g. Amazon,Best Buy,Walmart."},
+}
+
+func params(ps ...[]Param) []Param {
+	out := []Param{}
+	for _, p := range ps {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// conditionalParams are honoured by the routes behind
+// middleware.Conditional, which answer 304 when they match.
+var conditionalParams = []Param{
+	{Name: "If-None-Match", In: "header", Type: "string", Description: "ETag of a cached copy; 304 if unchanged."},
+	{Name: "If-Modified-Since", In: "header", Type: "string", Description: "HTTP date; 304 if not modified since (If-None-Match wins)."},
+}
+
+var idParam = []Param{{Name: "id", In: "path", Type: "integer", Required: true}}
+
+var okBody = Object{"ok": true}
+
+var summaryData = Object{
+	"trendingProducts": []store.TrendingProduct{},
+	"storeClicks":      []store.StoreClicks{},
+	"topSearches":      []store.TopSearch{},
+	"clickCounts":      store.ClickCounts{},
+	"mostViewed":       []store.ViewedProduct{},
+	"viewCounts":       store.ViewCounts{},
+}
+
+// Routes lists every endpoint registered in main.go.
+var Routes = []Route{
+	{
+		Method: "GET", Path: "/health", Tag: "system", Summary: "Shallow liveness probe (kept for existing deploys; prefer /livez)",
+		Data: Object{"status": ""}, Unversioned: true,
+	},
+	{
+		Method: "GET", Path: "/livez", Tag: "system", Summary: "Liveness probe with build version and commit",
+		Data: Object{"status": "", "build": health.BuildInfo{}, "uptimeSeconds": 0}, Unversioned: true,
+	},
+	{
+		// 503 when the database is unreachable or migrations are pending;
+		// 200 with status "degraded" when a feed source has gone stale.
+		Method: "GET", Path: "/readyz", Tag: "system", Summary: "Readiness probe: database, migrations and sync freshness",
+		Data: health.Report{}, Unversioned: true,
+	},
+	{
+		Method: "GET", Path: "/go/:offerId", Tag: "analytics", Summary: "Record an outbound click and redirect to the store",
+		Params: []Param{
+			{Name: "offerId", In: "path", Type: "integer", Required: true},
+			{Name: "s", In: "query", Type: "string", Description: "X-Search-ID of the search that led here."},
+			{Name: "sid", In: "query", Type: "string", Description: "Browser session id, for deduplication."},
+		},
+		Redirect: "The offer URL with the store's affiliate parameters", Unversioned: true,
+	},
+	{
+		Method: "GET", Path: "/openapi.json", Tag: "system", Summary: "This document",
+		Data: Schema{"type": "object"}, Unversioned: true,
+	},
+	{
+		// Prometheus text format. Needs "Bearer <METRICS_TOKEN>" when a
+		// token is configured; not mounted here when metrics.addr is set.
+		Method: "GET", Path: "/metrics", Tag: "system", Summary: "Prometheus metrics",
+		Data: Schema{"type": "string"}, Unversioned: true,
+	},
+	{
+		Method: "GET", Path: "/products", Tag: "products", Summary: "Search and list products with their best offer",
+		Params: params([]Param{
+			{Name: "q", In: "query", Type: "string", Description: "Matches product name or brand."},
+			{Name: "category", In: "query", Type: "string", Description: "Category name or all."},
+			{Name: "brand", In: "query", Type: "string", Description: "Brand name or all."},
+			{Name: "sort", In: "query", Type: "string", Enum: []string{"low", "high", "rating"}},
+			{Name: "minPrice", In: "query", Type: "number"},
+			{Name: "maxPrice", In: "query", Type: "number"},
+			{Name: "minRating", In: "query", Type: "number"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Page size (default 24, max 100)."},
+			{Name: "page", In: "query", Type: "integer", Description: "Legacy offset paging, ignored with cursors."},
+			{Name: "cursor", In: "query", Type: "string", Description: "Opaque nextCursor from the previous page."},
+			{Name: "withTotal", In: "query", Type: "boolean", Description: "Include the total match count."},
+			{Name: "X-API-Version", In: "header", Type: "integer", Description: "Legacy route only: 2 returns a ProductPage."},
+		}, filterParams, conditionalParams),
+		Data:   []store.ProductRow{},
+		Legacy: OneOf{[]store.ProductRow{}, handlers.ProductPage{}},
+	},
+	{
+		Method: "GET", Path: "/products/:id", Tag: "products", Summary: "Product details, offers and specs",
+		Params: params(idParam, filterParams, conditionalParams,
+			[]Param{{Name: "X-Session-ID", In: "header", Type: "string", Description: "Browser session id; the view is recorded for click-through analytics."}}),
+		Data: handlers.ProductDetail{},
+	},
+	{
+		Method: "GET", Path: "/products/:id/offers", Tag: "products", Summary: "Offers for a product",
+		Params: params(idParam, filterParams, conditionalParams),
+		Data:   []handlers.OfferRow{},
+		Legacy: Object{"offers": []handlers.OfferRow{}},
+	},
+	{
+		Method: "GET", Path: "/products/:id/also-viewed", Tag: "products", Summary: "Products viewed by the same visitors",
+		Params: params(idParam, []Param{
+			{Name: "limit", In: "query", Type: "integer", Description: "Default 6, max 24."},
+		}, filterParams, conditionalParams),
+		Data: []handlers.AlsoViewedProduct{},
+	},
+	{
+		Method: "GET", Path: "/compare", Tag: "products", Summary: "Side-by-side comparison of 2+ products",
+		Params: params([]Param{
+			{Name: "ids", In: "query", Type: "string", Required: true, Description: "Comma-separated product ids, e.g. 1,2,3."},
+		}, filterParams, conditionalParams),
+		Data: []handlers.CompareProduct{},
+		Legacy: Object{
+			"products": []handlers.CompareProduct{},
+			"filters":  Object{"condition": "", "stores": []string{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/analytics/top-deals", Tag: "analytics", Summary: "Cheapest products by best offer",
+		Params: filterParams,
+		Data:   []store.TopDealRow{},
+	},
+	{
+		Method: "POST", Path: "/track/click", Tag: "analytics", Summary: "Record an outbound offer click (prefer the offer's /go link)",
+		Body:   handlers.TrackClickReq{},
+		Params: []Param{{Name: "X-Session-ID", In: "header", Type: "string", Description: "Browser session id, when the body has no sessionId."}},
+		Data:   Object{"ok": true, "storeId": sql.NullInt64{}, "offerId": sql.NullInt64{}, "counted": true},
+	},
+	{
+		Method: "POST", Path: "/auth/login", Tag: "auth", Summary: "Exchange admin credentials for a JWT",
+		Body: handlers.LoginReq{},
+		Data: Object{"token": ""},
+	},
+	{
+		Method: "POST", Path: "/admin/products", Tag: "admin", Summary: "Create a product",
+		Body: handlers.CreateProductReq{}, Data: Object{"id": 0}, Admin: true,
+	},
+	{
+		Method: "POST", Path: "/admin/offers", Tag: "admin", Summary: "Create an offer",
+		Body: handlers.CreateOfferReq{}, Data: okBody, Admin: true,
+	},
+	{
+		Method: "POST", Path: "/admin/specs", Tag: "admin", Summary: "Create or replace product specs",
+		Body: handlers.UpsertSpecsReq{}, Data: okBody, Admin: true,
+	},
+	{
+		Method: "POST", Path: "/admin/sync-now", Tag: "admin", Summary: "Import the configured feed now",
+		Data: okBody, Admin: true,
+	},
+	{
+		Method: "GET", Path: "/admin/analytics/summary", Tag: "admin", Summary: "Trending products, store clicks, top searches and most viewed products",
+		Data: summaryData, Admin: true,
+	},
+	{
+		Method: "GET", Path: "/analytics/summary", Tag: "admin", Summary: "Alias of /admin/analytics/summary, kept until clients migrate",
+		Data: summaryData, Admin: true,
+	},
+	{
+		Method: "GET", Path: "/admin/analytics/searches", Tag: "admin", Summary: "Search quality report",
+		Params: []Param{{Name: "days", In: "query", Type: "integer", Description: "Window in whole UTC days before today, plus today (default 7, max 90)."}},
+		Data: Object{
+			"zeroResults": []store.ZeroResultQuery{},
+			"noClicks":    []store.QueryConversion{},
+			"conversion":  []store.QueryConversion{},
+		},
+		Legacy: Object{
+			"days":        0,
+			"asOf":        "",
+			"zeroResults": []store.ZeroResultQuery{},
+			"noClicks":    []store.QueryConversion{},
+			"conversion":  []store.QueryConversion{},
+		},
+		Admin: true,
+	},
+	{
+		Method: "GET", Path: "/admin/analytics/clicks", Tag: "admin", Summary: "Views, clicks and click-through rate over time",
+		Params: []Param{
+			{Name: "from", In: "query", Type: "string", Description: "Start date (YYYY-MM-DD) or RFC 3339 time. Defaults to 30 days before to."},
+			{Name: "to", In: "query", Type: "string", Description: "Exclusive end date or time. Defaults to now."},
+			{Name: "granularity", In: "query", Type: "string", Description: "UTC bucket size (default day); weeks start on Monday. Hourly reports cannot start before the retention cutoff.", Enum: store.Granularities},
+			{Name: "groupBy", In: "query", Type: "string", Description: "Split the report; store groups have no views.", Enum: store.ClickGroupBys},
+			{Name: "limit", In: "query", Type: "integer", Description: "Groups kept, most clicked first (default 20, max 100)."},
+		},
+		Data: Object{
+			"totals": store.ClickTotals{},
+			"series": []store.ClickPoint{},
+			"groups": []store.ClickGroup{},
+		},
+		Legacy: Object{
+			"from":        "",
+			"to":          "",
+			"granularity": "",
+			"groupBy":     "",
+			"asOf":        "",
+			"totals":      store.ClickTotals{},
+			"series":      []store.ClickPoint{},
+			"groups":      []store.ClickGroup{},
+		},
+		Admin: true,
+	},
+	{
+		Method: "GET", Path: "/admin/analytics/export", Tag: "admin", Summary: "Download analytics events or rollups as CSV or NDJSON",
+		Params: []Param{
+			{Name: "dataset", In: "query", Type: "string", Required: true, Description: "Raw events, or their rollups (see granularity).", Enum: store.ExportDatasets},
+			{Name: "from", In: "query", Type: "string", Description: "Start date (YYYY-MM-DD) or RFC 3339 time. Defaults to 30 days before to."},
+			{Name: "to", In: "query", Type: "string", Description: "Exclusive end date or time. Defaults to now."},
+			{Name: "format", In: "query", Type: "string", Description: "File format (default csv).", Enum: handlers.ExportFormats},
+			{Name: "granularity", In: "query", Type: "string", Description: "Rollup table read by the rollup datasets (default day).", Enum: handlers.ExportGranularities},
+		},
+		Download: []string{"text/csv", "application/x-ndjson"}, Admin: true,
+	},
+	{
+		// Hit/miss counters are per instance; with the redis backend the
+		// generation and invalidations are shared.
+		Method: "GET", Path: "/admin/cache/stats", Tag: "admin", Summary: "Response cache statistics",
+		Data: cache.Stats{}, Admin: true,
+	},
+	{
+		Method: "POST", Path: "/admin/cache/invalidate", Tag: "admin", Summary: "Drop every cached catalog read",
+		Data: okBody, Admin: true,
+	},
+}
+
+// PathFromGin converts /products/:id to /products/{id}.
+func PathFromGin(p string) string {
+	parts := strings.Split(p, "/")
+	for i, s := range parts {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			parts[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Document returns the full OpenAPI 3 document.
+func Document() Schema {
+	g := &generator{components: map[string]Schema{}}
+	paths := Schema{}
+
+	add := func(path, method string, op Schema) {
+		item, _ := paths[path].(Schema)
+		if item == nil {
+			item = Schema{}
+			paths[path] = item
+		}
+		item[strings.ToLower(method)] = op
+	}
+
+	for _, r := range Routes {
+		if r.Unversioned {
+			add(PathFromGin(r.Path), r.Method, g.operation(r, false))
+			continue
+		}
+		add(PathFromGin("/v1"+r.Path), r.Method, g.operation(r, true))
+		add(PathFromGin(r.Path), r.Method, g.operation(r, false))
+	}
+
+	schemas := Schema{
+		"ErrorEnvelope": Schema{
+			"type": "object",
+			"properties": Schema{
+				"error": Schema{
+					"type": "object",
+					"properties": Schema{
+						"code": Schema{"type": "string", "enum": []string{
+							"invalid_argument", "unauthorized", "forbidden", "not_found", "conflict", "timeout", "rate_limited", "internal",
+						}},
+						"message":   Schema{"type": "string"},
+						"details":   Schema{},
+						"requestId": Schema{"type": "string"},
+					},
+					"required": []string{"code", "message"},
+				},
+			},
+			"required": []string{"error"},
+		},
+		"LegacyError": Schema{
+			"type":       "object",
+			"properties": Schema{"error": Schema{"type": "string"}, "requestId": Schema{"type": "string"}},
+			"required":   []string{"error"},
+		},
+	}
+	for name, s := range g.components {
+		schemas[name] = s
+	}
+
+	return Schema{
+		"openapi": "3.0.3",
+		"info": Schema{
+			"title":       "CompareHub API",
+			"version":     "1.0.0",
+			"description": "Routes under /v1 wrap every response in {data, meta} or {error}. Unversioned routes are deprecated aliases with their historical shapes.",
+		},
+		"paths": paths,
+		"components": Schema{
+			"schemas": schemas,
+			"securitySchemes": Schema{
+				"bearerAuth": Schema{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+func (g *generator) operation(r Route, v1 bool) Schema {
+	op := Schema{
+		"operationId": operationID(r, v1),
+		"summary":     r.Summary,
+		"tags":        []string{r.Tag},
+	}
+	if !v1 && !r.Unversioned {
+		op["deprecated"] = true
+	}
+
+	if len(r.Params) > 0 {
+		ps := []Schema{}
+		for _, p := range r.Params {
+			if p.In == "header" && v1 {
+				continue
+			}
+			s := Schema{"type": p.Type}
+			if len(p.Enum) > 0 {
+				s["enum"] = p.Enum
+			}
+			param := Schema{"name": p.Name, "in": p.In, "required": p.Required, "schema": s}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			ps = append(ps, param)
+		}
+		op["parameters"] = ps
+	}
+
+	if r.Body != nil {
+		op["requestBody"] = Schema{
+			"required": true,
+			"content":  Schema{"application/json": Schema{"schema": g.schema(r.Body)}},
+		}
+	}
+
+	var body, errBody Schema
+	if v1 {
+		body = Schema{
+			"type": "object",
+			"properties": Schema{
+				"data": g.schema(r.Data),
+				"meta": Schema{"type": "object", "additionalProperties": true},
+			},
+			"required": []string{"data"},
+		}
+		errBody = Schema{"$ref": "#/components/schemas/ErrorEnvelope"}
+	} else {
+		legacy := r.Legacy
+		if legacy == nil {
+			legacy = r.Data
+		}
+		body = g.schema(legacy)
+		errBody = Schema{"$ref": "#/components/schemas/LegacyError"}
+	}
+	ok := Schema{
+		"description": "OK",
+		"content":     Schema{"application/json": Schema{"schema": body}},
+	}
+	status := "200"
+	if len(r.Download) > 0 {
+		content := Schema{}
+		for _, t := range r.Download {
+			content[t] = Schema{"schema": Schema{"type": "string", "format": "binary"}}
+		}
+		ok = Schema{
+			"description": "File download, streamed in chunks",
+			"headers":     Schema{"Content-Disposition": Schema{"schema": Schema{"type": "string"}}},
+			"content":     content,
+		}
+	}
+	if r.Redirect != "" {
+		status = "302"
+		ok = Schema{
+			"description": r.Redirect,
+			"headers":     Schema{"Location": Schema{"schema": Schema{"type": "string", "format": "uri"}}},
+		}
+	}
+	op["responses"] = Schema{
+		status: ok,
+		"429": Schema{
+			"description": "Rate limited or login locked out",
+			"headers":     Schema{"Retry-After": Schema{"description": "Seconds to wait", "schema": Schema{"type": "integer"}}},
+			"content":     Schema{"application/json": Schema{"schema": errBody}},
+		},
+		"default": Schema{
+			"description": "Error",
+			"content":     Schema{"application/json": Schema{"schema": errBody}},
+		},
+	}
+
+	if r.Admin {
+		op["security"] = []Schema{{"bearerAuth": []string{}}}
+	}
+	return op
+}
+
+// operationID builds a stable id such as getProductsById or v1PostAdminOffers.
+func operationID(r Route, v1 bool) string {
+	var b strings.Builder
+	if v1 {
+		b.WriteString("v1")
+	}
+	method := strings.ToLower(r.Method)
+	if v1 {
+		method = strings.ToUpper(method[:1]) + method[1:]
+	}
+	b.WriteString(method)
+	for _, seg := range strings.FieldsFunc(r.Path, func(c rune) bool { return c == '/' || c == '-' || c == '.' }) {
+		if strings.HasPrefix(seg, ":") {
+			seg = "by-" + seg[1:]
+		}
+		for _, w := range strings.Split(seg, "-") {
+			if w != "" {
+				b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+			}
+		}
+	}
+	return b.String()
+}
+
+// Operations returns "METHOD /path" for every operation in doc, sorted.
+func Operations(doc Schema) []string {
+	out := []string{}
+	paths, _ := doc["paths"].(Schema)
+	for p, item := range paths {
+		for m := range item.(Schema) {
+			out = append(out, strings.ToUpper(m)+" "+p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+var (
+	docOnce sync.Once
+	docJSON Schema
+)
+
+// Handler serves the document, built once on first request.
+func Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docOnce.Do(func() { docJSON = Document() })
+		c.JSON(http.StatusOK, docJSON)
+	}
+}
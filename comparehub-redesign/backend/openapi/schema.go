@@ -0,0 +1,131 @@
+package openapi
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema is an OpenAPI schema object. A Schema passed where a Go value is
+// expected is used verbatim instead of being reflected.
+type Schema map[string]any
+
+// Object describes an ad-hoc JSON object (typically a gin.H response).
+// Values are Go zero values or Schemas, exactly like Route.Data.
+type Object map[string]any
+
+// OneOf describes a body that can take one of several shapes.
+type OneOf []any
+
+// generator turns Go values into schemas, collecting named structs under
+// components/schemas so they are emitted once and referenced by $ref.
+type generator struct {
+	components map[string]Schema
+}
+
+func (g *generator) schema(v any) Schema {
+	switch x := v.(type) {
+	case nil:
+		return Schema{}
+	case Schema:
+		return x
+	case Object:
+		props := Schema{}
+		required := []string{}
+		for name, pv := range x {
+			props[name] = g.schema(pv)
+			required = append(required, name)
+		}
+		sort.Strings(required)
+		return Schema{"type": "object", "properties": props, "required": required}
+	case OneOf:
+		alts := make([]Schema, 0, len(x))
+		for _, alt := range x {
+			alts = append(alts, g.schema(alt))
+		}
+		return Schema{"oneOf": alts}
+	}
+	return g.schemaOf(reflect.TypeOf(v))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *generator) schemaOf(t reflect.Type) Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		inner := g.schemaOf(t.Elem())
+		if _, isRef := inner["$ref"]; isRef {
+			return Schema{"allOf": []Schema{inner}, "nullable": true}
+		}
+		out := Schema{"nullable": true}
+		for k, v := range inner {
+			out[k] = v
+		}
+		return out
+	case reflect.Struct:
+		if t == timeType {
+			return Schema{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.components[t.Name()]; !ok {
+			// Reserve the name first so self-referencing types terminate.
+			g.components[t.Name()] = Schema{}
+			g.components[t.Name()] = g.structSchema(t)
+		}
+		return Schema{"$ref": "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "format": "byte"}
+		}
+		return Schema{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Interface:
+		return Schema{}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int64, reflect.Uint64:
+		return Schema{"type": "integer", "format": "int64"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	}
+	return Schema{}
+}
+
+// structSchema follows encoding/json rules: exported fields only, names from
+// the json tag, "-" skipped, omitempty fields are optional.
+func (g *generator) structSchema(t reflect.Type) Schema {
+	props := Schema{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schemaOf(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	s := Schema{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/metrics"
+)
+
+// Middleware gives every client IP a bucket per route. Routes are keyed
+// like middleware.Timeout ("POST /track/click", without /v1); a route
+// missing from routes gets def, and an Off limit is not counted at all.
+// When b fails the request goes through: an outage of the limiter should
+// not take the API down with it.
+func Middleware(b Backend, def Limit, routes map[string]Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + strings.TrimPrefix(c.FullPath(), "/v1")
+		l, ok := routes[route]
+		if !ok {
+			l = def
+		}
+		if l.Off() {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		d, err := b.Take(ctx, route+"|"+c.ClientIP(), l)
+		if err != nil {
+			logging.FromContext(ctx).Warn("rate limit check failed", "route", route, "err", err)
+			c.Next()
+			return
+		}
+		if !d.Allowed {
+			metrics.RateLimited(route, "rate")
+			Reject(c, d.RetryAfter, "too many requests")
+			return
+		}
+		c.Next()
+	}
+}
+
+// Reject answers 429 with Retry-After in whole seconds, rounded up.
+func Reject(c *gin.Context, retryAfter time.Duration, message string) {
+	secs := max(1, int(math.Ceil(retryAfter.Seconds())))
+	c.Header("Retry-After", strconv.Itoa(secs))
+	api.Fail(c, http.StatusTooManyRequests, api.CodeRateLimited, message, gin.H{"retryAfterSeconds": secs})
+}
+
+// Lockout locks an account for one client IP after MaxFailures failed
+// attempts from that IP within the lockout period, for that period. Keying
+// by IP too means nobody can lock the real admin out by failing on purpose
+// from elsewhere. Like Middleware it fails open, and a nil *Lockout never
+// locks.
+type Lockout struct {
+	backend     Backend
+	maxFailures int
+	period      time.Duration
+}
+
+// NewLockout returns a Lockout keeping its state in b.
+func NewLockout(b Backend, maxFailures int, period time.Duration) *Lockout {
+	return &Lockout{backend: b, maxFailures: maxFailures, period: period}
+}
+
+func lockoutKey(account, clientIP string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(account)) + "|" + clientIP
+}
+
+// Locked returns how long account stays locked for clientIP; 0 when it is
+// not.
+func (l *Lockout) Locked(ctx context.Context, account, clientIP string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	d, err := l.backend.Locked(ctx, lockoutKey(account, clientIP))
+	if err != nil {
+		logging.FromContext(ctx).Warn("lockout check failed", "err", err)
+	}
+	return d
+}
+
+// Fail records a failed attempt from clientIP and locks account for that
+// IP once it has failed MaxFailures times; it returns how long the new
+// lock lasts, or 0.
+func (l *Lockout) Fail(ctx context.Context, account, clientIP string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	key := lockoutKey(account, clientIP)
+	n, err := l.backend.Fail(ctx, key, l.period)
+	if err == nil && n >= l.maxFailures {
+		if err = l.backend.Lock(ctx, key, l.period); err == nil {
+			logging.FromContext(ctx).Warn("login locked out", "failures", n, "for", l.period, "client_ip", clientIP)
+			return l.period
+		}
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn("lockout update failed", "err", err)
+	}
+	return 0
+}
+
+// Reset forgets account's failures from clientIP after a successful login.
+func (l *Lockout) Reset(ctx context.Context, account, clientIP string) {
+	if l == nil {
+		return
+	}
+	if err := l.backend.Reset(ctx, lockoutKey(account, clientIP)); err != nil {
+		logging.FromContext(ctx).Warn("lockout reset failed", "err", err)
+	}
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Memory is the in-process Backend. Entries that could no longer affect a
+// decision (full buckets, expired windows and locks) are swept once a
+// minute, so memory stays proportional to recently active clients.
+type Memory struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	buckets   map[string]*bucket
+	failures  map[string]*failures
+	locks     map[string]time.Time // key -> unlock time
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when tokens reach the burst again
+}
+
+type failures struct {
+	count int
+	until time.Time
+}
+
+// NewMemory returns an empty Memory backend reading time from now
+// (time.Now when nil).
+func NewMemory(now func() time.Time) *Memory {
+	if now == nil {
+		now = time.Now
+	}
+	return &Memory{
+		now:      now,
+		buckets:  map[string]*bucket{},
+		failures: map[string]*failures{},
+		locks:    map[string]time.Time{},
+	}
+}
+
+func (m *Memory) Take(_ context.Context, key string, l Limit) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+
+	burst := float64(l.Burst)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	d := Decision{}
+	if b.tokens >= 1 {
+		b.tokens--
+		d = Decision{Allowed: true, Remaining: int(b.tokens)}
+	} else {
+		d.RetryAfter = time.Duration(math.Ceil((1-b.tokens)/l.Rate*1000)) * time.Millisecond
+	}
+	b.full = now.Add(seconds((burst - b.tokens) / l.Rate))
+	return d, nil
+}
+
+func (m *Memory) Fail(_ context.Context, key string, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	f, ok := m.failures[key]
+	if !ok || !now.Before(f.until) {
+		f = &failures{until: now.Add(window)}
+		m.failures[key] = f
+	}
+	f.count++
+	return f.count, nil
+}
+
+func (m *Memory) Lock(_ context.Context, key string, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.locks[key] = m.now().Add(d)
+	return nil
+}
+
+func (m *Memory) Locked(_ context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if left := m.locks[key].Sub(m.now()); left > 0 {
+		return left, nil
+	}
+	return 0, nil
+}
+
+func (m *Memory) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.failures, key)
+	delete(m.locks, key)
+	return nil
+}
+
+// Len is the number of live buckets, for tests.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.buckets)
+}
+
+// sweep drops what has expired, at most once a minute. Callers hold mu.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for k, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, k) // a missing bucket starts full
+		}
+	}
+	for k, f := range m.failures {
+		if !now.Before(f.until) {
+			delete(m.failures, k)
+		}
+	}
+	for k, until := range m.locks {
+		if !now.Before(until) {
+			delete(m.locks, k)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,70 @@
+// Package ratelimit throttles clients with token buckets and locks out
+// repeated login failures.
+//
+// Buckets and lockouts live in a Backend: Memory keeps them in the process
+// (each instance enforces its own limits), Redis shares them between
+// instances. Both take their clock from the caller so tests can drive time.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-ecommerce-backend/config"
+)
+
+// Limit is a token bucket: Burst tokens at most, refilled at Rate tokens
+// per second. The zero Limit is no limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// FromRate converts a configured rate ("30/m": 30 tokens, refilled over a
+// minute).
+func FromRate(r config.Rate) Limit {
+	if r.Off() {
+		return Limit{}
+	}
+	return Limit{Rate: float64(r.Requests) / r.Per.Seconds(), Burst: r.Requests}
+}
+
+// Off reports whether l lets everything through.
+func (l Limit) Off() bool { return l.Burst <= 0 || l.Rate <= 0 }
+
+// Decision is the outcome of taking a token.
+type Decision struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left after this request.
+	Remaining int
+	// RetryAfter is how long until the next token, when not Allowed.
+	RetryAfter time.Duration
+}
+
+// Backend stores buckets, failure counts and locks.
+type Backend interface {
+	// Take spends one token from bucket key under l.
+	Take(ctx context.Context, key string, l Limit) (Decision, error)
+	// Fail counts a failure for key in a window of the given length that
+	// starts at the first failure, and returns the count so far.
+	Fail(ctx context.Context, key string, window time.Duration) (int, error)
+	// Lock locks key for d.
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// Locked returns how long key stays locked; 0 when it is not.
+	Locked(ctx context.Context, key string) (time.Duration, error)
+	// Reset clears key's failures and lock.
+	Reset(ctx context.Context, key string) error
+}
+
+// New builds the backend described by cfg; the redis backend connects to
+// redisURL (cache.redisUrl).
+func New(cfg config.RateLimit, redisURL string) (Backend, error) {
+	switch cfg.Backend {
+	case "memory":
+		return NewMemory(nil), nil
+	case "redis":
+		return NewRedis(redisURL, cfg.KeyPrefix, nil)
+	}
+	return nil, fmt.Errorf("ratelimit: unknown backend %q", cfg.Backend)
+}
@@ -0,0 +1,232 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/config"
+)
+
+// clock is a fake time source the tests move by hand.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time      { return c.t }
+func (c *clock) add(d time.Duration) { c.t = c.t.Add(d) }
+func newClock() *clock               { return &clock{t: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)} }
+
+func take(t *testing.T, b Backend, key string, l Limit) Decision {
+	t.Helper()
+	d, err := b.Take(context.Background(), key, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// testBuckets runs the same scenario against any backend: a burst of 3,
+// refilled at one token every 10s.
+func testBuckets(t *testing.T, b Backend, clk *clock) {
+	l := FromRate(config.Rate{Requests: 3, Per: 30 * time.Second})
+	for i := range 3 {
+		if d := take(t, b, "a", l); !d.Allowed || d.Remaining != 2-i {
+			t.Fatalf("take %d: %+v, want allowed with %d left", i+1, d, 2-i)
+		}
+	}
+	d := take(t, b, "a", l)
+	if d.Allowed || d.RetryAfter != 10*time.Second {
+		t.Fatalf("empty bucket: %+v, want denied for 10s", d)
+	}
+	if d := take(t, b, "b", l); !d.Allowed {
+		t.Fatal("another key shares the bucket")
+	}
+
+	clk.add(4 * time.Second)
+	if d := take(t, b, "a", l); d.Allowed || d.RetryAfter != 6*time.Second {
+		t.Fatalf("after 4s: %+v, want denied for 6s", d)
+	}
+	clk.add(6 * time.Second)
+	if d := take(t, b, "a", l); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("after 10s: %+v, want one token", d)
+	}
+	// Idle time refills up to the burst, not beyond.
+	clk.add(time.Hour)
+	for range 3 {
+		if d := take(t, b, "a", l); !d.Allowed {
+			t.Fatal("bucket did not refill")
+		}
+	}
+	if d := take(t, b, "a", l); d.Allowed {
+		t.Fatal("bucket refilled past its burst")
+	}
+}
+
+func testLockout(t *testing.T, b Backend, clk *clock) {
+	ctx := context.Background()
+	lo := NewLockout(b, 3, 15*time.Minute)
+	const ip = "192.0.2.1"
+	for range 2 {
+		if d := lo.Fail(ctx, "Admin@Example.com", ip); d != 0 {
+			t.Fatalf("locked after fewer than 3 failures")
+		}
+	}
+	if d := lo.Fail(ctx, "admin@example.com ", ip); d != 15*time.Minute {
+		t.Fatalf("third failure locked for %v, want 15m", d)
+	}
+	clk.add(5 * time.Minute)
+	if d := lo.Locked(ctx, "ADMIN@example.com", ip); d <= 0 || d > 15*time.Minute {
+		t.Fatalf("Locked = %v, want a remaining lock", d)
+	}
+	if d := lo.Locked(ctx, "admin@example.com", "198.51.100.7"); d != 0 {
+		t.Fatalf("account locked for another client IP for %v", d)
+	}
+	lo.Reset(ctx, "admin@example.com", ip)
+	if d := lo.Locked(ctx, "admin@example.com", ip); d != 0 {
+		t.Fatalf("Locked after Reset = %v", d)
+	}
+	if d := lo.Locked(ctx, "other@example.com", ip); d != 0 {
+		t.Fatalf("unrelated account locked for %v", d)
+	}
+}
+
+func TestMemoryBuckets(t *testing.T) {
+	clk := newClock()
+	testBuckets(t, NewMemory(clk.now), clk)
+}
+
+func TestMemorySweepsIdleBuckets(t *testing.T) {
+	clk := newClock()
+	m := NewMemory(clk.now)
+	l := Limit{Rate: 1, Burst: 5}
+	take(t, m, "a", l)
+	take(t, m, "b", l)
+	clk.add(2 * time.Minute)
+	take(t, m, "c", l)
+	if n := m.Len(); n != 1 {
+		t.Errorf("%d buckets after sweep, want only the fresh one", n)
+	}
+}
+
+func TestMemoryLockout(t *testing.T) {
+	clk := newClock()
+	m := NewMemory(clk.now)
+	testLockout(t, m, clk)
+
+	// The lock ends on its own once the period is over.
+	lo := NewLockout(m, 1, time.Minute)
+	lo.Fail(context.Background(), "x", "192.0.2.1")
+	clk.add(time.Minute)
+	if d := lo.Locked(context.Background(), "x", "192.0.2.1"); d != 0 {
+		t.Errorf("lock outlived its period by %v", d)
+	}
+}
+
+func newTestRedis(t *testing.T, clk *clock) (*Redis, *miniredis.Miniredis) {
+	srv := miniredis.RunT(t)
+	r, err := NewRedis("redis://"+srv.Addr(), "test:", clk.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, srv
+}
+
+func TestRedisBuckets(t *testing.T) {
+	clk := newClock()
+	r, _ := newTestRedis(t, clk)
+	testBuckets(t, r, clk)
+}
+
+func TestRedisLockout(t *testing.T) {
+	clk := newClock()
+	r, srv := newTestRedis(t, clk)
+	testLockout(t, r, clk)
+
+	// Locks and failure windows are server-side TTLs.
+	lo := NewLockout(r, 1, time.Minute)
+	lo.Fail(context.Background(), "x", "192.0.2.1")
+	srv.FastForward(time.Minute)
+	if d := lo.Locked(context.Background(), "x", "192.0.2.1"); d != 0 {
+		t.Errorf("lock outlived its period by %v", d)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clk := newClock()
+	r := gin.New()
+	r.Use(Middleware(NewMemory(clk.now), Limit{Rate: 1, Burst: 2}, map[string]Limit{
+		"POST /track/click": {Rate: 0.1, Burst: 1},
+		"GET /livez":        {},
+	}))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	r.GET("/v1/products", ok)
+	r.POST("/v1/track/click", ok)
+	r.GET("/livez", ok)
+
+	do := func(method, path, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for range 2 {
+		if w := do(http.MethodGet, "/v1/products", "192.0.2.1"); w.Code != http.StatusNoContent {
+			t.Fatalf("within burst: status %d", w.Code)
+		}
+	}
+	w := do(http.MethodGet, "/v1/products", "192.0.2.1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("over the default: status %d Retry-After %q, want 429 and 1", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := do(http.MethodGet, "/v1/products", "192.0.2.2"); w.Code != http.StatusNoContent {
+		t.Errorf("another client was limited: status %d", w.Code)
+	}
+
+	// Routes have their own buckets and limits.
+	if w := do(http.MethodPost, "/v1/track/click", "192.0.2.1"); w.Code != http.StatusNoContent {
+		t.Fatalf("first click: status %d", w.Code)
+	}
+	w = do(http.MethodPost, "/v1/track/click", "192.0.2.1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "10" {
+		t.Fatalf("second click: status %d Retry-After %q, want 429 and 10", w.Code, w.Header().Get("Retry-After"))
+	}
+	clk.add(10 * time.Second)
+	if w := do(http.MethodPost, "/v1/track/click", "192.0.2.1"); w.Code != http.StatusNoContent {
+		t.Errorf("click after Retry-After: status %d", w.Code)
+	}
+
+	for range 10 {
+		if w := do(http.MethodGet, "/livez", "192.0.2.1"); w.Code != http.StatusNoContent {
+			t.Fatalf("unlimited route: status %d", w.Code)
+		}
+	}
+}
+
+// failing is a Backend that is always down.
+type failing struct{ Backend }
+
+func (failing) Take(context.Context, string, Limit) (Decision, error) {
+	return Decision{}, context.DeadlineExceeded
+}
+
+func TestMiddlewareFailsOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware(failing{}, Limit{Rate: 1, Burst: 1}, nil))
+	r.GET("/x", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	for range 3 {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/x", nil))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("status %d with the backend down, want the request through", w.Code)
+		}
+	}
+}
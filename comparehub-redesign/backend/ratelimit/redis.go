@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a Backend shared by every instance pointing at the same server.
+// Buckets are updated by a script so concurrent takes cannot both spend the
+// last token; the time comes from the caller, not the server.
+type Redis struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedis connects lazily to url (see cache.NewRedis), keeping keys under
+// prefix and reading time from now (time.Now when nil).
+func NewRedis(url, prefix string, now func() time.Time) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: REDIS_URL: %w", err)
+	}
+	// The limiter fails open, so a slow server should fail quickly.
+	opts.DialTimeout = 500 * time.Millisecond
+	opts.ReadTimeout = 200 * time.Millisecond
+	opts.WriteTimeout = 200 * time.Millisecond
+	if now == nil {
+		now = time.Now
+	}
+	return &Redis{client: redis.NewClient(opts), prefix: prefix, now: now}, nil
+}
+
+// takeScript refills the bucket in KEYS[1] (a hash of tokens and the last
+// update in ms) and spends a token if one is there. ARGV: now ms, tokens
+// per ms, burst. Returns {allowed, tokens left (string), ms until the next
+// token}. The key expires once the bucket would be full again.
+var takeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+if now > ts then
+  tokens = math.min(burst, tokens + (now - ts) * rate)
+end
+local allowed, wait = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(math.max(now, ts)))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+return {allowed, tostring(tokens), wait}
+`)
+
+func (r *Redis) Take(ctx context.Context, key string, l Limit) (Decision, error) {
+	res, err := takeScript.Run(ctx, r.client, []string{r.prefix + "bucket:" + key},
+		r.now().UnixMilli(), strconv.FormatFloat(l.Rate/1000, 'g', -1, 64), l.Burst).Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	if len(res) != 3 {
+		return Decision{}, fmt.Errorf("ratelimit: unexpected script result %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	s, _ := res[1].(string)
+	tokens, _ := strconv.ParseFloat(s, 64)
+	wait, _ := res[2].(int64)
+	if allowed == 1 {
+		return Decision{Allowed: true, Remaining: int(tokens)}, nil
+	}
+	return Decision{RetryAfter: time.Duration(wait) * time.Millisecond}, nil
+}
+
+// failScript counts a failure in KEYS[1], starting a window of ARGV[1] ms
+// on the first one.
+var failScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+func (r *Redis) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	n, err := failScript.Run(ctx, r.client, []string{r.prefix + "fail:" + key}, window.Milliseconds()).Int()
+	return n, err
+}
+
+func (r *Redis) Lock(ctx context.Context, key string, d time.Duration) error {
+	return r.client.Set(ctx, r.prefix+"lock:"+key, 1, d).Err()
+}
+
+func (r *Redis) Locked(ctx context.Context, key string) (time.Duration, error) {
+	d, err := r.client.PTTL(ctx, r.prefix+"lock:"+key).Result()
+	if err != nil || d < 0 { // -2: no key, -1: no expiry (not set by Lock)
+		return 0, err
+	}
+	return d, nil
+}
+
+func (r *Redis) Reset(ctx context.Context, key string) error {
+	return r.client.Del(ctx, r.prefix+"fail:"+key, r.prefix+"lock:"+key).Err()
+}
+
+func (r *Redis) Close() error { return r.client.Close() }
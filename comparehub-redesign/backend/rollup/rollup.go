@@ -0,0 +1,301 @@
+// Package rollup aggregates the raw analytics events (click_events,
+// product_views, search_events) into the hourly and daily rollup tables
+// the analytics queries read, and purges raw events past their retention.
+//
+// Every run recomputes whole UTC days, from Options.Lookback before the
+// previous run's end (or from the oldest raw event on the first run or a
+// backfill) up to the time the run started, one transaction per day. Recomputing
+// rather than adding keeps reruns idempotent and lets a late click reach
+// the search it came from.
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-ecommerce-backend/tracing"
+)
+
+// lockID is the pg_advisory_lock key that keeps instances from rolling up
+// at the same time ("chrollup").
+const lockID = 0x6368726f6c6c7570
+
+// purgeBatch bounds the rows one purge statement deletes, so the purge
+// never holds long locks on the event tables.
+const purgeBatch = 10000
+
+type Options struct {
+	// Lookback is how far before the previous run's end this one starts.
+	Lookback time.Duration
+	// Retention is how long raw events and hourly rollups are kept; 0
+	// keeps them forever.
+	Retention time.Duration
+	// Backfill recomputes from the oldest raw event.
+	Backfill bool
+}
+
+type Result struct {
+	// From and To bound the recomputed events; both are zero when there
+	// were no events. To is the time the run started, which is recorded as
+	// rolled_until: the current hour is rolled up only as far as it went.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	Days int       `json:"days"`
+	// PurgedBefore is the retention cutoff, zero without one.
+	PurgedBefore time.Time        `json:"purgedBefore"`
+	Purged       map[string]int64 `json:"purged"` // table -> rows deleted
+	// Skipped is set when another instance was rolling up.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// ErrRetention is returned for a retention the rollups could not survive:
+// raw events are purged before they are recomputed.
+var ErrRetention = errors.New("rollup: retention must exceed the lookback")
+
+// RunOnce rolls up the events up to now and applies the retention.
+func RunOnce(ctx context.Context, conn *sql.DB, opts Options) (Result, error) {
+	res := Result{Purged: map[string]int64{}}
+	if opts.Retention > 0 && opts.Retention <= opts.Lookback {
+		return res, ErrRetention
+	}
+
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer c.Close()
+	var locked bool
+	if err := c.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, lockID).Scan(&locked); err != nil {
+		return res, err
+	}
+	if !locked {
+		res.Skipped = true
+		return res, nil
+	}
+	defer c.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	now := time.Now().UTC()
+	from, ok, err := start(ctx, c, now, opts)
+	if err != nil {
+		return res, err
+	}
+	if ok {
+		res.From, res.To = from, now
+		for _, d := range days(res.From, res.To) {
+			if err := rollDay(ctx, c, d); err != nil {
+				return res, fmt.Errorf("rollup %s: %w", d.Start.Format(time.DateOnly), err)
+			}
+			res.Days++
+		}
+	}
+
+	if opts.Retention > 0 {
+		// Never purge events that have not been rolled up.
+		var until time.Time
+		err := c.QueryRowContext(ctx, `SELECT rolled_until FROM analytics_rollup_state`).Scan(&until)
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		res.PurgedBefore = Cutoff(now, opts.Retention)
+		if limit := Cutoff(until, 0); limit.Before(res.PurgedBefore) {
+			res.PurgedBefore = limit
+		}
+		if err := purge(ctx, c, res.PurgedBefore, res.Purged); err != nil {
+			return res, fmt.Errorf("purge: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// start is where the run begins: Lookback before rolled_until, or the
+// oldest raw event on a backfill or first run. ok is false when there is
+// nothing to roll up.
+func start(ctx context.Context, c *sql.Conn, now time.Time, opts Options) (time.Time, bool, error) {
+	if !opts.Backfill {
+		var until time.Time
+		err := c.QueryRowContext(ctx, `SELECT rolled_until FROM analytics_rollup_state`).Scan(&until)
+		if err == nil {
+			return until.Add(-opts.Lookback).UTC(), true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, false, err
+		}
+	}
+	var oldest sql.NullTime
+	err := c.QueryRowContext(ctx, `
+		SELECT LEAST(
+		  (SELECT MIN(created_at) FROM click_events),
+		  (SELECT MIN(created_at) FROM product_views),
+		  (SELECT MIN(created_at) FROM search_events))
+	`).Scan(&oldest)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if !oldest.Valid || oldest.Time.After(now) {
+		return time.Time{}, false, nil
+	}
+	return oldest.Time.UTC(), true, nil
+}
+
+// Day is one UTC day of a run. Hourly rollups are recomputed from
+// FromHour; the daily rollup is rebuilt from all of the day's hours.
+type Day struct {
+	Start    time.Time
+	FromHour time.Time
+	End      time.Time // the next day, or the run's start time
+}
+
+// days splits [from, to) into UTC days.
+func days(from, to time.Time) []Day {
+	var out []Day
+	if !from.Before(to) {
+		return nil
+	}
+	h := from.UTC().Truncate(time.Hour)
+	for h.Before(to) {
+		d := time.Date(h.Year(), h.Month(), h.Day(), 0, 0, 0, 0, time.UTC)
+		end := d.AddDate(0, 0, 1)
+		if end.After(to) {
+			end = to
+		}
+		out = append(out, Day{Start: d, FromHour: h, End: end})
+		h = end
+	}
+	return out
+}
+
+// Cutoff is the start of the UTC day retention ago. Purging whole days
+// keeps every day after the cutoff complete in the hourly rollups, so its
+// daily rollup can always be rebuilt.
+func Cutoff(now time.Time, retention time.Duration) time.Time {
+	t := now.UTC().Add(-retention)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// utcHour truncates a timestamptz column to the hour in UTC, whatever the
+// session time zone.
+const utcHour = `date_trunc('hour', %s AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'`
+
+// rollDay recomputes one day and records it as rolled up, so a run that
+// fails midway resumes after the last complete day.
+func rollDay(ctx context.Context, c *sql.Conn, d Day) (err error) {
+	ctx, span := tracing.StartQuery(ctx, "rollup.day")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []struct {
+		query string
+		args  []any
+	}{
+		{`DELETE FROM event_rollups_hourly WHERE bucket >= $1 AND bucket < $2`, []any{d.FromHour, d.End}},
+		{`DELETE FROM search_rollups_hourly WHERE bucket >= $1 AND bucket < $2`, []any{d.FromHour, d.End}},
+		{`
+		INSERT INTO event_rollups_hourly (bucket, product_id, store_id,
+		  views, view_bots, view_duplicates, clicks, click_bots, click_duplicates)
+		SELECT bucket, product_id, store_id,
+		       COUNT(*) FILTER (WHERE kind = 'view' AND NOT is_bot AND NOT is_duplicate),
+		       COUNT(*) FILTER (WHERE kind = 'view' AND is_bot),
+		       COUNT(*) FILTER (WHERE kind = 'view' AND is_duplicate AND NOT is_bot),
+		       COUNT(*) FILTER (WHERE kind = 'click' AND NOT is_bot AND NOT is_duplicate),
+		       COUNT(*) FILTER (WHERE kind = 'click' AND is_bot),
+		       COUNT(*) FILTER (WHERE kind = 'click' AND is_duplicate AND NOT is_bot)
+		FROM (
+		  SELECT ` + fmt.Sprintf(utcHour, "created_at") + ` AS bucket, product_id::bigint AS product_id,
+		         0::bigint AS store_id, 'view' AS kind, is_bot, is_duplicate
+		  FROM product_views
+		  WHERE created_at >= $1 AND created_at < $2
+		  UNION ALL
+		  SELECT ` + fmt.Sprintf(utcHour, "created_at") + `, COALESCE(product_id, 0), COALESCE(store_id, 0),
+		         'click', is_bot, is_duplicate
+		  FROM click_events
+		  WHERE created_at >= $1 AND created_at < $2
+		) ev
+		GROUP BY bucket, product_id, store_id
+		`, []any{d.FromHour, d.End}},
+		{`
+		INSERT INTO search_rollups_hourly (bucket, query, searches, zero_results,
+		  clicked_searches, clicks, last_zero_result_at)
+		SELECT ` + fmt.Sprintf(utcHour, "se.created_at") + `, lower(trim(COALESCE(se.query, ''))),
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE se.result_count = 0),
+		       COUNT(*) FILTER (WHERE COALESCE(se.result_count, 1) > 0 AND c.clicks > 0),
+		       COALESCE(SUM(c.clicks) FILTER (WHERE COALESCE(se.result_count, 1) > 0), 0),
+		       MAX(se.created_at) FILTER (WHERE se.result_count = 0)
+		FROM search_events se
+		LEFT JOIN LATERAL (
+		  SELECT COUNT(*) AS clicks
+		  FROM click_events ce
+		  WHERE ce.search_key = se.search_key AND NOT ce.is_bot AND NOT ce.is_duplicate
+		) c ON se.search_key IS NOT NULL
+		WHERE se.created_at >= $1 AND se.created_at < $2
+		GROUP BY 1, 2
+		`, []any{d.FromHour, d.End}},
+		{`DELETE FROM event_rollups_daily WHERE bucket = $1`, []any{d.Start}},
+		{`DELETE FROM search_rollups_daily WHERE bucket = $1`, []any{d.Start}},
+		{`
+		INSERT INTO event_rollups_daily (bucket, product_id, store_id,
+		  views, view_bots, view_duplicates, clicks, click_bots, click_duplicates)
+		SELECT $1, product_id, store_id, SUM(views), SUM(view_bots), SUM(view_duplicates),
+		       SUM(clicks), SUM(click_bots), SUM(click_duplicates)
+		FROM event_rollups_hourly
+		WHERE bucket >= $1 AND bucket < $2
+		GROUP BY product_id, store_id
+		`, []any{d.Start, d.Start.AddDate(0, 0, 1)}},
+		{`
+		INSERT INTO search_rollups_daily (bucket, query, searches, zero_results,
+		  clicked_searches, clicks, last_zero_result_at)
+		SELECT $1, query, SUM(searches), SUM(zero_results), SUM(clicked_searches),
+		       SUM(clicks), MAX(last_zero_result_at)
+		FROM search_rollups_hourly
+		WHERE bucket >= $1 AND bucket < $2
+		GROUP BY query
+		`, []any{d.Start, d.Start.AddDate(0, 0, 1)}},
+		{`
+		INSERT INTO analytics_rollup_state (rolled_until) VALUES ($1)
+		ON CONFLICT (id) DO UPDATE SET rolled_until = EXCLUDED.rolled_until, updated_at = now()
+		`, []any{d.End}},
+	}
+	for _, st := range stmts {
+		if _, err := tx.ExecContext(ctx, st.query, st.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// purge deletes raw events and hourly rollups older than cutoff, in
+// batches. Daily rollups are kept.
+func purge(ctx context.Context, c *sql.Conn, cutoff time.Time, counts map[string]int64) error {
+	tables := []struct{ name, query string }{
+		{"click_events", `DELETE FROM click_events WHERE id IN (SELECT id FROM click_events WHERE created_at < $1 LIMIT $2)`},
+		{"product_views", `DELETE FROM product_views WHERE id IN (SELECT id FROM product_views WHERE created_at < $1 LIMIT $2)`},
+		{"search_events", `DELETE FROM search_events WHERE id IN (SELECT id FROM search_events WHERE created_at < $1 LIMIT $2)`},
+		{"event_rollups_hourly", `DELETE FROM event_rollups_hourly WHERE ctid IN (SELECT ctid FROM event_rollups_hourly WHERE bucket < $1 LIMIT $2)`},
+		{"search_rollups_hourly", `DELETE FROM search_rollups_hourly WHERE ctid IN (SELECT ctid FROM search_rollups_hourly WHERE bucket < $1 LIMIT $2)`},
+	}
+	for _, t := range tables {
+		for {
+			r, err := c.ExecContext(ctx, t.query, cutoff, purgeBatch)
+			if err != nil {
+				return fmt.Errorf("%s: %w", t.name, err)
+			}
+			n, _ := r.RowsAffected()
+			counts[t.name] += n
+			if n < purgeBatch {
+				break
+			}
+		}
+	}
+	return nil
+}
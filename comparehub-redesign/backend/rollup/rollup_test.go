@@ -0,0 +1,275 @@
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go-ecommerce-backend/migrate"
+	"go-ecommerce-backend/store"
+	"go-ecommerce-backend/store/postgres"
+)
+
+func TestDays(t *testing.T) {
+	from := time.Date(2026, 3, 1, 22, 40, 0, 0, time.UTC)
+	to := time.Date(2026, 3, 3, 5, 20, 0, 0, time.UTC) // a run starting mid-hour
+	got := days(from, to)
+	want := []Day{
+		{Start: date(2026, 3, 1), FromHour: from.Truncate(time.Hour), End: date(2026, 3, 2)},
+		{Start: date(2026, 3, 2), FromHour: date(2026, 3, 2), End: date(2026, 3, 3)},
+		{Start: date(2026, 3, 3), FromHour: date(2026, 3, 3), End: to},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("days = %+v", got)
+	}
+	for i := range want {
+		if !got[i].Start.Equal(want[i].Start) || !got[i].FromHour.Equal(want[i].FromHour) || !got[i].End.Equal(want[i].End) {
+			t.Errorf("day %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// A time zone other than UTC still splits on UTC days.
+	est := time.FixedZone("EST", -5*3600)
+	if got := days(time.Date(2026, 3, 1, 20, 0, 0, 0, est), to); !got[0].Start.Equal(date(2026, 3, 2)) {
+		t.Errorf("first day = %v", got[0].Start)
+	}
+	if got := days(to, to); len(got) != 0 {
+		t.Errorf("empty range = %+v", got)
+	}
+}
+
+func TestCutoff(t *testing.T) {
+	now := time.Date(2026, 6, 30, 15, 0, 0, 0, time.UTC)
+	if got := Cutoff(now, 90*24*time.Hour); !got.Equal(date(2026, 4, 1)) {
+		t.Errorf("Cutoff = %v", got)
+	}
+}
+
+func TestRunnerStopsOnCancel(t *testing.T) {
+	// A retention shorter than the lookback fails before touching the
+	// database, so no conn is needed.
+	r := NewRunner(nil, Options{Lookback: 48 * time.Hour, Retention: time.Hour})
+	if _, err := r.RunOnce(context.Background()); !errors.Is(err, ErrRetention) {
+		t.Fatalf("RunOnce = %v, want ErrRetention", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go r.RunEvery(ctx, time.Hour)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	wctx, wcancel := context.WithTimeout(context.Background(), time.Second)
+	defer wcancel()
+	if err := r.Wait(wctx); err != nil {
+		t.Fatalf("RunEvery did not stop after cancel: %v", err)
+	}
+}
+
+// testDatabaseEnv names a scratch database for the tests that roll up (the
+// same one the store/postgres benchmarks use). The rollup state is global,
+// so they truncate the analytics tables:
+//
+//	COMPAREHUB_TEST_DATABASE_URL=postgres://localhost/comparehub_bench?sslmode=disable \
+//	  go test ./rollup -run RollUp
+const testDatabaseEnv = "COMPAREHUB_TEST_DATABASE_URL"
+
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		t.Skip(testDatabaseEnv + " not set")
+	}
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err := migrate.New(conn).Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestRollUpAndPurge(t *testing.T) {
+	conn := testDB(t)
+	ctx := context.Background()
+	exec := func(query string, args ...any) {
+		t.Helper()
+		if _, err := conn.ExecContext(ctx, query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec(`TRUNCATE click_events, product_views, search_events, event_rollups_hourly, event_rollups_daily,
+		search_rollups_hourly, search_rollups_daily, analytics_rollup_state`)
+
+	tag := fmt.Sprintf("%d", time.Now().UnixNano())
+	var productID, storeID int64
+	if err := conn.QueryRowContext(ctx, `INSERT INTO products (name, brand) VALUES ($1, 'Test') RETURNING id`,
+		"Rollup "+tag).Scan(&productID); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.QueryRowContext(ctx, `INSERT INTO stores (name) VALUES ($1) RETURNING id`,
+		"Rollup "+tag).Scan(&storeID); err != nil {
+		t.Fatal(err)
+	}
+	view := func(at time.Time, bot bool) {
+		exec(`INSERT INTO product_views (product_id, is_bot, created_at) VALUES ($1, $2, $3)`, productID, bot, at)
+	}
+	click := func(at time.Time, duplicate bool, searchKey string) {
+		exec(`INSERT INTO click_events (product_id, store_id, is_duplicate, search_key, created_at)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5)`, productID, storeID, duplicate, searchKey, at)
+	}
+	search := func(at time.Time, query string, results int, key string) {
+		exec(`INSERT INTO search_events (query, result_count, search_key, created_at) VALUES ($1, $2, NULLIF($3, ''), $4)`,
+			query, results, key, at)
+	}
+
+	// One visit 60 days ago (past the 30 day retention used below), one two
+	// days ago (within the lookback) and a view a minute ago.
+	now := time.Now()
+	old, recent := now.AddDate(0, 0, -60), now.AddDate(0, 0, -2)
+	view(old, false)
+	click(old, false, "")
+	search(old, "Old Query", 0, "")
+	view(recent, false)
+	view(recent, true)
+	search(recent, " Phone ", 3, "k-"+tag)
+	click(recent, false, "k-"+tag)
+	click(recent, true, "k-"+tag)
+	view(now.Add(-time.Minute), false)
+
+	type counts struct{ views, viewBots, clicks, clickDuplicates int64 }
+	sums := func(table string) counts {
+		t.Helper()
+		var c counts
+		if err := conn.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(views), 0), COALESCE(SUM(view_bots), 0),
+			       COALESCE(SUM(clicks), 0), COALESCE(SUM(click_duplicates), 0)
+			FROM `+table+` WHERE product_id = $1
+		`, productID).Scan(&c.views, &c.viewBots, &c.clicks, &c.clickDuplicates); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	run := func(opts Options) Result {
+		t.Helper()
+		before := time.Now().Truncate(time.Microsecond)
+		res, err := RunOnce(ctx, conn, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// rolled_until is when the run started, never the end of its hour.
+		var until time.Time
+		if err := conn.QueryRowContext(ctx, `SELECT rolled_until FROM analytics_rollup_state`).Scan(&until); err != nil {
+			t.Fatal(err)
+		}
+		if until.Before(before) || until.After(time.Now()) {
+			t.Errorf("rolled_until = %v, want the run's start (after %v)", until, before)
+		}
+		return res
+	}
+	want := counts{views: 3, viewBots: 1, clicks: 2, clickDuplicates: 1}
+	check := func(when string) {
+		t.Helper()
+		for _, table := range []string{"event_rollups_hourly", "event_rollups_daily"} {
+			if got := sums(table); got != want {
+				t.Errorf("%s: %s = %+v, want %+v", when, table, got, want)
+			}
+		}
+		var searches, clicked, clicks int64
+		if err := conn.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(searches), 0), COALESCE(SUM(clicked_searches), 0), COALESCE(SUM(clicks), 0)
+			FROM search_rollups_daily WHERE query = 'phone'
+		`).Scan(&searches, &clicked, &clicks); err != nil {
+			t.Fatal(err)
+		}
+		if searches != 1 || clicked != 1 || clicks != 1 {
+			t.Errorf("%s: phone searches = %d, clicked %d, clicks %d; want 1 each", when, searches, clicked, clicks)
+		}
+	}
+
+	// The first run backfills from the oldest event; a rerun recomputes the
+	// lookback without counting anything twice.
+	if res := run(Options{Lookback: 48 * time.Hour}); res.Days < 60 {
+		t.Errorf("first run rolled up %d days, want the 60 since the oldest event", res.Days)
+	}
+	check("first run")
+	if res := run(Options{Lookback: 48 * time.Hour}); res.Days < 2 || res.Days > 4 {
+		t.Errorf("rerun rolled up %d days, want the lookback's", res.Days)
+	}
+	check("rerun")
+
+	analytics := postgres.Stores(conn).Analytics
+	type report struct {
+		viewsWeek, clicksWeek, zeroResults, clicksTotal int64
+		asOf                                            time.Time
+	}
+	reports := func() report {
+		t.Helper()
+		sum, err := analytics.Summary(ctx, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sr, err := analytics.SearchReport(ctx, 90)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cr, err := analytics.ClickReport(ctx, store.ClickQuery{From: now.AddDate(0, 0, -90), To: now, Granularity: "day"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := report{viewsWeek: sum.Views.Counted, clicksWeek: sum.Clicks.Counted, clicksTotal: cr.Totals.Clicks, asOf: sum.AsOf}
+		for _, z := range sr.ZeroResults {
+			if z.Query == "old query" {
+				r.zeroResults += z.Searches
+			}
+		}
+		if !sr.AsOf.Equal(sum.AsOf) || !cr.AsOf.Equal(sum.AsOf) {
+			t.Errorf("asOf differs: summary %v, searches %v, clicks %v", sum.AsOf, sr.AsOf, cr.AsOf)
+		}
+		return r
+	}
+	before := reports()
+	if before.viewsWeek != 2 || before.clicksWeek != 1 || before.zeroResults != 1 || before.clicksTotal != 2 {
+		t.Errorf("reports = %+v", before)
+	}
+	if before.asOf.IsZero() || before.asOf.After(time.Now()) {
+		t.Errorf("asOf = %v, want the last run's start", before.asOf)
+	}
+
+	// A 30 day retention purges the old visit's raw events and hourly
+	// rollups; the daily rollups and so the reports keep it.
+	res := run(Options{Lookback: 48 * time.Hour, Retention: 30 * 24 * time.Hour})
+	for _, table := range []string{"click_events", "product_views", "search_events"} {
+		if res.Purged[table] != 1 {
+			t.Errorf("purged %d rows from %s, want 1", res.Purged[table], table)
+		}
+	}
+	var hourly int64
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM event_rollups_hourly WHERE bucket < $1`,
+		res.PurgedBefore).Scan(&hourly); err != nil {
+		t.Fatal(err)
+	}
+	if hourly != 0 {
+		t.Errorf("%d hourly rollups left before %v", hourly, res.PurgedBefore)
+	}
+	if got := sums("event_rollups_daily"); got != want {
+		t.Errorf("after purge: daily rollups = %+v, want %+v", got, want)
+	}
+	after := reports()
+	if after.asOf.Before(before.asOf) {
+		t.Errorf("asOf went back from %v to %v", before.asOf, after.asOf)
+	}
+	after.asOf = before.asOf
+	if after != before {
+		t.Errorf("reports after purge = %+v, want %+v", after, before)
+	}
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,52 @@
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go-ecommerce-backend/job"
+	"go-ecommerce-backend/logging"
+)
+
+// Runner runs the rollup job in the server on a job.Runner, like
+// syncer.Runner does for feed syncs: runs never overlap in one process
+// (the advisory lock covers several), and shutdown can wait for the run in
+// progress.
+type Runner struct {
+	job *job.Runner[Result]
+}
+
+func NewRunner(conn *sql.DB, opts Options) *Runner {
+	return &Runner{job: job.New(func(ctx context.Context) (Result, error) {
+		return RunOnce(ctx, conn, opts)
+	}, 0)}
+}
+
+// RunOnce performs one run, waiting for a run already in progress first.
+// Like a sync, it is detached from ctx's cancellation: each day is its own
+// transaction, but a purge is best left to finish.
+func (r *Runner) RunOnce(ctx context.Context) (Result, error) {
+	return r.job.RunOnce(ctx)
+}
+
+// RunEvery runs immediately and then every interval until ctx is done.
+func (r *Runner) RunEvery(ctx context.Context, interval time.Duration) {
+	r.job.RunEvery(ctx, interval, func(ctx context.Context, res Result, err error) {
+		log := logging.FromContext(ctx)
+		switch {
+		case err != nil:
+			log.Error("analytics rollup failed", "err", err)
+		case res.Skipped:
+			log.Debug("analytics rollup skipped: another instance is running it")
+		default:
+			log.Debug("analytics rollup done", "from", res.From, "to", res.To, "days", res.Days, "purged", res.Purged)
+		}
+	})
+}
+
+// Wait blocks until every RunEvery loop has returned and no run is in
+// progress, or until ctx is done.
+func (r *Runner) Wait(ctx context.Context) error {
+	return r.job.Wait(ctx)
+}
@@ -0,0 +1,99 @@
+// Package routes is the API's route table. main mounts it on the server's
+// engine behind the global middleware; the handler tests mount it on a
+// bare engine over the in-memory store, so both serve the same routes.
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"go-ecommerce-backend/api"
+	"go-ecommerce-backend/cache"
+	"go-ecommerce-backend/config"
+	"go-ecommerce-backend/handlers"
+	"go-ecommerce-backend/middleware"
+	"go-ecommerce-backend/ratelimit"
+	"go-ecommerce-backend/store"
+	syncer "go-ecommerce-backend/sync"
+)
+
+// Deps are what the handlers are wired with. A nil Lockout turns login
+// lockouts off.
+type Deps struct {
+	Config  *config.Config
+	Stores  store.Stores
+	Runner  *syncer.Runner
+	Cache   *cache.Cache
+	Lockout *ratelimit.Lockout
+	Events  *handlers.EventQueue
+}
+
+// Mount registers every API route on r: once under /v1 (the stable
+// contract, every response wrapped in api.Envelope) and once unversioned
+// (legacy aliases kept until clients migrate).
+func Mount(r *gin.Engine, d Deps) {
+	register(r.Group("/v1", api.V1()), d)
+	register(r, d)
+
+	// Outbound links are followed by browsers, not API clients, so they
+	// live outside /v1.
+	r.GET("/go/:offerId", handlers.GoRedirect(d.Stores.Offers, d.Stores.Analytics, d.Config.Analytics))
+}
+
+func register(g gin.IRouter, d Deps) {
+	cfg, st := d.Config, d.Stores
+
+	// -----------------------
+	// Public APIs
+	// -----------------------
+	// Product reads carry an ETag and Cache-Control so browsers and a CDN
+	// can reuse them; searches and product pages are always revalidated so
+	// each search and view still reaches the server.
+	cacheable := middleware.Conditional(middleware.CacheControl(cfg.HTTPCache))
+	revalidate := middleware.Conditional(middleware.Revalidate)
+
+	g.GET("/products", revalidate, handlers.ListProducts(st.Products, st.Analytics, d.Events))
+	g.GET("/products/:id", revalidate, handlers.GetProduct(st.Products, st.Offers, st.Specs, st.Analytics, d.Events, cfg.Analytics))
+	g.GET("/products/:id/offers", cacheable, handlers.GetOffers(st.Offers))
+	g.GET("/products/:id/also-viewed", cacheable, handlers.AlsoViewed(st.Products, st.Offers, st.Analytics))
+	g.GET("/compare", cacheable, handlers.Compare(st.Products, st.Offers, st.Specs))
+	g.GET("/analytics/top-deals", handlers.TopDeals(st.Products))
+
+	// -----------------------
+	// Analytics
+	// -----------------------
+	g.POST("/track/click", handlers.TrackClick(st.Analytics, cfg.Analytics))
+	// The summary's old path, kept as an alias of /admin/analytics/summary
+	// until clients migrate. Like the other reports it needs an admin token.
+	g.GET("/analytics/summary", middleware.RequireAdmin(cfg.Auth.JWTSecret), handlers.AnalyticsSummary(st.Analytics))
+
+	// -----------------------
+	// Public auth
+	// -----------------------
+	g.POST("/auth/login", handlers.Login(st.Admins, cfg.Auth, d.Lockout))
+
+	// -----------------------
+	// Protected admin APIs
+	// -----------------------
+	admin := g.Group("/admin", middleware.RequireAdmin(cfg.Auth.JWTSecret))
+	{
+		admin.POST("/products", handlers.AdminCreateProduct(st.Products))
+		admin.POST("/offers", handlers.AdminCreateOffer(st.Offers))
+		admin.POST("/specs", handlers.AdminUpsertSpecs(st.Specs))
+
+		admin.POST("/sync-now", func(c *gin.Context) {
+			if _, err := d.Runner.RunOnce(c.Request.Context()); err != nil {
+				api.Abort(c, err)
+				return
+			}
+			api.OK(c, 200, gin.H{"ok": true}, nil, gin.H{"ok": true})
+		})
+
+		admin.GET("/analytics/summary", handlers.AnalyticsSummary(st.Analytics))
+		admin.GET("/analytics/searches", handlers.SearchAnalytics(st.Analytics))
+		admin.GET("/analytics/clicks", handlers.ClickAnalytics(st.Analytics, cfg.Analytics))
+		admin.GET("/analytics/export", handlers.AnalyticsExport(st.Analytics))
+
+		admin.GET("/cache/stats", cache.StatsHandler(d.Cache))
+		admin.POST("/cache/invalidate", cache.InvalidateHandler(d.Cache))
+	}
+}
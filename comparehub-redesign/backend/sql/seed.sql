@@ -1,6 +1,6 @@
 -- ============================
 -- CompareHub demo seed data (idempotent)
--- Safe to run on every startup.
+-- Not run at startup; load it explicitly with `go run . seed`.
 -- ============================
 
 -- STORES
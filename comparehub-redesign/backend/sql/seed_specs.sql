@@ -2,9 +2,8 @@
 -- Upserts extra specs for products (especially Headphones) so Compare page can show spec rows.
 --
 -- How to run:
---   psql "$DATABASE_URL" -f sql/schema.sql
---   psql "$DATABASE_URL" -f sql/seed.sql        -- optional
---   psql "$DATABASE_URL" -f sql/seed_specs.sql  -- required for Headphones + extras
+--   go run . migrate up
+--   go run . seed        -- runs sql/seed.sql then this file
 --
 -- Notes:
 -- - Products are matched by (name, brand). If you rename a product, update this script.
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// ViewEvent is a product detail view. The visitor fields are anonymized
+// like ClickEvent's.
+type ViewEvent struct {
+	ProductID  int64
+	SessionID  string
+	VisitorKey string
+	IPHash     string
+	UserAgent  string
+	Referrer   string
+	// Bot views, and repeats of a counted view by the same visitor within
+	// DedupeWindow, are stored but never counted.
+	Bot          bool
+	DedupeWindow time.Duration
+}
+
+// Report granularities and groupings accepted by ClickQuery.
+var (
+	Granularities = []string{"hour", "day", "week"}
+	ClickGroupBys = []string{"product", "store", "category", "brand"}
+)
+
+// ClickQuery selects a click-through report: counted views and clicks in
+// [From, To), bucketed by Granularity in UTC (weeks start on Monday) and
+// optionally split by GroupBy.
+type ClickQuery struct {
+	From, To    time.Time
+	Granularity string // hour | day | week
+	GroupBy     string // "" (totals only), product, store, category or brand
+	Limit       int    // groups kept, most clicked first
+}
+
+// Truncate returns the start of the bucket holding t.
+func Truncate(t time.Time, granularity string) time.Time {
+	t = t.UTC()
+	switch granularity {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return d.AddDate(0, 0, -(int(d.Weekday())+6)%7)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Buckets lists the bucket starts covering q's range.
+func (q ClickQuery) Buckets() []time.Time {
+	var out []time.Time
+	for b := Truncate(q.From, q.Granularity); b.Before(q.To); b = next(b, q.Granularity) {
+		out = append(out, b)
+	}
+	return out
+}
+
+func next(b time.Time, granularity string) time.Time {
+	switch granularity {
+	case "hour":
+		return b.Add(time.Hour)
+	case "week":
+		return b.AddDate(0, 0, 7)
+	}
+	return b.AddDate(0, 0, 1)
+}
+
+// ClickCount is what the stores aggregate: the events of one bucket, for
+// one group (Key "" in the totals).
+type ClickCount struct {
+	Bucket   time.Time
+	Key      string
+	Label    string
+	Views    int64
+	Clicks   int64
+	Searches int64
+}
+
+// ClickPoint is one bucket of a series.
+type ClickPoint struct {
+	Bucket   time.Time `json:"bucket"`
+	Views    int64     `json:"views"`
+	Clicks   int64     `json:"clicks"`
+	Searches int64     `json:"searches"`
+	// CTR is Clicks / Views; null without views.
+	CTR *float64 `json:"ctr"`
+}
+
+// ClickTotals sums a series.
+type ClickTotals struct {
+	Views    int64    `json:"views"`
+	Clicks   int64    `json:"clicks"`
+	Searches int64    `json:"searches"`
+	CTR      *float64 `json:"ctr"`
+}
+
+// ClickGroup is one product, store, category or brand. Searches are not
+// attributed to groups, and store groups have no views: a view is of a
+// product, not of an offer.
+type ClickGroup struct {
+	Key    string       `json:"key"`   // product id, store name, category or brand
+	Label  string       `json:"label"` // product name; Key otherwise
+	Totals ClickTotals  `json:"totals"`
+	Series []ClickPoint `json:"series"`
+}
+
+type ClickReport struct {
+	Totals ClickTotals  `json:"totals"`
+	Series []ClickPoint `json:"series"`
+	Groups []ClickGroup `json:"groups"`
+	// AsOf is how far the counts reach, as in Summary.
+	AsOf time.Time `json:"asOf"`
+}
+
+// BuildClickReport assembles a report from the stores' counts: dense
+// series (empty buckets included) and the q.Limit most clicked groups.
+func BuildClickReport(q ClickQuery, totals, grouped []ClickCount) ClickReport {
+	buckets := q.Buckets()
+	rep := ClickReport{Groups: []ClickGroup{}}
+	rep.Series, rep.Totals = series(buckets, totals)
+
+	byKey := map[string][]ClickCount{}
+	labels := map[string]string{}
+	for _, c := range grouped {
+		byKey[c.Key] = append(byKey[c.Key], c)
+		labels[c.Key] = c.Label
+	}
+	for key, counts := range byKey {
+		g := ClickGroup{Key: key, Label: labels[key]}
+		if g.Label == "" {
+			g.Label = key
+		}
+		g.Series, g.Totals = series(buckets, counts)
+		rep.Groups = append(rep.Groups, g)
+	}
+	sort.Slice(rep.Groups, func(i, j int) bool {
+		a, b := rep.Groups[i].Totals, rep.Groups[j].Totals
+		if a.Clicks != b.Clicks {
+			return a.Clicks > b.Clicks
+		}
+		if a.Views != b.Views {
+			return a.Views > b.Views
+		}
+		return rep.Groups[i].Key < rep.Groups[j].Key
+	})
+	if q.Limit > 0 && len(rep.Groups) > q.Limit {
+		rep.Groups = rep.Groups[:q.Limit]
+	}
+	return rep
+}
+
+func series(buckets []time.Time, counts []ClickCount) ([]ClickPoint, ClickTotals) {
+	at := map[int64]*ClickCount{}
+	for i := range counts {
+		c := &counts[i]
+		b := c.Bucket.Unix()
+		if p, ok := at[b]; ok {
+			p.Views += c.Views
+			p.Clicks += c.Clicks
+			p.Searches += c.Searches
+		} else {
+			cp := *c
+			at[b] = &cp
+		}
+	}
+	out := make([]ClickPoint, len(buckets))
+	var t ClickTotals
+	for i, b := range buckets {
+		out[i].Bucket = b
+		if c := at[b.Unix()]; c != nil {
+			out[i].Views, out[i].Clicks, out[i].Searches = c.Views, c.Clicks, c.Searches
+			out[i].CTR = ctr(c.Clicks, c.Views)
+		}
+		t.Views += out[i].Views
+		t.Clicks += out[i].Clicks
+		t.Searches += out[i].Searches
+	}
+	t.CTR = ctr(t.Clicks, t.Views)
+	return out, t
+}
+
+func ctr(clicks, views int64) *float64 {
+	if views == 0 {
+		return nil
+	}
+	r := float64(clicks) / float64(views)
+	return &r
+}
@@ -0,0 +1,34 @@
+package store
+
+import "time"
+
+// Export datasets: the raw events, or their rollups (see package rollup).
+var ExportDatasets = []string{"clicks", "views", "searches", "event-rollups", "search-rollups"}
+
+// ExportColumns are the columns of each dataset, in row order. Visitor
+// fields stay anonymized: only the hashed session id and the referrer
+// (without query string) are exported.
+var ExportColumns = map[string][]string{
+	"clicks": {"id", "created_at", "product_id", "product", "store_id", "store", "offer_id",
+		"search_key", "session_id", "referrer", "bot", "duplicate"},
+	"views": {"id", "created_at", "product_id", "product", "session_id", "referrer", "bot", "duplicate"},
+	"searches": {"id", "created_at", "query", "category", "sort", "filters", "result_count",
+		"latency_ms", "search_key"},
+	"event-rollups": {"bucket", "product_id", "product", "store_id", "store", "views", "view_bots",
+		"view_duplicates", "clicks", "click_bots", "click_duplicates"},
+	"search-rollups": {"bucket", "query", "searches", "zero_results", "clicked_searches", "clicks"},
+}
+
+// ExportQuery selects the rows of Dataset created (or bucketed) in
+// [From, To). Granularity picks the hourly or daily rollups and is ignored
+// for raw events.
+type ExportQuery struct {
+	Dataset     string
+	Granularity string // hour | day
+	From, To    time.Time
+}
+
+// ExportRow is one row, lined up with ExportColumns[q.Dataset]. Values are
+// int64, float64, bool, string, time.Time or nil (SQL NULL); filters is
+// JSON text.
+type ExportRow []any
@@ -0,0 +1,412 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-ecommerce-backend/store"
+)
+
+func (s *Store) RecordSearch(_ context.Context, ev store.SearchEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ev.Query = strings.TrimSpace(ev.Query)
+	s.searches = append(s.searches, search{SearchEvent: ev, at: s.Now()})
+	return nil
+}
+
+func (s *Store) RecordClick(_ context.Context, ev store.ClickEvent) (store.ClickResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var storeID, offerID sql.NullInt64
+	if _, ok := s.products[int(ev.ProductID)]; !ok {
+		return store.ClickResult{}, store.ErrInvalidReference
+	}
+	if ev.OfferID != 0 {
+		offerID = sql.NullInt64{Int64: ev.OfferID, Valid: true}
+		storeID = sql.NullInt64{Int64: ev.StoreID, Valid: ev.StoreID != 0}
+	} else {
+		for id, name := range s.names {
+			if strings.EqualFold(name, ev.StoreName) {
+				storeID = sql.NullInt64{Int64: id, Valid: true}
+				break
+			}
+		}
+	}
+	if !offerID.Valid && storeID.Valid && strings.TrimSpace(ev.URL) != "" {
+		for _, o := range s.offers {
+			if int64(o.ProductID) == ev.ProductID && o.storeID == storeID.Int64 && o.URL == ev.URL {
+				offerID = sql.NullInt64{Int64: o.ID, Valid: true}
+				break
+			}
+		}
+	}
+	now := s.Now()
+	c := click{
+		productID:  ev.ProductID,
+		storeID:    storeID,
+		offerID:    offerID,
+		searchKey:  strings.TrimSpace(ev.SearchKey),
+		sessionID:  ev.SessionID,
+		visitorKey: ev.VisitorKey,
+		referrer:   ev.Referrer,
+		bot:        ev.Bot,
+		at:         now,
+	}
+	if !c.bot && c.visitorKey != "" && ev.DedupeWindow > 0 {
+		from := now.Add(-ev.DedupeWindow)
+		for i := len(s.clicks) - 1; i >= 0 && !s.clicks[i].at.Before(from); i-- {
+			p := s.clicks[i]
+			if p.counted() && p.visitorKey == c.visitorKey && p.productID == c.productID &&
+				p.storeID == c.storeID && p.offerID == c.offerID {
+				c.duplicate = true
+				break
+			}
+		}
+	}
+	s.clicks = append(s.clicks, c)
+	return store.ClickResult{StoreID: storeID, OfferID: offerID, Duplicate: c.duplicate}, nil
+}
+
+func (s *Store) RecordView(_ context.Context, ev store.ViewEvent) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.products[int(ev.ProductID)]; !ok {
+		return false, store.ErrInvalidReference
+	}
+	now := s.Now()
+	v := view{
+		productID: ev.ProductID, sessionID: ev.SessionID, visitorKey: ev.VisitorKey,
+		referrer: ev.Referrer, bot: ev.Bot, at: now,
+	}
+	if v.bot || v.visitorKey == "" {
+		s.views = append(s.views, v)
+		return false, nil
+	}
+
+	// Mirrors the dedupe check of RecordClick and the
+	// product_views_coview trigger.
+	dedupeFrom, dayFrom := now.Add(-ev.DedupeWindow), now.Add(-24*time.Hour)
+	seenToday := false
+	others := map[int64]bool{}
+	for i := len(s.views) - 1; i >= 0 && !s.views[i].at.Before(dayFrom); i-- {
+		p := s.views[i]
+		if !p.counted() || p.visitorKey != v.visitorKey {
+			continue
+		}
+		if p.productID != v.productID {
+			others[p.productID] = true
+			continue
+		}
+		seenToday = true
+		if ev.DedupeWindow > 0 && !p.at.Before(dedupeFrom) {
+			v.duplicate = true
+		}
+	}
+	s.views = append(s.views, v)
+	if v.duplicate || seenToday {
+		return v.duplicate, nil
+	}
+	for other := range others {
+		for _, k := range [][2]int64{{v.productID, other}, {other, v.productID}} {
+			cv := s.coviews[k]
+			if cv == nil {
+				cv = &coview{}
+				s.coviews[k] = cv
+			}
+			cv.visitors++
+			cv.last = now
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) AlsoViewed(_ context.Context, productID, limit int) ([]store.CoView, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	type ranked struct {
+		store.CoView
+		last time.Time
+	}
+	var rs []ranked
+	for k, cv := range s.coviews {
+		if k[0] == int64(productID) {
+			if _, ok := s.products[int(k[1])]; ok {
+				rs = append(rs, ranked{store.CoView{ProductID: int(k[1]), Visitors: cv.visitors}, cv.last})
+			}
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		a, b := rs[i], rs[j]
+		if a.Visitors != b.Visitors {
+			return a.Visitors > b.Visitors
+		}
+		if !a.last.Equal(b.last) {
+			return a.last.After(b.last)
+		}
+		return a.ProductID < b.ProductID
+	})
+	out := []store.CoView{}
+	for _, r := range truncate(rs, limit) {
+		out = append(out, r.CoView)
+	}
+	return out, nil
+}
+
+// since starts a report window at the UTC midnight days ago, like the
+// daily rollups the postgres store reads.
+func (s *Store) since(days int) time.Time {
+	t := s.Now().UTC().AddDate(0, 0, -days)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func normQuery(q string) string {
+	return strings.ToLower(strings.TrimSpace(q))
+}
+
+func (s *Store) Summary(_ context.Context, days int) (store.Summary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	from := s.since(days)
+
+	byProduct := map[int64]int64{}
+	byStore := map[string]int64{}
+	var counts store.ClickCounts
+	for _, c := range s.clicks {
+		if c.at.Before(from) {
+			continue
+		}
+		counts.Raw++
+		switch {
+		case c.bot:
+			counts.Bots++
+			continue
+		case c.duplicate:
+			counts.Duplicates++
+			continue
+		}
+		counts.Counted++
+		byProduct[c.productID]++
+		if c.storeID.Valid {
+			byStore[s.names[c.storeID.Int64]]++
+		}
+	}
+	byViews := map[int64]int64{}
+	var views store.ViewCounts
+	for _, v := range s.views {
+		if v.at.Before(from) {
+			continue
+		}
+		views.Raw++
+		switch {
+		case v.bot:
+			views.Bots++
+			continue
+		case v.duplicate:
+			views.Duplicates++
+			continue
+		}
+		views.Counted++
+		byViews[v.productID]++
+	}
+	bySearch := map[string]int64{}
+	for _, se := range s.searches {
+		if se.at.Before(from) || se.Query == "" {
+			continue
+		}
+		bySearch[normQuery(se.Query)]++
+	}
+
+	sum := store.Summary{
+		TrendingProducts: []store.TrendingProduct{},
+		StoreClicks:      []store.StoreClicks{},
+		TopSearches:      []store.TopSearch{},
+		MostViewed:       []store.ViewedProduct{},
+		Clicks:           counts,
+		Views:            views,
+	}
+	for id, n := range byProduct {
+		p := s.products[int(id)]
+		sum.TrendingProducts = append(sum.TrendingProducts, store.TrendingProduct{ID: id, Name: p.Name, Image: p.ImageURL, Clicks: n})
+	}
+	sort.Slice(sum.TrendingProducts, func(i, j int) bool {
+		a, b := sum.TrendingProducts[i], sum.TrendingProducts[j]
+		return a.Clicks > b.Clicks || a.Clicks == b.Clicks && a.ID < b.ID
+	})
+	for name, n := range byStore {
+		sum.StoreClicks = append(sum.StoreClicks, store.StoreClicks{Store: name, Clicks: n})
+	}
+	sort.Slice(sum.StoreClicks, func(i, j int) bool {
+		a, b := sum.StoreClicks[i], sum.StoreClicks[j]
+		return a.Clicks > b.Clicks || a.Clicks == b.Clicks && a.Store < b.Store
+	})
+	for q, n := range bySearch {
+		sum.TopSearches = append(sum.TopSearches, store.TopSearch{Query: q, Searches: n})
+	}
+	sort.Slice(sum.TopSearches, func(i, j int) bool {
+		a, b := sum.TopSearches[i], sum.TopSearches[j]
+		return a.Searches > b.Searches || a.Searches == b.Searches && a.Query < b.Query
+	})
+
+	for id, n := range byViews {
+		p := s.products[int(id)]
+		sum.MostViewed = append(sum.MostViewed, store.ViewedProduct{ID: id, Name: p.Name, Image: p.ImageURL, Views: n})
+	}
+	sort.Slice(sum.MostViewed, func(i, j int) bool {
+		a, b := sum.MostViewed[i], sum.MostViewed[j]
+		return a.Views > b.Views || a.Views == b.Views && a.ID < b.ID
+	})
+
+	sum.TrendingProducts = truncate(sum.TrendingProducts, 6)
+	sum.MostViewed = truncate(sum.MostViewed, 6)
+	sum.StoreClicks = truncate(sum.StoreClicks, 6)
+	sum.TopSearches = truncate(sum.TopSearches, 8)
+	// Reports read the events themselves, so they are never behind.
+	sum.AsOf = s.Now()
+	return sum, nil
+}
+
+func (s *Store) SearchReport(_ context.Context, days int) (store.SearchReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	from := s.since(days)
+
+	clicksByKey := map[string]int64{}
+	for _, c := range s.clicks {
+		if c.searchKey != "" && c.counted() {
+			clicksByKey[c.searchKey]++
+		}
+	}
+
+	zero := map[string]*store.ZeroResultQuery{}
+	conv := map[string]*store.QueryConversion{}
+	for _, se := range s.searches {
+		if se.at.Before(from) || se.Query == "" {
+			continue
+		}
+		q := normQuery(se.Query)
+		if se.ResultCount == 0 {
+			z := zero[q]
+			if z == nil {
+				z = &store.ZeroResultQuery{Query: q}
+				zero[q] = z
+			}
+			z.Searches++
+			if last := se.at.UTC().Format("2006-01-02T15:04:05"); last > z.LastSeen {
+				z.LastSeen = last
+			}
+			continue
+		}
+		qc := conv[q]
+		if qc == nil {
+			qc = &store.QueryConversion{Query: q}
+			conv[q] = qc
+		}
+		qc.Searches++
+		if n := clicksByKey[se.Key]; n > 0 && se.Key != "" {
+			qc.ClickedSearches++
+			qc.Clicks += n
+		}
+	}
+
+	rep := store.SearchReport{
+		ZeroResults: []store.ZeroResultQuery{},
+		Conversion:  []store.QueryConversion{},
+	}
+	for _, z := range zero {
+		rep.ZeroResults = append(rep.ZeroResults, *z)
+	}
+	sort.Slice(rep.ZeroResults, func(i, j int) bool {
+		a, b := rep.ZeroResults[i], rep.ZeroResults[j]
+		return a.Searches > b.Searches || a.Searches == b.Searches && a.Query < b.Query
+	})
+	for _, qc := range conv {
+		qc.ConversionRate = float64(qc.ClickedSearches) / float64(qc.Searches)
+		rep.Conversion = append(rep.Conversion, *qc)
+	}
+	sort.Slice(rep.Conversion, func(i, j int) bool {
+		a, b := rep.Conversion[i], rep.Conversion[j]
+		return a.Searches > b.Searches || a.Searches == b.Searches && a.Query < b.Query
+	})
+
+	rep.ZeroResults = truncate(rep.ZeroResults, 20)
+	rep.Conversion = truncate(rep.Conversion, 100)
+	rep.AsOf = s.Now()
+	return rep, nil
+}
+
+func (s *Store) ClickReport(_ context.Context, q store.ClickQuery) (store.ClickReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// Like the rollups store/postgres reads, count whole hours (hourly
+	// reports) or days.
+	unit := "day"
+	if q.Granularity == "hour" {
+		unit = "hour"
+	}
+	from := store.Truncate(q.From, unit)
+	in := func(t time.Time) bool {
+		b := store.Truncate(t, unit)
+		return !b.Before(from) && b.Before(q.To)
+	}
+	// group returns the key and label of an event; ok is false when the
+	// event has none (clicks on deleted products, views by store).
+	group := func(productID int64, storeID sql.NullInt64, isView bool) (key, label string, ok bool) {
+		p, found := s.products[int(productID)]
+		switch q.GroupBy {
+		case "product":
+			return strconv.Itoa(p.ID), p.Name, found
+		case "store":
+			name := ""
+			if storeID.Valid {
+				name = s.names[storeID.Int64]
+			}
+			return name, name, !isView
+		case "category":
+			return p.Category, p.Category, found
+		case "brand":
+			return p.Brand, p.Brand, found
+		}
+		return "", "", false
+	}
+
+	var totals, grouped []store.ClickCount
+	add := func(at time.Time, productID int64, storeID sql.NullInt64, c store.ClickCount) {
+		c.Bucket = store.Truncate(at, q.Granularity)
+		totals = append(totals, c)
+		if key, label, ok := group(productID, storeID, c.Views > 0); ok && c.Searches == 0 {
+			c.Key, c.Label = key, label
+			grouped = append(grouped, c)
+		}
+	}
+	for _, v := range s.views {
+		if in(v.at) && v.counted() {
+			add(v.at, v.productID, sql.NullInt64{}, store.ClickCount{Views: 1})
+		}
+	}
+	for _, c := range s.clicks {
+		if in(c.at) && c.counted() {
+			add(c.at, c.productID, c.storeID, store.ClickCount{Clicks: 1})
+		}
+	}
+	for _, se := range s.searches {
+		if in(se.at) {
+			add(se.at, 0, sql.NullInt64{}, store.ClickCount{Searches: 1})
+		}
+	}
+	rep := store.BuildClickReport(q, totals, grouped)
+	rep.AsOf = s.Now()
+	return rep, nil
+}
+
+func truncate[T any](s []T, n int) []T {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,253 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"go-ecommerce-backend/store"
+)
+
+// Export collects the rows under the lock and emits them afterwards. Ids
+// are positions in the event log; rollups are computed from the raw
+// events, like the rollup job would.
+func (s *Store) Export(_ context.Context, q store.ExportQuery, emit func(store.ExportRow) error) error {
+	s.mu.RLock()
+	var rows []store.ExportRow
+	switch q.Dataset {
+	case "clicks":
+		rows = s.exportClicks(q)
+	case "views":
+		rows = s.exportViews(q)
+	case "searches":
+		rows = s.exportSearches(q)
+	case "event-rollups":
+		rows = s.exportEventRollups(q)
+	case "search-rollups":
+		rows = s.exportSearchRollups(q)
+	default:
+		s.mu.RUnlock()
+		return fmt.Errorf("export: unknown dataset %q", q.Dataset)
+	}
+	s.mu.RUnlock()
+
+	for _, r := range rows {
+		if err := emit(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func inRange(t time.Time, q store.ExportQuery) bool {
+	return !t.Before(q.From) && t.Before(q.To)
+}
+
+// null maps the values store/postgres writes as NULL.
+func null[T comparable](v T) any {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return v
+}
+
+func nullID(id sql.NullInt64) any {
+	if !id.Valid {
+		return nil
+	}
+	return id.Int64
+}
+
+func (s *Store) productName(id int64) any {
+	if p, ok := s.products[int(id)]; ok {
+		return p.Name
+	}
+	return nil
+}
+
+func (s *Store) storeName(id sql.NullInt64) any {
+	if name, ok := s.names[id.Int64]; ok && id.Valid {
+		return name
+	}
+	return nil
+}
+
+func (s *Store) exportClicks(q store.ExportQuery) []store.ExportRow {
+	var out []store.ExportRow
+	for i, c := range s.clicks {
+		if inRange(c.at, q) {
+			out = append(out, store.ExportRow{
+				int64(i + 1), c.at, c.productID, s.productName(c.productID), nullID(c.storeID),
+				s.storeName(c.storeID), nullID(c.offerID), null(c.searchKey), null(c.sessionID),
+				null(c.referrer), c.bot, c.duplicate,
+			})
+		}
+	}
+	return out
+}
+
+func (s *Store) exportViews(q store.ExportQuery) []store.ExportRow {
+	var out []store.ExportRow
+	for i, v := range s.views {
+		if inRange(v.at, q) {
+			out = append(out, store.ExportRow{
+				int64(i + 1), v.at, v.productID, s.productName(v.productID), null(v.sessionID),
+				null(v.referrer), v.bot, v.duplicate,
+			})
+		}
+	}
+	return out
+}
+
+func (s *Store) exportSearches(q store.ExportQuery) []store.ExportRow {
+	var out []store.ExportRow
+	for i, se := range s.searches {
+		if inRange(se.at, q) {
+			filters, err := json.Marshal(se.Filters)
+			if err != nil || se.Filters == nil {
+				filters = []byte("{}")
+			}
+			out = append(out, store.ExportRow{
+				int64(i + 1), se.at, se.Query, se.Category, se.Sort, string(filters),
+				int64(se.ResultCount), se.Latency.Milliseconds(), null(se.Key),
+			})
+		}
+	}
+	return out
+}
+
+// rollupBucket is the hour or UTC day holding t.
+func rollupBucket(t time.Time, granularity string) time.Time {
+	if granularity != "hour" {
+		granularity = "day"
+	}
+	return store.Truncate(t, granularity)
+}
+
+func (s *Store) exportEventRollups(q store.ExportQuery) []store.ExportRow {
+	type key struct {
+		bucket           time.Time
+		product, storeID int64
+	}
+	type counts struct{ views, viewBots, viewDups, clicks, clickBots, clickDups int64 }
+	byKey := map[key]*counts{}
+	get := func(k key) *counts {
+		c := byKey[k]
+		if c == nil {
+			c = &counts{}
+			byKey[k] = c
+		}
+		return c
+	}
+	for _, v := range s.views {
+		b := rollupBucket(v.at, q.Granularity)
+		if !inRange(b, q) {
+			continue
+		}
+		c := get(key{b, v.productID, 0})
+		switch {
+		case v.bot:
+			c.viewBots++
+		case v.duplicate:
+			c.viewDups++
+		default:
+			c.views++
+		}
+	}
+	for _, cl := range s.clicks {
+		b := rollupBucket(cl.at, q.Granularity)
+		if !inRange(b, q) {
+			continue
+		}
+		c := get(key{b, cl.productID, cl.storeID.Int64})
+		switch {
+		case cl.bot:
+			c.clickBots++
+		case cl.duplicate:
+			c.clickDups++
+		default:
+			c.clicks++
+		}
+	}
+
+	keys := make([]key, 0, len(byKey))
+	for k := range byKey {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if !a.bucket.Equal(b.bucket) {
+			return a.bucket.Before(b.bucket)
+		}
+		if a.product != b.product {
+			return a.product < b.product
+		}
+		return a.storeID < b.storeID
+	})
+	out := make([]store.ExportRow, 0, len(keys))
+	for _, k := range keys {
+		c := byKey[k]
+		storeID := sql.NullInt64{Int64: k.storeID, Valid: k.storeID != 0}
+		out = append(out, store.ExportRow{
+			k.bucket, null(k.product), s.productName(k.product), nullID(storeID), s.storeName(storeID),
+			c.views, c.viewBots, c.viewDups, c.clicks, c.clickBots, c.clickDups,
+		})
+	}
+	return out
+}
+
+func (s *Store) exportSearchRollups(q store.ExportQuery) []store.ExportRow {
+	clicksByKey := map[string]int64{}
+	for _, c := range s.clicks {
+		if c.searchKey != "" && c.counted() {
+			clicksByKey[c.searchKey]++
+		}
+	}
+	type key struct {
+		bucket time.Time
+		query  string
+	}
+	type counts struct{ searches, zero, clicked, clicks int64 }
+	byKey := map[key]*counts{}
+	for _, se := range s.searches {
+		b := rollupBucket(se.at, q.Granularity)
+		if !inRange(b, q) {
+			continue
+		}
+		k := key{b, normQuery(se.Query)}
+		c := byKey[k]
+		if c == nil {
+			c = &counts{}
+			byKey[k] = c
+		}
+		c.searches++
+		if se.ResultCount == 0 {
+			c.zero++
+		} else if n := clicksByKey[se.Key]; n > 0 && se.Key != "" {
+			c.clicked++
+			c.clicks += n
+		}
+	}
+
+	keys := make([]key, 0, len(byKey))
+	for k := range byKey {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if !a.bucket.Equal(b.bucket) {
+			return a.bucket.Before(b.bucket)
+		}
+		return a.query < b.query
+	})
+	out := make([]store.ExportRow, 0, len(keys))
+	for _, k := range keys {
+		c := byKey[k]
+		out = append(out, store.ExportRow{k.bucket, k.query, c.searches, c.zero, c.clicked, c.clicks})
+	}
+	return out
+}
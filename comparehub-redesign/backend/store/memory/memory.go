@@ -0,0 +1,489 @@
+// Package memory is an in-process implementation of the store interfaces.
+// It mirrors the semantics of store/postgres closely enough for handler
+// tests and is safe for concurrent use.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-ecommerce-backend/store"
+)
+
+type offer struct {
+	store.Offer
+	storeID int64
+	active  bool
+}
+
+type click struct {
+	productID  int64
+	storeID    sql.NullInt64
+	offerID    sql.NullInt64
+	searchKey  string
+	sessionID  string
+	visitorKey string
+	referrer   string
+	bot        bool
+	duplicate  bool
+	at         time.Time
+}
+
+// counted reports whether analytics include c.
+func (c click) counted() bool { return !c.bot && !c.duplicate }
+
+type view struct {
+	productID  int64
+	sessionID  string
+	visitorKey string
+	referrer   string
+	bot        bool
+	duplicate  bool
+	at         time.Time
+}
+
+func (v view) counted() bool { return !v.bot && !v.duplicate }
+
+type coview struct {
+	visitors int64
+	last     time.Time
+}
+
+type search struct {
+	store.SearchEvent
+	at time.Time
+}
+
+// Store implements store.ProductStore, OfferStore, SpecStore,
+// AnalyticsStore and AdminStore.
+type Store struct {
+	mu       sync.RWMutex
+	products map[int]store.Product
+	nextID   int
+	stores   map[string]int64            // StoreKey -> id
+	names    map[int64]string            // id -> display name
+	params   map[int64]map[string]string // store id -> affiliate params
+	offers   []*offer
+	specs    map[int]store.Specs
+	searches []search
+	clicks   []click
+	views    []view
+	coviews  map[[2]int64]*coview // (product, other) -> pair stats
+	admins   map[string]string    // lower(email) -> password hash
+
+	// Now is the clock used for event timestamps; tests may replace it.
+	Now func() time.Time
+}
+
+func New() *Store {
+	return &Store{
+		products: map[int]store.Product{},
+		stores:   map[string]int64{},
+		names:    map[int64]string{},
+		params:   map[int64]map[string]string{},
+		specs:    map[int]store.Specs{},
+		coviews:  map[[2]int64]*coview{},
+		admins:   map[string]string{},
+		Now:      time.Now,
+	}
+}
+
+// Stores wires one Store into every interface.
+func (s *Store) Stores() store.Stores {
+	return store.Stores{Products: s, Offers: s, Specs: s, Analytics: s, Admins: s}
+}
+
+// Searches returns a copy of the recorded search events.
+func (s *Store) Searches() []store.SearchEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]store.SearchEvent, len(s.searches))
+	for i, se := range s.searches {
+		out[i] = se.SearchEvent
+	}
+	return out
+}
+
+// SetOfferActive toggles an offer the way a sync run deactivates stale ones.
+func (s *Store) SetOfferActive(id int64, active bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range s.offers {
+		if o.ID == id {
+			o.active = active
+		}
+	}
+}
+
+// SetAffiliateParams sets the affiliate query parameters of a store (the
+// stores.affiliate_params column), creating the store if needed.
+func (s *Store) SetAffiliateParams(storeName string, params map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.params[s.upsertStore(storeName)] = params
+}
+
+func matchesFilter(o *offer, f store.OfferFilter, keys map[string]bool) bool {
+	if !o.active {
+		return false
+	}
+	if f.Condition != "" && f.Condition != "Any" && o.Condition != f.Condition {
+		return false
+	}
+	return keys[store.StoreKey(o.Store)]
+}
+
+func keySet(names []string) map[string]bool {
+	m := map[string]bool{}
+	for _, k := range store.StoreKeys(names) {
+		m[k] = true
+	}
+	return m
+}
+
+// cheaper orders offers the way the best_offers table does: by price, then
+// higher rating (unrated last), then the earlier offer.
+func cheaper(a, b store.Offer) bool {
+	if a.Price != b.Price {
+		return a.Price < b.Price
+	}
+	if (a.Rating == nil) != (b.Rating == nil) {
+		return a.Rating != nil
+	}
+	if a.Rating != nil && *a.Rating != *b.Rating {
+		return *a.Rating > *b.Rating
+	}
+	return a.ID < b.ID
+}
+
+// bestOffer is the cheapest matching offer for a product (nil if none).
+func (s *Store) bestOffer(productID int, f store.OfferFilter, keys map[string]bool) *offer {
+	var best *offer
+	for _, o := range s.offers {
+		if o.ProductID != productID || !matchesFilter(o, f, keys) {
+			continue
+		}
+		if best == nil || cheaper(o.Offer, best.Offer) {
+			best = o
+		}
+	}
+	return best
+}
+
+// ---------------------------------------------------------------------
+// ProductStore
+// ---------------------------------------------------------------------
+
+func (s *Store) filteredProducts(q store.ProductQuery) []store.ProductRow {
+	keys := keySet(q.Offers.Stores)
+	search := strings.ToLower(q.Search)
+
+	out := []store.ProductRow{}
+	for _, p := range s.products {
+		if search != "" && !strings.Contains(strings.ToLower(p.Name), search) &&
+			!strings.Contains(strings.ToLower(p.Brand), search) {
+			continue
+		}
+		if q.Category != "all" && p.Category != q.Category {
+			continue
+		}
+		if q.Brand != "all" && !strings.EqualFold(p.Brand, q.Brand) {
+			continue
+		}
+
+		row := store.ProductRow{
+			ID: p.ID, Name: p.Name, Brand: p.Brand, Category: p.Category,
+			Description: p.Description, ImageURL: p.ImageURL,
+		}
+		bo := s.bestOffer(p.ID, q.Offers, keys)
+		if bo != nil {
+			row.BestPrice = bo.Price
+			row.BestSource = bo.Store
+			row.BestURL = bo.URL
+			row.BestOfferID = bo.ID
+			if bo.Rating != nil {
+				row.BestRating = *bo.Rating
+			}
+		}
+		// Like SQL, a bound filter never matches a product without offers.
+		if q.MinPrice != nil && (bo == nil || bo.Price < *q.MinPrice) {
+			continue
+		}
+		if q.MaxPrice != nil && (bo == nil || bo.Price > *q.MaxPrice) {
+			continue
+		}
+		if q.MinRating != nil && (bo == nil || row.BestRating < *q.MinRating) {
+			continue
+		}
+		if sp, ok := s.specs[p.ID]; ok {
+			row.ReviewCount = reviewCount(sp.Data["review_count"])
+		}
+		out = append(out, row)
+	}
+
+	desc := store.SortDescending(q.Sort)
+	sort.Slice(out, func(i, j int) bool {
+		a, b := store.SortValue(q.Sort, out[i]), store.SortValue(q.Sort, out[j])
+		if a != b {
+			if desc {
+				return a > b
+			}
+			return a < b
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// reviewCount mirrors (specs_json->>'review_count')::bigint.
+func reviewCount(v any) *int64 {
+	var n int64
+	switch x := v.(type) {
+	case float64:
+		n = int64(x)
+	case int:
+		n = int64(x)
+	case int64:
+		n = x
+	default:
+		return nil
+	}
+	return &n
+}
+
+func (s *Store) ListProducts(_ context.Context, q store.ProductQuery) ([]store.ProductRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows := s.filteredProducts(q)
+	if q.After != nil {
+		desc := store.SortDescending(q.Sort)
+		start := len(rows)
+		for i, r := range rows {
+			v := store.SortValue(q.Sort, r)
+			after := (v == q.After.Key && r.ID > q.After.ID) ||
+				(!desc && v > q.After.Key) || (desc && v < q.After.Key)
+			if after {
+				start = i
+				break
+			}
+		}
+		rows = rows[start:]
+	}
+	if q.Offset > 0 {
+		if q.Offset >= len(rows) {
+			return []store.ProductRow{}, nil
+		}
+		rows = rows[q.Offset:]
+	}
+	if q.Limit > 0 && len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+	}
+	return rows, nil
+}
+
+func (s *Store) CountProducts(_ context.Context, q store.ProductQuery) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.filteredProducts(q))), nil
+}
+
+func (s *Store) GetProduct(_ context.Context, id int) (store.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.products[id]
+	if !ok {
+		return store.Product{}, store.ErrNotFound
+	}
+	return p, nil
+}
+
+func (s *Store) GetProducts(_ context.Context, ids []int) ([]store.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []store.Product{}
+	for _, id := range ids {
+		if p, ok := s.products[id]; ok {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *Store) CreateProduct(_ context.Context, p store.Product) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	p.ID = s.nextID
+	s.products[p.ID] = p
+	return p.ID, nil
+}
+
+func (s *Store) TopDeals(_ context.Context, f store.OfferFilter, limit int) ([]store.TopDealRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := keySet(f.Stores)
+	out := []store.TopDealRow{}
+	for _, p := range s.products {
+		bo := s.bestOffer(p.ID, f, keys)
+		if bo == nil {
+			continue
+		}
+		price, source := bo.Price, bo.Store
+		out = append(out, store.TopDealRow{
+			ID: int64(p.ID), Name: p.Name, Brand: p.Brand, Category: p.Category, ImageURL: p.ImageURL,
+			BestPrice: &price, BestSource: &source, BestRating: bo.Rating,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if *out[i].BestPrice != *out[j].BestPrice {
+			return *out[i].BestPrice < *out[j].BestPrice
+		}
+		return out[i].ID < out[j].ID
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// ---------------------------------------------------------------------
+// OfferStore
+// ---------------------------------------------------------------------
+
+func (s *Store) ListOffers(_ context.Context, productIDs []int, f store.OfferFilter) ([]store.Offer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	want := map[int]bool{}
+	for _, id := range productIDs {
+		want[id] = true
+	}
+	keys := keySet(f.Stores)
+	out := []store.Offer{}
+	for _, o := range s.offers {
+		if want[o.ProductID] && matchesFilter(o, f, keys) {
+			out = append(out, o.Offer)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ProductID != out[j].ProductID {
+			return out[i].ProductID < out[j].ProductID
+		}
+		return cheaper(out[i], out[j])
+	})
+	return out, nil
+}
+
+func (s *Store) CreateOffer(_ context.Context, o store.NewOffer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.products[o.ProductID]; !ok {
+		return store.ErrInvalidReference
+	}
+	storeID := s.upsertStore(o.StoreName)
+	for _, existing := range s.offers {
+		if existing.ProductID == o.ProductID && existing.storeID == storeID && existing.URL == o.URL {
+			return store.ErrConflict
+		}
+	}
+	cond := o.Condition
+	if cond == "" {
+		cond = "New"
+	}
+	s.offers = append(s.offers, &offer{
+		Offer: store.Offer{
+			ID: int64(len(s.offers) + 1), ProductID: o.ProductID, Store: s.names[storeID],
+			Price: o.Price, Rating: o.Rating, URL: o.URL, Condition: cond,
+			LastSeenAt: s.Now(),
+		},
+		storeID: storeID,
+		active:  true,
+	})
+	return nil
+}
+
+func (s *Store) GetOfferLink(_ context.Context, id int64) (store.OfferLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, o := range s.offers {
+		if o.ID == id {
+			params := make(map[string]string, len(s.params[o.storeID]))
+			for k, v := range s.params[o.storeID] {
+				params[k] = v
+			}
+			return store.OfferLink{
+				OfferID: id, ProductID: int64(o.ProductID), StoreID: o.storeID,
+				URL: o.URL, AffiliateParams: params,
+			}, nil
+		}
+	}
+	return store.OfferLink{}, store.ErrNotFound
+}
+
+// upsertStore returns the id for name, creating the store if needed.
+// Callers hold the write lock.
+func (s *Store) upsertStore(name string) int64 {
+	key := store.StoreKey(name)
+	if id, ok := s.stores[key]; ok {
+		return id
+	}
+	id := int64(len(s.stores) + 1)
+	s.stores[key] = id
+	s.names[id] = strings.TrimSpace(name)
+	return id
+}
+
+// ---------------------------------------------------------------------
+// SpecStore
+// ---------------------------------------------------------------------
+
+func (s *Store) GetSpecs(_ context.Context, productIDs []int) (map[int]store.Specs, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := map[int]store.Specs{}
+	for _, id := range productIDs {
+		if sp, ok := s.specs[id]; ok {
+			out[id] = sp
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) UpsertSpecs(_ context.Context, productID int, specs map[string]any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.products[productID]; !ok {
+		return store.ErrInvalidReference
+	}
+	s.specs[productID] = store.Specs{Data: specs, LastUpdated: s.Now()}
+	return nil
+}
+
+// ---------------------------------------------------------------------
+// AdminStore
+// ---------------------------------------------------------------------
+
+func (s *Store) UpsertAdmin(_ context.Context, email, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.admins[strings.ToLower(strings.TrimSpace(email))] = passwordHash
+	return nil
+}
+
+func (s *Store) AdminPasswordHash(_ context.Context, email string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.admins[strings.ToLower(strings.TrimSpace(email))]
+	if !ok {
+		return "", store.ErrNotFound
+	}
+	return h, nil
+}
@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"go-ecommerce-backend/store"
+)
+
+func (s *Store) UpsertAdmin(ctx context.Context, email, passwordHash string) error {
+	_, err := tracedExec(ctx, s.db, "admins.upsert", `
+		INSERT INTO admin_users (email, password_hash)
+		VALUES ($1, $2)
+		ON CONFLICT (email)
+		DO UPDATE SET password_hash = EXCLUDED.password_hash, updated_at = now();
+	`, strings.ToLower(strings.TrimSpace(email)), passwordHash)
+	return err
+}
+
+func (s *Store) AdminPasswordHash(ctx context.Context, email string) (string, error) {
+	var hash string
+	err := tracedQueryRow(ctx, s.db, "admins.password_hash", `
+		SELECT password_hash FROM admin_users WHERE email = $1;
+	`, strings.ToLower(strings.TrimSpace(email))).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", store.ErrNotFound
+	}
+	return hash, err
+}
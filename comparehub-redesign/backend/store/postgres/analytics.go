@@ -0,0 +1,434 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"go-ecommerce-backend/store"
+)
+
+func (s *Store) RecordSearch(ctx context.Context, ev store.SearchEvent) error {
+	filters, err := json.Marshal(ev.Filters)
+	if err != nil {
+		filters = []byte("{}")
+	}
+	_, err = tracedExec(ctx, s.db, "search_events.insert", `
+		INSERT INTO search_events (query, category, sort, filters, result_count, latency_ms, search_key)
+		VALUES ($1, $2, $3, $4::jsonb, $5, $6, $7)
+	`, strings.TrimSpace(ev.Query), ev.Category, ev.Sort, string(filters),
+		ev.ResultCount, ev.Latency.Milliseconds(), ev.Key)
+	return err
+}
+
+func (s *Store) RecordClick(ctx context.Context, ev store.ClickEvent) (store.ClickResult, error) {
+	var res store.ClickResult
+	var err error
+	if ev.OfferID != 0 {
+		res.OfferID = sql.NullInt64{Int64: ev.OfferID, Valid: true}
+		res.StoreID = sql.NullInt64{Int64: ev.StoreID, Valid: ev.StoreID != 0}
+	} else {
+		// Resolve store_id by name (case-insensitive); unknown stores are
+		// recorded with a NULL store_id.
+		err = tracedQueryRow(ctx, s.db, "clicks.resolve_store", `
+			SELECT id FROM stores
+			WHERE lower(name) = lower($1)
+			LIMIT 1
+		`, ev.StoreName).Scan(&res.StoreID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return res, err
+		}
+	}
+
+	// Resolve offer_id by product_id + store_id + url (best effort)
+	if !res.OfferID.Valid && res.StoreID.Valid && strings.TrimSpace(ev.URL) != "" {
+		err = tracedQueryRow(ctx, s.db, "clicks.resolve_offer", `
+			SELECT id FROM offers
+			WHERE product_id = $1 AND store_id = $2 AND url = $3
+			LIMIT 1
+		`, ev.ProductID, res.StoreID.Int64, ev.URL).Scan(&res.OfferID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return res, err
+		}
+	}
+
+	// search_key is NULL unless the product was reached from a search.
+	// An unknown product_id fails the foreign key. The click is a
+	// duplicate when the visitor already has a counted click on the same
+	// offer within the window; two identical clicks racing each other may
+	// both count.
+	err = tracedQueryRow(ctx, s.db, "click_events.insert", `
+		INSERT INTO click_events (product_id, offer_id, store_id, search_key,
+		  session_id, visitor_key, ip_hash, user_agent, referrer, is_bot, is_duplicate)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+		  NOT $10 AND $11::float8 > 0 AND EXISTS (
+		    SELECT 1 FROM click_events
+		    WHERE visitor_key = $6 AND product_id = $1
+		      AND store_id IS NOT DISTINCT FROM $3 AND offer_id IS NOT DISTINCT FROM $2
+		      AND NOT is_bot AND NOT is_duplicate
+		      AND created_at >= now() - make_interval(secs => $11::float8)
+		  ))
+		RETURNING is_duplicate
+	`, ev.ProductID, res.OfferID, res.StoreID, nullString(ev.SearchKey),
+		nullString(ev.SessionID), nullString(ev.VisitorKey), nullString(ev.IPHash),
+		nullString(ev.UserAgent), nullString(ev.Referrer), ev.Bot, ev.DedupeWindow.Seconds(),
+	).Scan(&res.Duplicate)
+	return res, err
+}
+
+// nullString maps blank strings to NULL.
+func nullString(s string) sql.NullString {
+	s = strings.TrimSpace(s)
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// rollupsSince is the first daily bucket of a window of days whole UTC
+// days before today. The window is read from the daily rollups, which the
+// retention purge keeps; today's row covers the hours rolled up so far.
+const rollupsSince = `date_trunc('day', (now() - make_interval(days => $1)) AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'`
+
+// rolledUntil is the end of the rolled up events (AsOf of the reports),
+// zero before the first rollup.
+func (s *Store) rolledUntil(ctx context.Context) (time.Time, error) {
+	var t time.Time
+	err := tracedQueryRow(ctx, s.db, "analytics.rolled_until", `SELECT rolled_until FROM analytics_rollup_state`).Scan(&t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return t.UTC(), err
+}
+
+// Summary and SearchReport read the daily rollups (see package rollup), so
+// they trail the raw events by up to analytics.rollupInterval; AsOf says
+// how far they reach.
+func (s *Store) Summary(ctx context.Context, days int) (store.Summary, error) {
+	sum := store.Summary{
+		TrendingProducts: []store.TrendingProduct{},
+		StoreClicks:      []store.StoreClicks{},
+		TopSearches:      []store.TopSearch{},
+		MostViewed:       []store.ViewedProduct{},
+	}
+	var err error
+	if sum.AsOf, err = s.rolledUntil(ctx); err != nil {
+		return sum, err
+	}
+
+	// Raw vs counted clicks and views
+	err = tracedQueryRow(ctx, s.db, "summary.event_counts", `
+		SELECT COALESCE(SUM(clicks), 0), COALESCE(SUM(click_bots), 0), COALESCE(SUM(click_duplicates), 0),
+		       COALESCE(SUM(views), 0), COALESCE(SUM(view_bots), 0), COALESCE(SUM(view_duplicates), 0)
+		FROM event_rollups_daily
+		WHERE bucket >= `+rollupsSince+`
+	`, days).Scan(&sum.Clicks.Counted, &sum.Clicks.Bots, &sum.Clicks.Duplicates,
+		&sum.Views.Counted, &sum.Views.Bots, &sum.Views.Duplicates)
+	if err != nil {
+		return sum, err
+	}
+	sum.Clicks.Raw = sum.Clicks.Counted + sum.Clicks.Bots + sum.Clicks.Duplicates
+	sum.Views.Raw = sum.Views.Counted + sum.Views.Bots + sum.Views.Duplicates
+
+	// Trending products
+	rows, err := tracedQuery(ctx, s.db, "summary.trending_products", `
+		SELECT p.id, p.name, COALESCE(p.image_url, ''), SUM(r.clicks) AS n
+		FROM event_rollups_daily r
+		JOIN products p ON p.id = r.product_id
+		WHERE r.bucket >= `+rollupsSince+` AND r.clicks > 0
+		GROUP BY p.id, p.name, p.image_url
+		ORDER BY n DESC
+		LIMIT 6
+	`, days)
+	if err != nil {
+		return sum, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t store.TrendingProduct
+		if err := rows.Scan(&t.ID, &t.Name, &t.Image, &t.Clicks); err != nil {
+			return sum, err
+		}
+		sum.TrendingProducts = append(sum.TrendingProducts, t)
+	}
+	if err := rows.Err(); err != nil {
+		return sum, err
+	}
+
+	// Store click breakdown
+	rows2, err := tracedQuery(ctx, s.db, "summary.store_clicks", `
+		SELECT s.name, SUM(r.clicks) AS n
+		FROM event_rollups_daily r
+		JOIN stores s ON s.id = r.store_id
+		WHERE r.bucket >= `+rollupsSince+` AND r.clicks > 0
+		GROUP BY s.name
+		ORDER BY n DESC
+		LIMIT 6
+	`, days)
+	if err != nil {
+		return sum, err
+	}
+	defer rows2.Close()
+	for rows2.Next() {
+		var sc store.StoreClicks
+		if err := rows2.Scan(&sc.Store, &sc.Clicks); err != nil {
+			return sum, err
+		}
+		sum.StoreClicks = append(sum.StoreClicks, sc)
+	}
+	if err := rows2.Err(); err != nil {
+		return sum, err
+	}
+
+	// Trending searches
+	rows3, err := tracedQuery(ctx, s.db, "summary.top_searches", `
+		SELECT query, SUM(searches) AS n
+		FROM search_rollups_daily
+		WHERE bucket >= `+rollupsSince+` AND query <> ''
+		GROUP BY query
+		ORDER BY n DESC
+		LIMIT 8
+	`, days)
+	if err != nil {
+		return sum, err
+	}
+	defer rows3.Close()
+	for rows3.Next() {
+		var ts store.TopSearch
+		if err := rows3.Scan(&ts.Query, &ts.Searches); err != nil {
+			return sum, err
+		}
+		sum.TopSearches = append(sum.TopSearches, ts)
+	}
+	if err := rows3.Err(); err != nil {
+		return sum, err
+	}
+
+	// Most viewed products
+	rows4, err := tracedQuery(ctx, s.db, "summary.most_viewed", `
+		SELECT p.id, p.name, COALESCE(p.image_url, ''), SUM(r.views) AS n
+		FROM event_rollups_daily r
+		JOIN products p ON p.id = r.product_id
+		WHERE r.bucket >= `+rollupsSince+` AND r.views > 0
+		GROUP BY p.id, p.name, p.image_url
+		ORDER BY n DESC, p.id
+		LIMIT 6
+	`, days)
+	if err != nil {
+		return sum, err
+	}
+	defer rows4.Close()
+	for rows4.Next() {
+		var vp store.ViewedProduct
+		if err := rows4.Scan(&vp.ID, &vp.Name, &vp.Image, &vp.Views); err != nil {
+			return sum, err
+		}
+		sum.MostViewed = append(sum.MostViewed, vp)
+	}
+	if err := rows4.Err(); err != nil {
+		return sum, err
+	}
+
+	return sum, nil
+}
+
+func (s *Store) SearchReport(ctx context.Context, days int) (store.SearchReport, error) {
+	rep := store.SearchReport{
+		ZeroResults: []store.ZeroResultQuery{},
+		Conversion:  []store.QueryConversion{},
+	}
+	var err error
+	if rep.AsOf, err = s.rolledUntil(ctx); err != nil {
+		return rep, err
+	}
+
+	rows, err := tracedQuery(ctx, s.db, "search_report.zero_results", `
+		SELECT query, SUM(zero_results) AS n,
+		       to_char(MAX(last_zero_result_at), 'YYYY-MM-DD"T"HH24:MI:SS') AS last_seen
+		FROM search_rollups_daily
+		WHERE bucket >= `+rollupsSince+`
+		  AND query <> '' AND zero_results > 0
+		GROUP BY query
+		ORDER BY n DESC
+		LIMIT 20
+	`, days)
+	if err != nil {
+		return rep, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var z store.ZeroResultQuery
+		if err := rows.Scan(&z.Query, &z.Searches, &z.LastSeen); err != nil {
+			return rep, err
+		}
+		rep.ZeroResults = append(rep.ZeroResults, z)
+	}
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+
+	// One row per normalized query over the searches that had results;
+	// the rollup attributed clicks through the search key the client
+	// echoes back.
+	rows2, err := tracedQuery(ctx, s.db, "search_report.conversion", `
+		SELECT query, SUM(searches - zero_results) AS n,
+		       SUM(clicked_searches), SUM(clicks)
+		FROM search_rollups_daily
+		WHERE bucket >= `+rollupsSince+` AND query <> ''
+		GROUP BY query
+		HAVING SUM(searches - zero_results) > 0
+		ORDER BY n DESC
+		LIMIT 100
+	`, days)
+	if err != nil {
+		return rep, err
+	}
+	defer rows2.Close()
+	for rows2.Next() {
+		var q store.QueryConversion
+		if err := rows2.Scan(&q.Query, &q.Searches, &q.ClickedSearches, &q.Clicks); err != nil {
+			return rep, err
+		}
+		if q.Searches > 0 {
+			q.ConversionRate = float64(q.ClickedSearches) / float64(q.Searches)
+		}
+		rep.Conversion = append(rep.Conversion, q)
+	}
+	if err := rows2.Err(); err != nil {
+		return rep, err
+	}
+
+	return rep, nil
+}
+
+// RecordView flags the view as a duplicate like RecordClick; the
+// product_views_coview trigger pairs counted views into product_coviews.
+func (s *Store) RecordView(ctx context.Context, ev store.ViewEvent) (bool, error) {
+	var dup bool
+	err := tracedQueryRow(ctx, s.db, "product_views.insert", `
+		INSERT INTO product_views (product_id, session_id, visitor_key, ip_hash, user_agent, referrer,
+		  is_bot, is_duplicate)
+		VALUES ($1, $2, $3, $4, $5, $6, $7,
+		  NOT $7 AND $8::float8 > 0 AND EXISTS (
+		    SELECT 1 FROM product_views
+		    WHERE visitor_key = $3 AND product_id = $1
+		      AND NOT is_bot AND NOT is_duplicate
+		      AND created_at >= now() - make_interval(secs => $8::float8)
+		  ))
+		RETURNING is_duplicate
+	`, ev.ProductID, nullString(ev.SessionID), nullString(ev.VisitorKey), nullString(ev.IPHash),
+		nullString(ev.UserAgent), nullString(ev.Referrer), ev.Bot, ev.DedupeWindow.Seconds(),
+	).Scan(&dup)
+	return dup, err
+}
+
+func (s *Store) AlsoViewed(ctx context.Context, productID, limit int) ([]store.CoView, error) {
+	rows, err := tracedQuery(ctx, s.db, "product_coviews.list", `
+		SELECT other_id, visitors
+		FROM product_coviews
+		WHERE product_id = $1
+		ORDER BY visitors DESC, last_viewed_at DESC, other_id
+		LIMIT $2
+	`, productID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []store.CoView{}
+	for rows.Next() {
+		var cv store.CoView
+		if err := rows.Scan(&cv.ProductID, &cv.Visitors); err != nil {
+			return nil, err
+		}
+		out = append(out, cv)
+	}
+	return out, rows.Err()
+}
+
+// clickGroupColumns are the key and label of each ClickQuery.GroupBy;
+// p is the product and s the store of a rollup row.
+var clickGroupColumns = map[string][2]string{
+	"product":  {"p.id::text", "p.name"},
+	"store":    {"COALESCE(s.name, '')", "COALESCE(s.name, '')"},
+	"category": {"COALESCE(p.category, '')", "COALESCE(p.category, '')"},
+	"brand":    {"COALESCE(p.brand, '')", "COALESCE(p.brand, '')"},
+}
+
+// ClickReport reads the hourly rollups for hourly reports and the daily
+// ones otherwise, so buckets always count whole hours or days. Like
+// Summary it trails the raw events; AsOf says how far it reaches.
+func (s *Store) ClickReport(ctx context.Context, q store.ClickQuery) (store.ClickReport, error) {
+	asOf, err := s.rolledUntil(ctx)
+	if err != nil {
+		return store.ClickReport{}, err
+	}
+	events, searches, unit := "event_rollups_daily", "search_rollups_daily", "day"
+	if q.Granularity == "hour" {
+		events, searches, unit = "event_rollups_hourly", "search_rollups_hourly", "hour"
+	}
+	from := store.Truncate(q.From, unit)
+
+	// Buckets are UTC; date_trunc('week') starts weeks on Monday like
+	// store.Truncate.
+	totals, err := s.clickCounts(ctx, "click_report.totals", `
+		SELECT date_trunc($3, bucket AT TIME ZONE 'UTC') AS b, '', '', SUM(views), SUM(clicks), SUM(searches)
+		FROM (
+		  SELECT bucket, views, clicks, 0 AS searches
+		  FROM `+events+`
+		  WHERE bucket >= $1 AND bucket < $2
+		  UNION ALL
+		  SELECT bucket, 0, 0, searches
+		  FROM `+searches+`
+		  WHERE bucket >= $1 AND bucket < $2
+		) r
+		GROUP BY b
+	`, from, q.To, q.Granularity)
+	if err != nil {
+		return store.ClickReport{}, err
+	}
+
+	var grouped []store.ClickCount
+	if cols, ok := clickGroupColumns[q.GroupBy]; ok {
+		// Views have no store, so store groups only count clicks.
+		views, filter := "r.views", ""
+		if q.GroupBy == "store" {
+			views, filter = "0", "AND r.clicks > 0"
+		}
+		grouped, err = s.clickCounts(ctx, "click_report.groups", `
+		SELECT b, key, label, SUM(views), SUM(clicks), 0
+		FROM (
+		  SELECT date_trunc($3, r.bucket AT TIME ZONE 'UTC') AS b,
+		         `+cols[0]+` AS key, `+cols[1]+` AS label, `+views+` AS views, r.clicks
+		  FROM `+events+` r
+		  LEFT JOIN products p ON p.id = r.product_id
+		  LEFT JOIN stores s ON s.id = r.store_id
+		  WHERE r.bucket >= $1 AND r.bucket < $2 `+filter+`
+		) ev
+		WHERE key IS NOT NULL
+		GROUP BY b, key, label
+	`, from, q.To, q.Granularity)
+		if err != nil {
+			return store.ClickReport{}, err
+		}
+	}
+	rep := store.BuildClickReport(q, totals, grouped)
+	rep.AsOf = asOf
+	return rep, nil
+}
+
+func (s *Store) clickCounts(ctx context.Context, name, query string, args ...any) ([]store.ClickCount, error) {
+	rows, err := tracedQuery(ctx, s.db, name, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []store.ClickCount
+	for rows.Next() {
+		var c store.ClickCount
+		if err := rows.Scan(&c.Bucket, &c.Key, &c.Label, &c.Views, &c.Clicks, &c.Searches); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
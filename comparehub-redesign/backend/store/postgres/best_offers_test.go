@@ -0,0 +1,298 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq"
+
+	"go-ecommerce-backend/migrate"
+	"go-ecommerce-backend/store"
+)
+
+// These tests and benchmarks need a scratch database, which they migrate
+// and fill with 10k products and 100k offers (any existing data is
+// truncated):
+//
+//	COMPAREHUB_TEST_DATABASE_URL=postgres://localhost/comparehub_bench?sslmode=disable \
+//	  go test ./store/postgres -run BestOffers -bench . -benchtime 200x
+const testDatabaseEnv = "COMPAREHUB_TEST_DATABASE_URL"
+
+const (
+	benchProducts = 10000
+	benchOffers   = 10 // per product
+	benchStores   = 20
+)
+
+var (
+	benchOnce sync.Once
+	benchConn *sql.DB
+	benchErr  error
+)
+
+func testDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		tb.Skip(testDatabaseEnv + " not set")
+	}
+	benchOnce.Do(func() { benchConn, benchErr = openBenchDB(dsn) })
+	if benchErr != nil {
+		tb.Fatal(benchErr)
+	}
+	return benchConn
+}
+
+func openBenchDB(dsn string) (*sql.DB, error) {
+	ctx := context.Background()
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrate.New(conn).Up(ctx); err != nil {
+		return nil, err
+	}
+	var n int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM offers`).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n == benchProducts*benchOffers {
+		return conn, nil
+	}
+
+	// Offers go in through the trigger, like a sync would write them.
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, q := range []string{
+		`TRUNCATE products, stores RESTART IDENTITY CASCADE`,
+		`SELECT setseed(0.42)`,
+		`INSERT INTO stores (name) SELECT 'Store ' || i FROM generate_series(1, ` + strconv.Itoa(benchStores) + `) i`,
+		`INSERT INTO products (name, brand, category)
+		 SELECT 'Product ' || i, 'Brand ' || (i % 50), (ARRAY['Phones','Laptops','Headphones','Monitors'])[1 + i % 4]
+		 FROM generate_series(1, ` + strconv.Itoa(benchProducts) + `) i`,
+		`INSERT INTO offers (product_id, store_id, price, rating, url, condition, active)
+		 SELECT p, 1 + (p * 7 + k * 3) % ` + strconv.Itoa(benchStores) + `,
+		        round((20 + random() * 1500)::numeric, 2),
+		        CASE WHEN k % 5 = 0 THEN NULL ELSE round((1 + random() * 4)::numeric, 1) END,
+		        'https://example.com/' || p || '/' || k,
+		        CASE WHEN k % 3 = 0 THEN 'Used' ELSE 'New' END,
+		        k % 7 <> 0
+		 FROM generate_series(1, ` + strconv.Itoa(benchProducts) + `) p, generate_series(1, ` + strconv.Itoa(benchOffers) + `) k`,
+		`ANALYZE`,
+	} {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return nil, fmt.Errorf("seed: %w", err)
+		}
+	}
+	return conn, tx.Commit()
+}
+
+// lateralProductsBase is productsBase as it was before best_offers, which
+// sorts every offer of each product, with best_offers' tie-break added so
+// both return the same rows.
+var lateralProductsBase = `
+	SELECT
+	  p.id, p.name, COALESCE(p.brand,'') AS brand, COALESCE(p.category,'') AS category,
+	  COALESCE(p.description,'') AS description, COALESCE(p.image_url,'') AS image_url,
+	  COALESCE(bo.best_price, 0) AS best_price,
+	  COALESCE(bo.best_source, '') AS best_source,
+	  COALESCE(bo.best_rating, 0) AS best_rating,
+	  COALESCE(bo.best_url, '') AS best_url,
+	  (ps.specs_json->>'review_count')::bigint AS review_count
+	FROM products p
+	LEFT JOIN product_specs ps ON ps.product_id = p.id
+	LEFT JOIN LATERAL (
+	  SELECT o.price AS best_price, s.name AS best_source, COALESCE(o.rating, 0) AS best_rating, o.url AS best_url
+	  FROM offers o
+	  JOIN stores s ON s.id = o.store_id
+	  WHERE o.product_id = p.id
+	    AND o.active = true
+	    AND ` + conditionClause("o", 7) + `
+	    AND ` + storesClause(8) + `
+	  ORDER BY o.price ASC, o.rating DESC NULLS LAST, o.id ASC
+	  LIMIT 1
+	) bo ON true
+	WHERE
+	  ($1 = '' OR LOWER(p.name) LIKE LOWER('%' || $1 || '%') OR LOWER(p.brand) LIKE LOWER('%' || $1 || '%'))
+	  AND ($2 = 'all' OR p.category = $2)
+	  AND ($3 = 'all' OR LOWER(p.brand) = LOWER($3))
+	  AND ($4::numeric IS NULL OR bo.best_price >= $4)
+	  AND ($5::numeric IS NULL OR bo.best_price <= $5)
+	  AND ($6::numeric IS NULL OR bo.best_rating >= $6)
+`
+
+var lateralTopDeals = `
+	SELECT p.id, best.best_price
+	FROM products p
+	JOIN LATERAL (
+	  SELECT o.price AS best_price
+	  FROM offers o
+	  JOIN stores s ON s.id = o.store_id
+	  WHERE o.product_id = p.id
+	    AND o.active = true
+	    AND ` + conditionClause("o", 1) + `
+	    AND ` + storesClause(2) + `
+	  ORDER BY o.price ASC, o.rating DESC NULLS LAST, o.id ASC
+	  LIMIT 1
+	) best ON true
+	ORDER BY best.best_price ASC, p.id ASC
+	LIMIT $3`
+
+type bestRow struct {
+	id     int
+	price  float64
+	source string
+}
+
+func queryBest(tb testing.TB, db dbtx, base string, q store.ProductQuery) []bestRow {
+	tb.Helper()
+	args := append(productArgs(q), q.Limit)
+	rows, err := db.QueryContext(context.Background(),
+		`SELECT id, best_price, best_source FROM (`+base+`) t ORDER BY best_price ASC, id ASC LIMIT $9`, args...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rows.Close()
+	var out []bestRow
+	for rows.Next() {
+		var r bestRow
+		if err := rows.Scan(&r.id, &r.price, &r.source); err != nil {
+			tb.Fatal(err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		tb.Fatal(err)
+	}
+	return out
+}
+
+func benchStoreNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = "Store " + strconv.Itoa(i+1)
+	}
+	return names
+}
+
+func benchQueries() map[string]store.ProductQuery {
+	all := store.OfferFilter{Condition: "Any", Stores: benchStoreNames(benchStores)}
+	return map[string]store.ProductQuery{
+		"all stores":    {Category: "all", Brand: "all", Offers: all, Limit: 24},
+		"new, 3 stores": {Category: "all", Brand: "all", Offers: store.OfferFilter{Condition: "New", Stores: benchStoreNames(3)}, Limit: 24},
+		"used, laptops": {Category: "Laptops", Brand: "all", Offers: store.OfferFilter{Condition: "Used", Stores: benchStoreNames(benchStores)}, Limit: 24},
+		"search":        {Search: "product 12", Category: "all", Brand: "all", Offers: all, Limit: 24},
+	}
+}
+
+func TestBestOffersMatchLateralQuery(t *testing.T) {
+	conn := testDB(t)
+	for name, q := range benchQueries() {
+		want := queryBest(t, conn, lateralProductsBase, q)
+		got := queryBest(t, conn, productsBase, q)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s:\n got %v\nwant %v", name, got, want)
+		}
+	}
+}
+
+// The trigger must leave best_offers equal to a from-scratch recompute
+// after every kind of offer write. Runs in a transaction that is rolled
+// back, so the benchmark data is untouched.
+func TestBestOffersFollowOfferWrites(t *testing.T) {
+	conn := testDB(t)
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	const drift = `
+		WITH fresh AS (
+		  SELECT DISTINCT ON (o.product_id, o.condition, o.store_id)
+		    o.product_id, o.condition, o.store_id, lower(replace(s.name, ' ', '')) AS store_key,
+		    o.id AS offer_id, o.price, o.rating, o.url
+		  FROM offers o JOIN stores s ON s.id = o.store_id
+		  WHERE o.active
+		  ORDER BY o.product_id, o.condition, o.store_id, o.price ASC, o.rating DESC NULLS LAST, o.id ASC
+		), kept AS (
+		  SELECT product_id, condition, store_id, store_key, offer_id, price, rating, url FROM best_offers
+		)
+		SELECT COUNT(*) FROM ((SELECT * FROM fresh EXCEPT SELECT * FROM kept) UNION ALL (SELECT * FROM kept EXCEPT SELECT * FROM fresh)) d`
+
+	for _, step := range []struct{ name, sql string }{
+		{"price drop", `UPDATE offers SET price = price / 3 WHERE product_id <= 50 AND id % 2 = 0`},
+		{"price rise", `UPDATE offers SET price = price * 3 WHERE product_id BETWEEN 51 AND 100`},
+		{"deactivate", `UPDATE offers SET active = false WHERE product_id <= 100 AND id % 3 = 0`},
+		{"reactivate", `UPDATE offers SET active = true WHERE product_id <= 30`},
+		{"condition change", `UPDATE offers SET condition = 'Refurbished' WHERE product_id BETWEEN 101 AND 120`},
+		{"move store", `UPDATE offers SET store_id = 1 + store_id % 20 WHERE product_id BETWEEN 121 AND 140`},
+		{"delete", `DELETE FROM offers WHERE product_id BETWEEN 141 AND 160 AND id % 2 = 1`},
+		{"insert", `INSERT INTO offers (product_id, store_id, price, url) SELECT id, 1, 1, 'https://example.com/new/' || id FROM products WHERE id <= 40`},
+		{"rename store", `UPDATE stores SET name = 'Renamed Store' WHERE id = 2`},
+		{"delete product", `DELETE FROM products WHERE id BETWEEN 161 AND 170`},
+		{"sync touch", `UPDATE offers SET last_seen_at = NOW() WHERE product_id <= 200`},
+	} {
+		if _, err := tx.ExecContext(ctx, step.sql); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		var n int
+		if err := tx.QueryRowContext(ctx, drift).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Fatalf("after %s: best_offers differs from offers in %d rows", step.name, n)
+		}
+	}
+}
+
+func BenchmarkListProducts(b *testing.B) {
+	conn := testDB(b)
+	for name, q := range benchQueries() {
+		for _, impl := range []struct{ name, base string }{
+			{"lateral", lateralProductsBase},
+			{"best_offers", productsBase},
+		} {
+			b.Run(name+"/"+impl.name, func(b *testing.B) {
+				for b.Loop() {
+					queryBest(b, conn, impl.base, q)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkTopDeals(b *testing.B) {
+	conn := testDB(b)
+	st := New(conn)
+	f := store.OfferFilter{Condition: "Any", Stores: benchStoreNames(benchStores)}
+	ctx := context.Background()
+
+	b.Run("lateral", func(b *testing.B) {
+		for b.Loop() {
+			rows, err := conn.QueryContext(ctx, lateralTopDeals, f.Condition, pq.Array(store.StoreKeys(f.Stores)), 12)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for rows.Next() {
+			}
+			rows.Close()
+		}
+	})
+	b.Run("best_offers", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := st.TopDeals(ctx, f, 12); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go-ecommerce-backend/store"
+)
+
+// exportQueries select the columns of store.ExportColumns; $1 and $2 bound
+// the time range. Rollup queries name their table {table}, replaced by the
+// hourly or daily one. Zero ids in the rollups (no product or store) are
+// exported as NULL.
+var exportQueries = map[string]string{
+	"clicks": `
+		SELECT c.id, c.created_at, c.product_id, p.name, c.store_id, s.name, c.offer_id,
+		       c.search_key, c.session_id, c.referrer, c.is_bot, c.is_duplicate
+		FROM click_events c
+		LEFT JOIN products p ON p.id = c.product_id
+		LEFT JOIN stores s ON s.id = c.store_id
+		WHERE c.created_at >= $1 AND c.created_at < $2
+		ORDER BY c.created_at, c.id`,
+	"views": `
+		SELECT v.id, v.created_at, v.product_id, p.name, v.session_id, v.referrer, v.is_bot, v.is_duplicate
+		FROM product_views v
+		LEFT JOIN products p ON p.id = v.product_id
+		WHERE v.created_at >= $1 AND v.created_at < $2
+		ORDER BY v.created_at, v.id`,
+	"searches": `
+		SELECT id, created_at, query, category, sort, filters::text, result_count, latency_ms, search_key
+		FROM search_events
+		WHERE created_at >= $1 AND created_at < $2
+		ORDER BY created_at, id`,
+	"event-rollups": `
+		SELECT r.bucket, NULLIF(r.product_id, 0), p.name, NULLIF(r.store_id, 0), s.name,
+		       r.views, r.view_bots, r.view_duplicates, r.clicks, r.click_bots, r.click_duplicates
+		FROM event_rollups_{table} r
+		LEFT JOIN products p ON p.id = r.product_id
+		LEFT JOIN stores s ON s.id = r.store_id
+		WHERE r.bucket >= $1 AND r.bucket < $2
+		ORDER BY r.bucket, r.product_id, r.store_id`,
+	"search-rollups": `
+		SELECT bucket, query, searches, zero_results, clicked_searches, clicks
+		FROM search_rollups_{table}
+		WHERE bucket >= $1 AND bucket < $2
+		ORDER BY bucket, query`,
+}
+
+func (s *Store) Export(ctx context.Context, q store.ExportQuery, emit func(store.ExportRow) error) error {
+	query, ok := exportQueries[q.Dataset]
+	if !ok {
+		return fmt.Errorf("export: unknown dataset %q", q.Dataset)
+	}
+	table := "daily"
+	if q.Granularity == "hour" {
+		table = "hourly"
+	}
+	query = strings.ReplaceAll(query, "{table}", table)
+
+	// lib/pq reads rows off the connection as they are scanned, so only
+	// one row is held at a time.
+	rows, err := tracedQuery(ctx, s.db, "analytics.export", query, q.From, q.To)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	n := len(store.ExportColumns[q.Dataset])
+	vals := make([]any, n)
+	dest := make([]any, n)
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		row := make(store.ExportRow, n)
+		for i, v := range vals {
+			// Text and jsonb columns arrive as []byte.
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			row[i] = v
+		}
+		if err := emit(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
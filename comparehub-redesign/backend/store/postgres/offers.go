@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"go-ecommerce-backend/store"
+)
+
+func (s *Store) ListOffers(ctx context.Context, productIDs []int, f store.OfferFilter) ([]store.Offer, error) {
+	out := []store.Offer{}
+	if len(productIDs) == 0 {
+		return out, nil
+	}
+	n := len(productIDs)
+	args := append(intArgs(productIDs), f.Condition, pq.Array(store.StoreKeys(f.Stores)))
+
+	rows, err := tracedQuery(ctx, s.db, "offers.list", `
+		SELECT o.id, o.product_id, s.name, o.price, o.rating, o.url, o.condition, o.last_seen_at::timestamptz
+		FROM offers o
+		JOIN stores s ON s.id = o.store_id
+		WHERE o.active = true
+		  AND `+conditionClause("o", n+1)+`
+		  AND `+storesClause(n+2)+`
+		  AND o.product_id IN (`+placeholders(1, n)+`)
+		ORDER BY o.product_id, o.price ASC, o.rating DESC NULLS LAST, o.id ASC;
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o store.Offer
+		var seen sql.NullTime
+		if err := rows.Scan(&o.ID, &o.ProductID, &o.Store, &o.Price, &o.Rating, &o.URL, &o.Condition, &seen); err != nil {
+			return nil, err
+		}
+		o.LastSeenAt = seen.Time
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CreateOffer(ctx context.Context, o store.NewOffer) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Upsert store
+	var storeID int
+	err = tracedQueryRow(ctx, tx, "offers.upsert_store", `
+		INSERT INTO stores (name) VALUES ($1)
+		ON CONFLICT (name) DO UPDATE SET name=EXCLUDED.name
+		RETURNING id;
+	`, o.StoreName).Scan(&storeID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tracedExec(ctx, tx, "offers.insert", `
+		INSERT INTO offers (product_id, store_id, price, rating, url, condition, active, last_seen_at)
+		VALUES ($1,$2,$3,$4,$5,COALESCE(NULLIF($6,''),'New'),true,NOW());
+	`, o.ProductID, storeID, o.Price, o.Rating, o.URL, o.Condition)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) GetOfferLink(ctx context.Context, id int64) (store.OfferLink, error) {
+	l := store.OfferLink{OfferID: id}
+	var params []byte
+	err := tracedQueryRow(ctx, s.db, "offers.link", `
+		SELECT o.product_id, o.store_id, o.url, s.affiliate_params
+		FROM offers o
+		JOIN stores s ON s.id = o.store_id
+		WHERE o.id = $1
+	`, id).Scan(&l.ProductID, &l.StoreID, &l.URL, &params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return l, store.ErrNotFound
+	}
+	if err != nil {
+		return l, err
+	}
+	// Non-string values (numbers, booleans) are kept in their JSON form.
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(params, &raw); err != nil {
+		return l, err
+	}
+	l.AffiliateParams = make(map[string]string, len(raw))
+	for k, v := range raw {
+		var str string
+		if json.Unmarshal(v, &str) != nil {
+			str = string(v)
+		}
+		l.AffiliateParams[k] = str
+	}
+	return l, nil
+}
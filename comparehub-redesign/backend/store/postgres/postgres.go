@@ -0,0 +1,118 @@
+// Package postgres implements the store interfaces on top of the CompareHub
+// Postgres schema (see the migrate package).
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"go-ecommerce-backend/store"
+	"go-ecommerce-backend/tracing"
+)
+
+// Store implements store.ProductStore, OfferStore, SpecStore,
+// AnalyticsStore and AdminStore.
+type Store struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Stores wires one Store into every interface.
+func Stores(db *sql.DB) store.Stores {
+	s := New(db)
+	return store.Stores{Products: s, Offers: s, Specs: s, Analytics: s, Admins: s}
+}
+
+// dbtx is satisfied by *sql.DB and *sql.Tx.
+type dbtx interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// The traced* helpers wrap each statement in a "db <name>" span (see
+// tracing.StartQuery). For queries the span ends once the first row is
+// available, so it measures the database, not our row scanning.
+
+func tracedQuery(ctx context.Context, db dbtx, name, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := tracing.StartQuery(ctx, name)
+	rows, err := db.QueryContext(ctx, query, args...)
+	tracing.End(span, err)
+	return rows, err
+}
+
+func tracedQueryRow(ctx context.Context, db dbtx, name, query string, args ...any) *sql.Row {
+	ctx, span := tracing.StartQuery(ctx, name)
+	row := db.QueryRowContext(ctx, query, args...)
+	tracing.End(span, row.Err())
+	return row
+}
+
+func tracedExec(ctx context.Context, db dbtx, name, query string, args ...any) (sql.Result, error) {
+	ctx, span := tracing.StartQuery(ctx, name)
+	res, err := db.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return res, err
+}
+
+// conditionClause is the SQL matching the condition column of table alias
+// t (offers or best_offers) against placeholder n; "Any" (and "") match
+// every offer.
+func conditionClause(t string, n int) string {
+	p := "$" + strconv.Itoa(n)
+	return "(" + p + " IN ('', 'Any') OR " + t + ".condition = " + p + ")"
+}
+
+// bestOfferLateral selects the best offer of product p under the condition
+// in placeholder condN among the store keys in placeholder storesN: the
+// cheapest of p's best_offers cells, ties going to the higher rating. Its
+// columns are best_price, best_source, best_rating (nullable), best_url and
+// best_offer_id.
+func bestOfferLateral(condN, storesN int) string {
+	return `LATERAL (
+	  SELECT
+	    b.price  AS best_price,
+	    s.name   AS best_source,
+	    b.rating AS best_rating,
+	    b.url    AS best_url,
+	    b.offer_id AS best_offer_id
+	  FROM best_offers b
+	  JOIN stores s ON s.id = b.store_id
+	  WHERE b.product_id = p.id
+	    AND ` + conditionClause("b", condN) + `
+	    AND b.store_key = ANY($` + strconv.Itoa(storesN) + `)
+	  ORDER BY b.price ASC, b.rating DESC NULLS LAST, b.offer_id ASC
+	  LIMIT 1
+	)`
+}
+
+// storesClause matches a store name against placeholder n holding
+// store.StoreKeys.
+func storesClause(n int) string {
+	return "lower(replace(s.name, ' ', '')) = ANY($" + strconv.Itoa(n) + ")"
+}
+
+// placeholders returns "$from,$from+1,..." for count values.
+func placeholders(from, count int) string {
+	b := make([]byte, 0, count*4)
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '$')
+		b = strconv.AppendInt(b, int64(from+i), 10)
+	}
+	return string(b)
+}
+
+func intArgs(ids []int) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
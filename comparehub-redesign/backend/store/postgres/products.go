@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/lib/pq"
+
+	"go-ecommerce-backend/store"
+)
+
+// productsBase selects every product matching the search filters together
+// with its best (cheapest) offer, looked up in best_offers. Placeholders
+// $1..$8 are bound by productArgs.
+var productsBase = `
+	SELECT
+	  p.id, p.name, COALESCE(p.brand,'') AS brand, COALESCE(p.category,'') AS category,
+	  COALESCE(p.description,'') AS description, COALESCE(p.image_url,'') AS image_url,
+	  COALESCE(bo.best_price, 0) AS best_price,
+	  COALESCE(bo.best_source, '') AS best_source,
+	  COALESCE(bo.best_rating, 0) AS best_rating,
+	  COALESCE(bo.best_url, '') AS best_url,
+	  COALESCE(bo.best_offer_id, 0) AS best_offer_id,
+	  (ps.specs_json->>'review_count')::bigint AS review_count
+	FROM products p
+	LEFT JOIN product_specs ps ON ps.product_id = p.id
+	LEFT JOIN ` + bestOfferLateral(7, 8) + ` bo ON true
+	WHERE
+	  ($1 = '' OR LOWER(p.name) LIKE LOWER('%' || $1 || '%') OR LOWER(p.brand) LIKE LOWER('%' || $1 || '%'))
+	  AND ($2 = 'all' OR p.category = $2)
+	  AND ($3 = 'all' OR LOWER(p.brand) = LOWER($3))
+	  AND ($4::numeric IS NULL OR bo.best_price >= $4)
+	  AND ($5::numeric IS NULL OR bo.best_price <= $5)
+	  AND ($6::numeric IS NULL OR bo.best_rating >= $6)
+`
+
+func productArgs(q store.ProductQuery) []any {
+	return []any{
+		q.Search, q.Category, q.Brand, q.MinPrice, q.MaxPrice, q.MinRating,
+		q.Offers.Condition, pq.Array(store.StoreKeys(q.Offers.Stores)),
+	}
+}
+
+func (s *Store) ListProducts(ctx context.Context, q store.ProductQuery) ([]store.ProductRow, error) {
+	sortKey := "best_price"
+	if q.Sort == "rating" {
+		sortKey = "best_rating"
+	}
+	sortDir, cmp := "ASC", ">"
+	if store.SortDescending(q.Sort) {
+		sortDir, cmp = "DESC", "<"
+	}
+
+	// p.id breaks ties so the order (and therefore paging) is stable.
+	args := productArgs(q)
+	where := "true"
+	if q.After != nil {
+		where = "(" + sortKey + " " + cmp + " $9::numeric OR (" + sortKey + " = $9::numeric AND id > $10))"
+		args = append(args, strconv.FormatFloat(q.After.Key, 'f', -1, 64), q.After.ID)
+	}
+	n := len(args)
+	args = append(args, q.Limit, q.Offset)
+
+	query := `SELECT * FROM (` + productsBase + `) t
+		WHERE ` + where + `
+		ORDER BY ` + sortKey + ` ` + sortDir + `, id ASC
+		LIMIT $` + strconv.Itoa(n+1) + ` OFFSET $` + strconv.Itoa(n+2) + `;`
+
+	rows, err := tracedQuery(ctx, s.db, "products.list", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.ProductRow{}
+	for rows.Next() {
+		var r store.ProductRow
+		if err := rows.Scan(
+			&r.ID, &r.Name, &r.Brand, &r.Category, &r.Description, &r.ImageURL,
+			&r.BestPrice, &r.BestSource, &r.BestRating, &r.BestURL, &r.BestOfferID,
+			&r.ReviewCount,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CountProducts(ctx context.Context, q store.ProductQuery) (int64, error) {
+	var total int64
+	err := tracedQueryRow(ctx, s.db, "products.count", `SELECT COUNT(*) FROM (`+productsBase+`) t;`, productArgs(q)...).Scan(&total)
+	return total, err
+}
+
+func (s *Store) GetProduct(ctx context.Context, id int) (store.Product, error) {
+	var p store.Product
+	err := tracedQueryRow(ctx, s.db, "products.get", `
+		SELECT id, name, COALESCE(brand,''), COALESCE(category,''), COALESCE(description,''), COALESCE(image_url,'')
+		FROM products
+		WHERE id = $1;
+	`, id).Scan(&p.ID, &p.Name, &p.Brand, &p.Category, &p.Description, &p.ImageURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, store.ErrNotFound
+	}
+	return p, err
+}
+
+func (s *Store) GetProducts(ctx context.Context, ids []int) ([]store.Product, error) {
+	out := []store.Product{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	rows, err := tracedQuery(ctx, s.db, "products.get_many", `
+		SELECT id, name, COALESCE(brand,''), COALESCE(category,''), COALESCE(description,''), COALESCE(image_url,'')
+		FROM products
+		WHERE id IN (`+placeholders(1, len(ids))+`)
+		ORDER BY id;
+	`, intArgs(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p store.Product
+		if err := rows.Scan(&p.ID, &p.Name, &p.Brand, &p.Category, &p.Description, &p.ImageURL); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CreateProduct(ctx context.Context, p store.Product) (int, error) {
+	var id int
+	err := tracedQueryRow(ctx, s.db, "products.insert", `
+		INSERT INTO products (name, brand, category, description, image_url)
+		VALUES ($1,$2,$3,$4,$5)
+		RETURNING id;
+	`, p.Name, p.Brand, p.Category, p.Description, p.ImageURL).Scan(&id)
+	return id, err
+}
+
+func (s *Store) TopDeals(ctx context.Context, f store.OfferFilter, limit int) ([]store.TopDealRow, error) {
+	rows, err := tracedQuery(ctx, s.db, "products.top_deals", `
+		SELECT
+			p.id,
+			p.name,
+			COALESCE(p.brand, '') AS brand,
+			COALESCE(p.category, '') AS category,
+			COALESCE(p.image_url, '') AS image_url,
+			best.best_price,
+			best.best_source,
+			best.best_rating
+		FROM products p
+		JOIN `+bestOfferLateral(1, 2)+` best ON true
+		ORDER BY best.best_price ASC, p.id ASC
+		LIMIT $3
+	`, f.Condition, pq.Array(store.StoreKeys(f.Stores)), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []store.TopDealRow{}
+	for rows.Next() {
+		var r store.TopDealRow
+		if err := rows.Scan(
+			&r.ID, &r.Name, &r.Brand, &r.Category, &r.ImageURL,
+			&r.BestPrice, &r.BestSource, &r.BestRating,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+
+	"go-ecommerce-backend/store"
+)
+
+func (s *Store) GetSpecs(ctx context.Context, productIDs []int) (map[int]store.Specs, error) {
+	out := map[int]store.Specs{}
+	if len(productIDs) == 0 {
+		return out, nil
+	}
+	rows, err := tracedQuery(ctx, s.db, "specs.get", `
+		SELECT product_id, specs_json, last_updated
+		FROM product_specs
+		WHERE product_id IN (`+placeholders(1, len(productIDs))+`);
+	`, intArgs(productIDs)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pid int
+		var raw []byte
+		var sp store.Specs
+		if err := rows.Scan(&pid, &raw, &sp.LastUpdated); err != nil {
+			return nil, err
+		}
+		// Malformed JSON leaves Data nil rather than failing the request.
+		_ = json.Unmarshal(raw, &sp.Data)
+		out[pid] = sp
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) UpsertSpecs(ctx context.Context, productID int, specs map[string]any) error {
+	b, err := json.Marshal(specs)
+	if err != nil {
+		return err
+	}
+	_, err = tracedExec(ctx, s.db, "specs.upsert", `
+		INSERT INTO product_specs (product_id, specs_json, last_updated)
+		VALUES ($1, $2::jsonb, NOW())
+		ON CONFLICT (product_id)
+		DO UPDATE SET specs_json = EXCLUDED.specs_json, last_updated = NOW();
+	`, productID, string(b))
+	return err
+}
@@ -0,0 +1,352 @@
+// Package store defines the data access interfaces used by the HTTP
+// handlers. store/postgres holds the production queries; store/memory is an
+// in-process implementation used by the handler tests.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a looked-up row does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidReference is returned when a write points at a missing row
+	// (the in-memory counterpart of a foreign key violation).
+	ErrInvalidReference = errors.New("invalid reference")
+	// ErrConflict is returned when a write would duplicate a unique row.
+	ErrConflict = errors.New("conflict")
+)
+
+// OfferFilter selects which offers count: Condition "Any" (or "") matches
+// every condition; Stores are matched ignoring case and spaces, so
+// "Best Buy" matches "BestBuy".
+type OfferFilter struct {
+	Condition string
+	Stores    []string
+}
+
+// Keyset is the position after which the next page starts: the sort key of
+// the last row seen and its id.
+type Keyset struct {
+	Key float64
+	ID  int
+}
+
+// ProductQuery is a /products search.
+type ProductQuery struct {
+	Search    string
+	Category  string // "all" matches every category
+	Brand     string // "all" matches every brand
+	MinPrice  *float64
+	MaxPrice  *float64
+	MinRating *float64
+	Sort      string // low | high | rating
+	Offers    OfferFilter
+	Limit     int
+	Offset    int
+	After     *Keyset
+}
+
+type Product struct {
+	ID          int
+	Name        string
+	Brand       string
+	Category    string
+	Description string
+	ImageURL    string
+}
+
+// ProductRow is a product with its best offer under the request's filters.
+type ProductRow struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Brand       string `json:"brand"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	ImageURL    string `json:"imageUrl"`
+
+	BestPrice  float64 `json:"bestPrice"`
+	BestSource string  `json:"bestSource"`
+	BestRating float64 `json:"bestRating"`
+	BestURL    string  `json:"bestUrl"`
+	// BestOfferID is 0 when the product has no matching offer.
+	BestOfferID int64  `json:"bestOfferId,omitempty"`
+	BestLink    string `json:"bestLink,omitempty"` // set by the handlers
+
+	ReviewCount *int64 `json:"reviewCount,omitempty"`
+}
+
+type TopDealRow struct {
+	ID         int64    `json:"id"`
+	Name       string   `json:"name"`
+	Brand      string   `json:"brand"`
+	Category   string   `json:"category"`
+	ImageURL   string   `json:"imageUrl"`
+	BestPrice  *float64 `json:"bestPrice"`
+	BestSource *string  `json:"bestSource"`
+	BestRating *float64 `json:"bestRating"`
+}
+
+type Offer struct {
+	ID        int64
+	ProductID int
+	Store     string
+	Price     float64
+	Rating    *float64
+	URL       string
+	Condition string
+	// LastSeenAt is when a write (sync or admin) last confirmed the offer.
+	LastSeenAt time.Time
+}
+
+// NewOffer is an offer to insert; the store row is created if missing and
+// an empty Condition means "New".
+type NewOffer struct {
+	ProductID int
+	StoreName string
+	Price     float64
+	Rating    *float64
+	URL       string
+	Condition string
+}
+
+// OfferLink is where GET /go/:offerId sends a shopper.
+type OfferLink struct {
+	OfferID   int64
+	ProductID int64
+	StoreID   int64
+	URL       string
+	// AffiliateParams are the store's query parameters to add to URL.
+	AffiliateParams map[string]string
+}
+
+type Specs struct {
+	Data        map[string]any
+	LastUpdated time.Time
+}
+
+// SearchEvent is one search (the first page of a /products call with a
+// query) as stored in search_events. ResultCount is the number of
+// matching products, not the page length.
+type SearchEvent struct {
+	Key         string
+	Query       string
+	Category    string
+	Sort        string
+	Filters     map[string]any
+	ResultCount int
+	Latency     time.Duration
+}
+
+// ClickEvent is an outbound click, from GET /go/:offerId or reported by
+// the frontend. The visitor fields arrive anonymized (see
+// handlers.TrackClick): SessionID and IPHash are keyed hashes, Referrer
+// has no query string.
+type ClickEvent struct {
+	ProductID int64
+	// OfferID and StoreID attribute the click directly; without them the
+	// offer is looked up by StoreName and URL (best effort).
+	OfferID   int64
+	StoreID   int64
+	StoreName string
+	URL       string
+	SearchKey string
+
+	SessionID string
+	// VisitorKey identifies the visitor for deduplication: SessionID when
+	// the client sent one, otherwise a hash of IP and user agent.
+	VisitorKey string
+	IPHash     string
+	UserAgent  string
+	Referrer   string
+	// Bot clicks are stored but never counted.
+	Bot bool
+	// A click by the same visitor on the same product, store and offer
+	// within DedupeWindow of a counted click is stored as a duplicate.
+	// Zero disables deduplication.
+	DedupeWindow time.Duration
+}
+
+// ClickResult reports how a click was recorded.
+type ClickResult struct {
+	// StoreID and OfferID are NULL when they could not be resolved.
+	StoreID, OfferID sql.NullInt64
+	// Duplicate is set when the click repeats a counted one.
+	Duplicate bool
+}
+
+type TrendingProduct struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Image  string `json:"imageUrl"`
+	Clicks int64  `json:"clicks"`
+}
+
+type StoreClicks struct {
+	Store  string `json:"store"`
+	Clicks int64  `json:"clicks"`
+}
+
+type TopSearch struct {
+	Query    string `json:"query"`
+	Searches int64  `json:"searches"`
+}
+
+// ClickCounts splits the recorded clicks into those analytics count and
+// those filtered out as bots or duplicates.
+type ClickCounts struct {
+	Raw        int64 `json:"raw"`
+	Bots       int64 `json:"bots"`
+	Duplicates int64 `json:"duplicates"`
+	Counted    int64 `json:"counted"`
+}
+
+// ViewCounts is the same split for product views.
+type ViewCounts ClickCounts
+
+type ViewedProduct struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Image string `json:"imageUrl"`
+	Views int64  `json:"views"`
+}
+
+// Summary counts only the clicks in Clicks.Counted and the views in
+// Views.Counted.
+type Summary struct {
+	TrendingProducts []TrendingProduct
+	StoreClicks      []StoreClicks
+	TopSearches      []TopSearch
+	MostViewed       []ViewedProduct
+	Clicks           ClickCounts
+	Views            ViewCounts
+	// AsOf is how far the counts reach: reports read rollups, so later
+	// events are not in them yet. Zero before the first rollup.
+	AsOf time.Time
+}
+
+// CoView is a product viewed together with another: Visitors counted
+// views of both within a day.
+type CoView struct {
+	ProductID int
+	Visitors  int64
+}
+
+type ZeroResultQuery struct {
+	Query    string `json:"query"`
+	Searches int64  `json:"searches"`
+	LastSeen string `json:"lastSeen"`
+}
+
+type QueryConversion struct {
+	Query           string  `json:"query"`
+	Searches        int64   `json:"searches"`
+	ClickedSearches int64   `json:"clickedSearches"`
+	Clicks          int64   `json:"clicks"`
+	ConversionRate  float64 `json:"conversionRate"`
+}
+
+type SearchReport struct {
+	ZeroResults []ZeroResultQuery
+	Conversion  []QueryConversion
+	AsOf        time.Time // as in Summary
+}
+
+type ProductStore interface {
+	ListProducts(ctx context.Context, q ProductQuery) ([]ProductRow, error)
+	CountProducts(ctx context.Context, q ProductQuery) (int64, error)
+	// GetProduct returns ErrNotFound for an unknown id.
+	GetProduct(ctx context.Context, id int) (Product, error)
+	// GetProducts returns the existing products among ids, ordered by id.
+	GetProducts(ctx context.Context, ids []int) ([]Product, error)
+	CreateProduct(ctx context.Context, p Product) (int, error)
+	TopDeals(ctx context.Context, f OfferFilter, limit int) ([]TopDealRow, error)
+}
+
+type OfferStore interface {
+	// ListOffers returns active offers for the products, ordered by
+	// product id and then price.
+	ListOffers(ctx context.Context, productIDs []int, f OfferFilter) ([]Offer, error)
+	CreateOffer(ctx context.Context, o NewOffer) error
+	// GetOfferLink returns ErrNotFound for an unknown offer. Inactive
+	// offers are found too, so links on stale pages keep working.
+	GetOfferLink(ctx context.Context, id int64) (OfferLink, error)
+}
+
+type SpecStore interface {
+	// GetSpecs returns specs keyed by product id; products without specs
+	// are absent from the map.
+	GetSpecs(ctx context.Context, productIDs []int) (map[int]Specs, error)
+	UpsertSpecs(ctx context.Context, productID int, specs map[string]any) error
+}
+
+type AnalyticsStore interface {
+	RecordSearch(ctx context.Context, ev SearchEvent) error
+	// RecordClick stores the click, flagged as a bot or duplicate where it
+	// is one; analytics only count the others.
+	RecordClick(ctx context.Context, ev ClickEvent) (ClickResult, error)
+	// RecordView stores the view, reporting whether it repeats a counted
+	// view by the same visitor within ev.DedupeWindow.
+	RecordView(ctx context.Context, ev ViewEvent) (duplicate bool, err error)
+	Summary(ctx context.Context, days int) (Summary, error)
+	SearchReport(ctx context.Context, days int) (SearchReport, error)
+	ClickReport(ctx context.Context, q ClickQuery) (ClickReport, error)
+	// AlsoViewed returns the products most often viewed together with
+	// productID, most visitors first.
+	AlsoViewed(ctx context.Context, productID, limit int) ([]CoView, error)
+	// Export calls emit with each row of q in time order, without holding
+	// the result in memory; an error from emit stops it and is returned.
+	Export(ctx context.Context, q ExportQuery, emit func(ExportRow) error) error
+}
+
+// AdminStore holds admin accounts created with "comparehub create-admin".
+// Emails are compared case-insensitively.
+type AdminStore interface {
+	// UpsertAdmin creates the account or replaces its password hash.
+	UpsertAdmin(ctx context.Context, email, passwordHash string) error
+	// AdminPasswordHash returns ErrNotFound for an unknown email.
+	AdminPasswordHash(ctx context.Context, email string) (string, error)
+}
+
+// Stores bundles the implementations the HTTP layer is wired with.
+type Stores struct {
+	Products  ProductStore
+	Offers    OfferStore
+	Specs     SpecStore
+	Analytics AnalyticsStore
+	Admins    AdminStore
+}
+
+// StoreKey is the form store names are compared in: lower case, no spaces.
+func StoreKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", ""))
+}
+
+// StoreKeys maps names through StoreKey, dropping empties.
+func StoreKeys(names []string) []string {
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		if k := StoreKey(n); k != "" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// SortValue is the value a ProductRow is ordered by under sort; it is what
+// goes into a Keyset.
+func SortValue(sort string, r ProductRow) float64 {
+	if sort == "rating" {
+		return r.BestRating
+	}
+	return r.BestPrice
+}
+
+// SortDescending reports whether sort orders from high to low.
+func SortDescending(sort string) bool {
+	return sort == "high" || sort == "rating"
+}
@@ -0,0 +1,168 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSVColumns is the header written by WriteCSV and understood by ReadCSV.
+// One row per offer; a product without offers has empty offer columns.
+var CSVColumns = []string{
+	"name", "brand", "category", "description", "image_url",
+	"store", "price", "rating", "url", "condition",
+}
+
+// ReadCSV parses a CSV import into a Feed. Columns are matched by header
+// name (case-insensitive, any order); only "name" is required, and offer
+// columns may be left empty for products without offers. Rows with the
+// same name and brand are merged into one product.
+func ReadCSV(r io.Reader, source string) (Feed, error) {
+	f := Feed{Source: source}
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return f, fmt.Errorf("csv header: %w", err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := col["name"]; !ok {
+		return f, fmt.Errorf("csv header: missing required column %q", "name")
+	}
+
+	index := map[string]int{} // name|brand -> position in f.Products
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return f, err
+		}
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+
+		p := FeedProduct{
+			Name: get("name"), Brand: get("brand"), Category: get("category"),
+			Description: get("description"), ImageURL: get("image_url"),
+		}
+		if p.Name == "" {
+			return f, fmt.Errorf("csv line %d: name is required", line)
+		}
+		key := strings.ToLower(p.Name + "|" + p.Brand)
+		pos, ok := index[key]
+		if !ok {
+			pos = len(f.Products)
+			index[key] = pos
+			f.Products = append(f.Products, p)
+		}
+
+		store := get("store")
+		if store == "" {
+			continue
+		}
+		price, err := strconv.ParseFloat(get("price"), 64)
+		if err != nil || price <= 0 {
+			return f, fmt.Errorf("csv line %d: invalid price %q", line, get("price"))
+		}
+		o := FeedOffer{StoreName: store, Price: price, URL: get("url"), Condition: get("condition")}
+		if o.URL == "" {
+			return f, fmt.Errorf("csv line %d: url is required for an offer", line)
+		}
+		if v := get("rating"); v != "" {
+			rating, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return f, fmt.Errorf("csv line %d: invalid rating %q", line, v)
+			}
+			o.Rating = &rating
+		}
+		f.Products[pos].Offers = append(f.Products[pos].Offers, o)
+	}
+	return f, nil
+}
+
+// WriteCSV writes f in the CSVColumns layout.
+func WriteCSV(w io.Writer, f Feed) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVColumns); err != nil {
+		return err
+	}
+	for _, p := range f.Products {
+		base := []string{p.Name, p.Brand, p.Category, p.Description, p.ImageURL}
+		if len(p.Offers) == 0 {
+			if err := cw.Write(append(base, "", "", "", "", "")); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, o := range p.Offers {
+			rating := ""
+			if o.Rating != nil {
+				rating = strconv.FormatFloat(*o.Rating, 'f', -1, 64)
+			}
+			row := append(append([]string{}, base...),
+				o.StoreName, strconv.FormatFloat(o.Price, 'f', 2, 64), rating, o.URL, o.Condition)
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Export reads every product with its active offers as a Feed, so the
+// output can be fed back through Apply or written with WriteCSV.
+func Export(ctx context.Context, conn *sql.DB) (Feed, error) {
+	f := Feed{Source: "export", Products: []FeedProduct{}}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT p.name, COALESCE(p.brand,''), COALESCE(p.category,''),
+		       COALESCE(p.description,''), COALESCE(p.image_url,''),
+		       s.name, o.price, o.rating, o.url, o.condition
+		FROM products p
+		LEFT JOIN offers o ON o.product_id = p.id AND o.active = true
+		LEFT JOIN stores s ON s.id = o.store_id
+		ORDER BY p.id, o.price;
+	`)
+	if err != nil {
+		return f, err
+	}
+	defer rows.Close()
+
+	last := ""
+	for rows.Next() {
+		var p FeedProduct
+		var store, url, condition sql.NullString
+		var price sql.NullFloat64
+		var rating *float64
+		if err := rows.Scan(&p.Name, &p.Brand, &p.Category, &p.Description, &p.ImageURL,
+			&store, &price, &rating, &url, &condition); err != nil {
+			return f, err
+		}
+		key := p.Name + "|" + p.Brand
+		if key != last {
+			f.Products = append(f.Products, p)
+			last = key
+		}
+		if store.Valid {
+			cur := &f.Products[len(f.Products)-1]
+			cur.Offers = append(cur.Offers, FeedOffer{
+				StoreName: store.String, Price: price.Float64, Rating: rating,
+				URL: url.String, Condition: condition.String,
+			})
+		}
+	}
+	return f, rows.Err()
+}
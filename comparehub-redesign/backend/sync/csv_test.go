@@ -0,0 +1,55 @@
+package syncer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	in := `Name,Brand,Category,Store,Price,Rating,URL,Condition
+Pixel 8,Google,Phones,Amazon,599,4.5,https://a.example/pixel,
+Pixel 8,Google,Phones,Best Buy,579.99,,https://b.example/pixel,Used
+Framework 13,Framework,Laptops,,,,,
+`
+	f, err := ReadCSV(strings.NewReader(in), "csv:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Products) != 2 {
+		t.Fatalf("got %d products, want 2", len(f.Products))
+	}
+	pixel := f.Products[0]
+	if len(pixel.Offers) != 2 || pixel.Offers[1].Condition != "Used" || pixel.Offers[1].Rating != nil {
+		t.Fatalf("pixel offers %+v", pixel.Offers)
+	}
+	if *pixel.Offers[0].Rating != 4.5 || len(f.Products[1].Offers) != 0 {
+		t.Fatalf("unexpected feed %+v", f)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	again, err := ReadCSV(&buf, "csv:again")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Products) != 2 || len(again.Products[0].Offers) != 2 || again.Products[0].Offers[1].Price != 579.99 {
+		t.Fatalf("round trip lost data: %+v", again)
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	cases := map[string]string{
+		"missing name column": "brand,store\nGoogle,Amazon\n",
+		"empty name":          "name,store,price,url\n,Amazon,1,u\n",
+		"bad price":           "name,store,price,url\nPixel,Amazon,abc,u\n",
+		"offer without url":   "name,store,price,url\nPixel,Amazon,10,\n",
+	}
+	for name, in := range cases {
+		if _, err := ReadCSV(strings.NewReader(in), "t"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go-ecommerce-backend/job"
+	"go-ecommerce-backend/logging"
+)
+
+// Runner serializes feed syncs for one process (see job.Runner): the
+// scheduled loop and /admin/sync-now never overlap, and shutdown can wait
+// for the run in progress instead of cutting it off halfway.
+type Runner struct {
+	job      *job.Runner[Result]
+	feedPath string
+
+	// OnSync, if set, runs after every run, failed ones included: a run
+	// that stopped halfway may still have written part of the feed. The
+	// server uses it to invalidate the response cache.
+	OnSync func(ctx context.Context, res Result, err error)
+}
+
+// NewRunner returns a Runner syncing feedPath into conn. Each run is
+// bounded by timeout (0 means no limit).
+func NewRunner(conn *sql.DB, feedPath string, timeout time.Duration) *Runner {
+	r := &Runner{feedPath: feedPath}
+	r.job = job.New(func(ctx context.Context) (Result, error) {
+		res, err := RunOnce(ctx, conn, feedPath)
+		if r.OnSync != nil {
+			r.OnSync(ctx, res, err)
+		}
+		return res, err
+	}, timeout)
+	return r
+}
+
+// RunOnce performs one sync, waiting for a run already in progress first.
+// Like every job run it is detached from ctx's cancellation; only the
+// Runner's timeout stops it.
+func (r *Runner) RunOnce(ctx context.Context) (Result, error) {
+	return r.job.RunOnce(ctx)
+}
+
+// RunEvery syncs immediately and then every interval until ctx is done.
+// A run in progress when ctx is cancelled is allowed to finish; use Wait
+// to block until it has.
+func (r *Runner) RunEvery(ctx context.Context, interval time.Duration) {
+	r.job.RunEvery(ctx, interval, func(ctx context.Context, _ Result, err error) {
+		if err != nil {
+			logging.FromContext(ctx).Error("scheduled sync failed", "feed", r.feedPath, "err", err)
+		}
+	})
+}
+
+// Wait blocks until every RunEvery loop has returned and no run is in
+// progress, or until ctx is done.
+func (r *Runner) Wait(ctx context.Context) error {
+	return r.job.Wait(ctx)
+}
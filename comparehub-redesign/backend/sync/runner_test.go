@@ -0,0 +1,27 @@
+package syncer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunnerStopsOnCancel(t *testing.T) {
+	// A missing feed fails before touching the database, so no conn is needed.
+	r := NewRunner(nil, filepath.Join(t.TempDir(), "missing.json"), time.Second)
+	if _, err := r.RunOnce(context.Background()); err == nil {
+		t.Fatal("expected an error for a missing feed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go r.RunEvery(ctx, time.Hour)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	wctx, wcancel := context.WithTimeout(context.Background(), time.Second)
+	defer wcancel()
+	if err := r.Wait(wctx); err != nil {
+		t.Fatalf("RunEvery did not stop after cancel: %v", err)
+	}
+}
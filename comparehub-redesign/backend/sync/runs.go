@@ -0,0 +1,51 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go-ecommerce-backend/logging"
+)
+
+// recordRun stores a finished run in sync_runs. It uses its own deadline so
+// that a run stopped by its timeout is still recorded as failed.
+func recordRun(ctx context.Context, conn *sql.DB, res Result, started time.Time, runErr error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	var msg sql.NullString
+	if runErr != nil {
+		msg = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+	_, err := conn.ExecContext(ctx, `
+		INSERT INTO sync_runs (run_id, source, started_at, ok, products, offers, errors, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, res.RunID, res.Source, started, runErr == nil, res.Products, res.Offers, res.Errors, msg)
+	if err != nil {
+		logging.FromContext(ctx).Warn("recording sync run failed", "err", err)
+	}
+}
+
+// LastSuccess returns when each feed source last finished a sync without
+// failing.
+func LastSuccess(ctx context.Context, conn *sql.DB) (map[string]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT source, MAX(finished_at) FROM sync_runs WHERE ok GROUP BY source
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]time.Time{}
+	for rows.Next() {
+		var source string
+		var at time.Time
+		if err := rows.Scan(&source, &at); err != nil {
+			return nil, err
+		}
+		out[source] = at
+	}
+	return out, rows.Err()
+}
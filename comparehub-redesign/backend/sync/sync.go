@@ -2,13 +2,23 @@ package syncer
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
-	"log"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+
+	"go-ecommerce-backend/logging"
+	"go-ecommerce-backend/metrics"
+	"go-ecommerce-backend/tracing"
 )
 
 // Normalize categories coming from feeds so filters and compare rows are consistent.
@@ -34,6 +44,10 @@ func normalizeCategory(cat string) string {
 	}
 }
 
+// lockID is the pg_advisory_lock key that serializes syncs and imports
+// across processes ("chsyncer").
+const lockID int64 = 0x636873796e636572
+
 type Feed struct {
 	Source   string        `json:"source"`
 	Products []FeedProduct  `json:"products"`
@@ -53,6 +67,7 @@ type FeedOffer struct {
 	Price     float64  `json:"price"`
 	Rating    *float64 `json:"rating"`
 	URL       string   `json:"url"`
+	Condition string   `json:"condition,omitempty"` // defaults to "New"
 }
 
 
@@ -81,41 +96,184 @@ type simpleErr string
 func (e simpleErr) Error() string { return string(e) }
 func fmtErr(s string) error { return simpleErr(s) }
 
-func RunEvery(conn *sql.DB, interval time.Duration, feedPath string) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// Options control a sync or import run.
+type Options struct {
+	// DryRun only reads: it reports what would be inserted without writing.
+	DryRun bool
+	// Deactivate marks offers of the feed's stores that were not refreshed
+	// in the last 10 minutes inactive; other stores' offers are left alone.
+	// Feed syncs set it; one-off CSV imports do not.
+	Deactivate bool
+}
 
-	RunOnce(conn, feedPath)
+// Result summarizes a run.
+type Result struct {
+	// RunID tags every log line of the run (run_id) so a bad feed can be
+	// traced through its upsert errors.
+	RunID       string `json:"runId"`
+	Source      string `json:"source"`
+	DryRun      bool   `json:"dryRun"`
+	Products    int    `json:"products"`
+	NewProducts int    `json:"newProducts"`
+	Offers      int    `json:"offers"`
+	NewOffers   int    `json:"newOffers"`
+	Errors      int    `json:"errors"`
+	Deactivated int64  `json:"deactivated"`
+}
 
-	for range ticker.C {
-		RunOnce(conn, feedPath)
+// ReadFeed reads and parses a JSON feed file.
+func ReadFeed(feedPath string) (Feed, error) {
+	var f Feed
+	b, err := readFeedWithRetry(feedPath, 4)
+	if err != nil {
+		return f, err
 	}
+	// If the JSON was valid but doesn't match the expected schema, this fails.
+	err = json.Unmarshal(b, &f)
+	return f, err
 }
 
-func RunOnce(conn *sql.DB, feedPath string) {
-	b, err := readFeedWithRetry(feedPath, 4)
+// RunOnce reads the feed at feedPath and applies it with deactivation.
+// It is traced as a "sync.run" span with "sync.read_feed" and the Apply
+// phases as children.
+func RunOnce(ctx context.Context, conn *sql.DB, feedPath string) (res Result, err error) {
+	ctx, span := tracing.Start(ctx, "sync.run", attribute.String("sync.feed", feedPath))
+	defer func() { tracing.End(span, err) }()
+
+	_, readSpan := tracing.Start(ctx, "sync.read_feed")
+	f, err := ReadFeed(feedPath)
+	tracing.End(readSpan, err)
 	if err != nil {
-		log.Println("sync: read/validate feed error:", err)
-		return
+		return Result{}, fmt.Errorf("read/validate feed: %w", err)
 	}
+	return Apply(ctx, conn, f, Options{Deactivate: true})
+}
 
-	var f Feed
-	if err := json.Unmarshal(b, &f); err != nil {
-		// If the JSON was valid but doesn't match the expected schema, we land here.
-		log.Println("sync: json parse error:", err)
-		return
+// Apply upserts the feed's products, stores and offers. Row errors are
+// logged and counted; only failures of the run as a whole are returned.
+// Cancelling ctx stops the run before the next product; products already
+// written stay written. Runs that write hold an advisory lock, so a CLI
+// sync or import waits for the server's sync (and vice versa) instead of
+// interleaving with it.
+func Apply(ctx context.Context, conn *sql.DB, f Feed, opts Options) (Result, error) {
+	res := Result{RunID: newRunID(), Source: f.Source, DryRun: opts.DryRun}
+	logger := logging.FromContext(ctx).With("run_id", res.RunID, "source", f.Source)
+	ctx = logging.WithLogger(ctx, logger)
+	ctx, span := tracing.Start(ctx, "sync.apply",
+		attribute.String("sync.run_id", res.RunID),
+		attribute.String("sync.source", f.Source),
+		attribute.Bool("sync.dry_run", opts.DryRun),
+		attribute.Int("sync.feed_products", len(f.Products)))
+	if opts.DryRun {
+		res, err := dryRun(ctx, conn, f, res)
+		tracing.End(span, err)
+		return res, err
+	}
+
+	unlock, err := lock(ctx, conn)
+	if err != nil {
+		tracing.End(span, err)
+		return res, fmt.Errorf("sync lock: %w", err)
+	}
+	defer unlock()
+
+	start := time.Now()
+	logger.Info("sync started", "products", len(f.Products))
+	res, err = apply(ctx, conn, f, opts, res)
+	attrs := []any{
+		"duration_ms", time.Since(start).Milliseconds(),
+		"products", res.Products, "new_products", res.NewProducts,
+		"offers", res.Offers, "new_offers", res.NewOffers,
+		"deactivated", res.Deactivated, "errors", res.Errors,
+	}
+	if err != nil {
+		logger.Error("sync failed", append(attrs, "err", err)...)
+	} else {
+		logger.Info("sync complete", attrs...)
+	}
+	metrics.ObserveSync(metrics.SyncRun{
+		Source: f.Source, Duration: time.Since(start),
+		Products: res.Products, NewProducts: res.NewProducts,
+		Offers: res.Offers, NewOffers: res.NewOffers,
+		Deactivated: res.Deactivated, Errors: res.Errors, Failed: err != nil,
+	})
+	recordRun(ctx, conn, res, start, err)
+	span.SetAttributes(attribute.Int("sync.errors", res.Errors))
+	tracing.End(span, err)
+	return res, err
+}
+
+// lock takes the sync lock on a connection of its own; the lock is
+// session scoped, so it is released on that connection too.
+func lock(ctx context.Context, conn *sql.DB) (unlock func(), err error) {
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return func() {
+		// A fresh context so a run stopped by its timeout still unlocks.
+		if _, err := c.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+			logging.FromContext(ctx).Warn("releasing sync lock failed", "err", err)
+		}
+		c.Close()
+	}, nil
+}
+
+// apply runs the upsert phase and then, if asked, the deactivation phase,
+// each in its own span.
+func apply(ctx context.Context, conn *sql.DB, f Feed, opts Options, res Result) (Result, error) {
+	upsertCtx, span := tracing.Start(ctx, "sync.upsert")
+	res, stores, err := upsertFeed(upsertCtx, conn, f, res)
+	span.SetAttributes(
+		attribute.Int("sync.products", res.Products),
+		attribute.Int("sync.offers", res.Offers),
+		attribute.Int("sync.errors", res.Errors))
+	tracing.End(span, err)
+	if err != nil || !opts.Deactivate {
+		return res, err
+	}
+
+	// Step 8.5 Deactivate offers not seen recently (optional but high-end)
+	// Mark offers of this feed's stores inactive if they were not updated in
+	// the last 10 minutes; another source's stores are not this feed's to
+	// retire.
+	ctx, span = tracing.Start(ctx, "sync.deactivate")
+	r, err := conn.ExecContext(ctx, `
+		UPDATE offers
+		SET active = false
+		WHERE active AND store_id = ANY($1) AND last_seen_at < NOW() - INTERVAL '10 minutes';
+	`, pq.Array(stores))
+	if err == nil {
+		res.Deactivated, _ = r.RowsAffected()
+		span.SetAttributes(attribute.Int64("sync.deactivated", res.Deactivated))
 	}
+	tracing.End(span, err)
+	return res, err
+}
 
-	log.Println("🔄 Sync feed:", f.Source, "products:", len(f.Products))
+// upsertFeed upserts every product, store and offer of f and returns the
+// IDs of the stores it wrote offers for.
+func upsertFeed(ctx context.Context, conn *sql.DB, f Feed, res Result) (Result, []int64, error) {
+	logger := logging.FromContext(ctx)
 
-	// Track offers seen in this run (for deactivation step)
+	// Track offers and stores seen in this run (for deactivation step)
 	seen := make(map[string]bool)
+	var stores []int64
+	seenStores := make(map[int64]bool)
 
 	for _, fp := range f.Products {
+		if err := ctx.Err(); err != nil {
+			return res, stores, err
+		}
 		cat := normalizeCategory(fp.Category)
-		// Upsert product
+		// Upsert product; xmax = 0 only for freshly inserted rows.
 		var productID int
-		err := conn.QueryRow(`
+		var inserted bool
+		err := conn.QueryRowContext(ctx, `
 			INSERT INTO products (name, brand, category, description, image_url)
 			VALUES ($1,$2,$3,$4,$5)
 			ON CONFLICT (name, brand)
@@ -123,18 +281,23 @@ func RunOnce(conn *sql.DB, feedPath string) {
 			  category=EXCLUDED.category,
 			  description=EXCLUDED.description,
 			  image_url=EXCLUDED.image_url
-			RETURNING id;
-		`, fp.Name, fp.Brand, cat, fp.Description, fp.ImageURL).Scan(&productID)
+			RETURNING id, (xmax = 0);
+		`, fp.Name, fp.Brand, cat, fp.Description, fp.ImageURL).Scan(&productID, &inserted)
 
 		if err != nil {
-			log.Println("sync: product upsert error:", err)
+			logger.Warn("product upsert failed", "product", fp.Name, "brand", fp.Brand, "err", err)
+			res.Errors++
 			continue
 		}
+		res.Products++
+		if inserted {
+			res.NewProducts++
+		}
 
 		for _, fo := range fp.Offers {
 			// Upsert store
 			var storeID int
-			err := conn.QueryRow(`
+			err := conn.QueryRowContext(ctx, `
 				INSERT INTO stores (name)
 				VALUES ($1)
 				ON CONFLICT (name) DO UPDATE SET name=EXCLUDED.name
@@ -142,43 +305,90 @@ func RunOnce(conn *sql.DB, feedPath string) {
 			`, fo.StoreName).Scan(&storeID)
 
 			if err != nil {
-				log.Println("sync: store upsert error:", err)
+				logger.Warn("store upsert failed", "product", fp.Name, "store", fo.StoreName, "err", err)
+				res.Errors++
 				continue
 			}
 
 			// Offer unique key marker
 			key := makeKey(productID, storeID, fo.URL)
 			seen[key] = true
+			if !seenStores[int64(storeID)] {
+				seenStores[int64(storeID)] = true
+				stores = append(stores, int64(storeID))
+			}
 
 			// Upsert offer
-			_, err = conn.Exec(`
-				INSERT INTO offers (product_id, store_id, price, rating, url, active, last_seen_at)
-				VALUES ($1,$2,$3,$4,$5,true,NOW())
+			err = conn.QueryRowContext(ctx, `
+				INSERT INTO offers (product_id, store_id, price, rating, url, condition, active, last_seen_at)
+				VALUES ($1,$2,$3,$4,$5,COALESCE(NULLIF($6,''),'New'),true,NOW())
 				ON CONFLICT (product_id, store_id, url)
 				DO UPDATE SET
 				  price=EXCLUDED.price,
 				  rating=EXCLUDED.rating,
+				  condition=EXCLUDED.condition,
 				  active=true,
-				  last_seen_at=NOW();
-			`, productID, storeID, fo.Price, fo.Rating, fo.URL)
+				  last_seen_at=NOW()
+				RETURNING (xmax = 0);
+			`, productID, storeID, fo.Price, fo.Rating, fo.URL, fo.Condition).Scan(&inserted)
 
 			if err != nil {
-				log.Println("sync: offer upsert error:", err)
+				logger.Warn("offer upsert failed", "product", fp.Name, "store", fo.StoreName, "url", fo.URL, "err", err)
+				res.Errors++
 				continue
 			}
+			res.Offers++
+			if inserted {
+				res.NewOffers++
+			}
 		}
 	}
 
-	// Step 8.5 Deactivate offers not seen recently (optional but high-end)
-	// Mark offers inactive if they were not updated in the last 10 minutes
-	// (safe logic for demo; in production you’d compare against the seen map more directly)
-	_, _ = conn.Exec(`
-		UPDATE offers
-		SET active = false
-		WHERE last_seen_at < NOW() - INTERVAL '10 minutes';
-	`)
+	return res, stores, nil
+}
 
-	log.Println("✅ Sync complete")
+// dryRun counts what Apply would insert using read-only lookups.
+func dryRun(ctx context.Context, conn *sql.DB, f Feed, res Result) (Result, error) {
+	for _, fp := range f.Products {
+		res.Products++
+		var productID int
+		err := conn.QueryRowContext(ctx, `SELECT id FROM products WHERE name = $1 AND brand = $2`, fp.Name, fp.Brand).Scan(&productID)
+		if err == sql.ErrNoRows {
+			res.NewProducts++
+			res.Offers += len(fp.Offers)
+			res.NewOffers += len(fp.Offers)
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+
+		for _, fo := range fp.Offers {
+			res.Offers++
+			var exists bool
+			err := conn.QueryRowContext(ctx, `
+				SELECT EXISTS (
+				  SELECT 1 FROM offers o JOIN stores s ON s.id = o.store_id
+				  WHERE o.product_id = $1 AND s.name = $2 AND o.url = $3
+				)
+			`, productID, fo.StoreName, fo.URL).Scan(&exists)
+			if err != nil {
+				return res, err
+			}
+			if !exists {
+				res.NewOffers++
+			}
+		}
+	}
+	return res, nil
+}
+
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
 }
 
 func makeKey(productID, storeID int, url string) string {
@@ -186,6 +396,6 @@ func makeKey(productID, storeID int, url string) string {
 }
 
 func fmtInt(n int) string {
-	// tiny helper without importing fmt (keeps imports small)
+	// tiny helper
 	return strconv.Itoa(n)
 }
@@ -0,0 +1,97 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"go-ecommerce-backend/migrate"
+)
+
+// testDatabaseEnv names a scratch database for the tests that write (the
+// same one the store/postgres benchmarks use):
+//
+//	COMPAREHUB_TEST_DATABASE_URL=postgres://localhost/comparehub_bench?sslmode=disable \
+//	  go test ./sync -run Deactivate
+const testDatabaseEnv = "COMPAREHUB_TEST_DATABASE_URL"
+
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		t.Skip(testDatabaseEnv + " not set")
+	}
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err := migrate.New(conn).Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestDeactivateKeepsOtherSources(t *testing.T) {
+	conn := testDB(t)
+	ctx := context.Background()
+
+	// Store and product names are unique to this run, so the test neither
+	// sees nor touches anything else in the database.
+	tag := fmt.Sprintf("%d", time.Now().UnixNano())
+	alpha, beta := "Alpha "+tag, "Beta "+tag
+	feed := func(source, store string, urls ...string) Feed {
+		p := FeedProduct{Name: "Deactivate " + tag, Brand: "Test", Category: "Phones"}
+		for _, u := range urls {
+			p.Offers = append(p.Offers, FeedOffer{StoreName: store, Price: 10, URL: "https://example.com/" + tag + "/" + u})
+		}
+		return Feed{Source: source, Products: []FeedProduct{p}}
+	}
+	sync := func(f Feed) Result {
+		t.Helper()
+		res, err := Apply(ctx, conn, f, Options{Deactivate: true})
+		if err != nil {
+			t.Fatalf("sync %s: %v", f.Source, err)
+		}
+		return res
+	}
+	// age makes the offers of both stores look last seen an hour ago, as if
+	// the next sync ran much later.
+	age := func() {
+		t.Helper()
+		if _, err := conn.ExecContext(ctx, `
+			UPDATE offers SET last_seen_at = NOW() - INTERVAL '1 hour'
+			WHERE store_id IN (SELECT id FROM stores WHERE name = ANY($1))
+		`, pq.Array([]string{alpha, beta})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	active := func(u string) bool {
+		t.Helper()
+		var ok bool
+		if err := conn.QueryRowContext(ctx, `SELECT active FROM offers WHERE url = $1`,
+			"https://example.com/"+tag+"/"+u).Scan(&ok); err != nil {
+			t.Fatalf("offer %s: %v", u, err)
+		}
+		return ok
+	}
+
+	sync(feed("alpha", alpha, "a1"))
+	sync(feed("beta", beta, "b1", "b2"))
+	age()
+
+	// beta no longer lists b2: only that offer goes, alpha's stays active.
+	if res := sync(feed("beta", beta, "b1")); res.Deactivated != 1 {
+		t.Errorf("deactivated %d offers, want 1", res.Deactivated)
+	}
+	for u, want := range map[string]bool{"a1": true, "b1": true, "b2": false} {
+		if got := active(u); got != want {
+			t.Errorf("offer %s active = %v, want %v", u, got, want)
+		}
+	}
+}
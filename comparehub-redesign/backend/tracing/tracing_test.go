@@ -0,0 +1,81 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	syncer "go-ecommerce-backend/sync"
+	"go-ecommerce-backend/tracing"
+)
+
+func setup(t *testing.T) *tracetest.InMemoryExporter {
+	exp := tracetest.NewInMemoryExporter()
+	tp := tracing.NewProvider(sdktrace.WithSyncer(exp))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return exp
+}
+
+func TestRequestAndQuerySpans(t *testing.T) {
+	exp := setup(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(tracing.Middleware())
+	r.GET("/compare", func(c *gin.Context) {
+		for _, stmt := range []string{"products.get_many", "offers.list", "specs.get"} {
+			_, span := tracing.StartQuery(c.Request.Context(), stmt)
+			tracing.End(span, nil)
+		}
+		c.Status(200)
+	})
+
+	req := httptest.NewRequest("GET", "/compare?ids=1,2", nil)
+	// Continue the caller's trace.
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exp.GetSpans()
+	if len(spans) != 4 {
+		t.Fatalf("got %d spans, want 3 queries + 1 request", len(spans))
+	}
+	server := spans[3]
+	if server.Name != "GET /compare" {
+		t.Errorf("server span name = %q", server.Name)
+	}
+	if got := server.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("incoming trace not continued: %s", got)
+	}
+	for i, want := range []string{"db products.get_many", "db offers.list", "db specs.get"} {
+		if spans[i].Name != want {
+			t.Errorf("span %d = %q, want %q", i, spans[i].Name, want)
+		}
+		if spans[i].Parent.SpanID() != server.SpanContext.SpanID() {
+			t.Errorf("%s is not a child of the request span", spans[i].Name)
+		}
+	}
+}
+
+func TestSyncPhaseSpans(t *testing.T) {
+	exp := setup(t)
+	// A missing feed fails in the read phase, before any query.
+	_, err := syncer.RunOnce(context.Background(), nil, filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "sync.read_feed" || spans[1].Name != "sync.run" {
+		t.Fatalf("spans = %v", spans)
+	}
+	for _, s := range spans {
+		if s.Status.Code != codes.Error {
+			t.Errorf("%s: status = %v, want error", s.Name, s.Status.Code)
+		}
+	}
+}
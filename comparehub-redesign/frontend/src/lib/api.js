@@ -54,3 +54,27 @@ export function withFilters(path) {
   // return only pathname+search (keeps your API_BASE usage consistent)
   return url.pathname + url.search;
 }
+
+// Random id for this browser tab session, sent with tracked events so the
+// backend can tell a repeat click from a new visitor. It lives only as long
+// as the tab and is stored hashed.
+export function sessionId() {
+  let id = sessionStorage.getItem("ch_session_id");
+  if (!id) {
+    id = crypto.randomUUID?.() || `${Date.now().toString(36)}-${Math.random().toString(36).slice(2)}`;
+    sessionStorage.setItem("ch_session_id", id);
+  }
+  return id;
+}
+
+// Where an offer's "Buy" button points: the backend's /go/ redirect, which
+// records the click and adds affiliate parameters, or the raw store URL
+// for offers from an older backend without links.
+export function outboundUrl(offer) {
+  if (!offer?.link) return offer?.url || null;
+  const url = new URL(offer.link, API_BASE);
+  const searchId = sessionStorage.getItem("ch_search_id");
+  if (searchId) url.searchParams.set("s", searchId);
+  url.searchParams.set("sid", sessionId());
+  return url.toString();
+}
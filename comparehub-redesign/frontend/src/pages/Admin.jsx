@@ -31,6 +31,14 @@ export default function Admin() {
     url: "",
   });
 
+  const [exportForm, setExportForm] = useState({
+    dataset: "clicks",
+    granularity: "day",
+    format: "csv",
+    from: "",
+    to: "",
+  });
+
   const [specProductId, setSpecProductId] = useState("");
   const [specJSON, setSpecJSON] = useState(
     `{
@@ -216,6 +224,40 @@ export default function Admin() {
     }
   };
 
+  // -----------------------------
+  // Export analytics (CSV / NDJSON)
+  // -----------------------------
+  const exportAnalytics = async (e) => {
+    e.preventDefault();
+    try {
+      const params = new URLSearchParams();
+      Object.entries(exportForm).forEach(([k, v]) => v && params.set(k, v));
+
+      const res = await fetch(`${API_BASE}/admin/analytics/export?${params}`, {
+        headers: { Authorization: `Bearer ${token}` },
+      });
+
+      if (await handleAuthError(res)) return;
+      if (!res.ok) {
+        const data = await res.json().catch(() => ({}));
+        throw new Error(data.error || "Export failed");
+      }
+
+      // Save under the server's file name.
+      const name =
+        res.headers.get("Content-Disposition")?.match(/filename="([^"]+)"/)?.[1] ||
+        `comparehub-${exportForm.dataset}.${exportForm.format}`;
+      const url = URL.createObjectURL(await res.blob());
+      const a = document.createElement("a");
+      a.href = url;
+      a.download = name;
+      a.click();
+      URL.revokeObjectURL(url);
+    } catch (err) {
+      alert(err.message);
+    }
+  };
+
   // -----------------------------
   // UI
   // -----------------------------
@@ -417,6 +459,58 @@ export default function Admin() {
         </div>
       </form>
 
+      {/* Export analytics */}
+      <form onSubmit={exportAnalytics} className="rounded-2xl border border-slate-200 bg-white shadow-sm p-5">
+        <h3 className="text-lg font-extrabold text-slate-900">Export Analytics</h3>
+        <p className="text-sm text-slate-600 mt-1">
+          Download raw events or their rollups for a date range (defaults to the last 30 days).
+        </p>
+
+        <div className="mt-4 grid grid-cols-2 lg:grid-cols-6 gap-3">
+          <select
+            value={exportForm.dataset}
+            onChange={(e) => setExportForm({ ...exportForm, dataset: e.target.value })}
+            className="rounded-xl border border-slate-200 bg-white px-4 py-3 text-sm outline-none focus:ring-2 focus:ring-indigo-500"
+          >
+            <option value="clicks">Clicks</option>
+            <option value="views">Product views</option>
+            <option value="searches">Searches</option>
+            <option value="event-rollups">View & click rollups</option>
+            <option value="search-rollups">Search rollups</option>
+          </select>
+          <select
+            value={exportForm.granularity}
+            onChange={(e) => setExportForm({ ...exportForm, granularity: e.target.value })}
+            disabled={!exportForm.dataset.endsWith("rollups")}
+            className="rounded-xl border border-slate-200 bg-white px-4 py-3 text-sm outline-none focus:ring-2 focus:ring-indigo-500 disabled:opacity-50"
+          >
+            <option value="day">Daily</option>
+            <option value="hour">Hourly</option>
+          </select>
+          {["from", "to"].map((k) => (
+            <input
+              key={k}
+              type="date"
+              value={exportForm[k]}
+              onChange={(e) => setExportForm({ ...exportForm, [k]: e.target.value })}
+              title={k}
+              className="rounded-xl border border-slate-200 bg-white px-4 py-3 text-sm outline-none focus:ring-2 focus:ring-indigo-500"
+            />
+          ))}
+          <select
+            value={exportForm.format}
+            onChange={(e) => setExportForm({ ...exportForm, format: e.target.value })}
+            className="rounded-xl border border-slate-200 bg-white px-4 py-3 text-sm outline-none focus:ring-2 focus:ring-indigo-500"
+          >
+            <option value="csv">CSV</option>
+            <option value="ndjson">NDJSON</option>
+          </select>
+          <button className="rounded-xl bg-indigo-600 px-4 py-3 text-sm font-semibold text-white hover:bg-indigo-700 transition">
+            Download ⬇
+          </button>
+        </div>
+      </form>
+
       {/* Product overview */}
       <div className="rounded-2xl border border-slate-200 bg-white shadow-sm p-5">
         <div className="flex items-center justify-between gap-3">
@@ -1,5 +1,5 @@
 import { useEffect, useMemo, useState } from "react";
-import { Link } from "react-router-dom";
+import { Link, Navigate, useNavigate } from "react-router-dom";
 import { resolveProductImage } from "../lib/resolveProductImage";
 import { API_BASE, withFilters } from "../lib/api";
 
@@ -26,6 +26,12 @@ function StatCard({ label, value, sub, accent }) {
 }
 
 export default function Analytics() {
+  const nav = useNavigate();
+  const token = localStorage.getItem("token");
+
+  // The reports are admin only; top deals stay public.
+  if (!token) return <Navigate to="/login" replace />;
+
   const [summary, setSummary] = useState(null);
   const [topDeals, setTopDeals] = useState([]);
   const [loading, setLoading] = useState(true);
@@ -36,7 +42,16 @@ export default function Analytics() {
       setLoading(true);
       try {
         const [s, d] = await Promise.all([
-          fetch(`${API_BASE}${withFilters("/analytics/summary")}`).then(r => r.json()),
+          fetch(`${API_BASE}${withFilters("/admin/analytics/summary")}`, {
+            headers: { Authorization: `Bearer ${token}` },
+          }).then(r => {
+            if (r.status === 401 || r.status === 403) {
+              localStorage.removeItem("token");
+              nav("/login");
+              return null;
+            }
+            return r.json();
+          }),
           fetch(`${API_BASE}${withFilters("/analytics/top-deals")}`).then(r => r.json()),
         ]);
         if (!ignore) { setSummary(s); setTopDeals(Array.isArray(d) ? d : []); }
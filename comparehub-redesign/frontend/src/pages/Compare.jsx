@@ -2,7 +2,7 @@ import { useEffect, useMemo, useState } from "react";
 import { Link, useSearchParams } from "react-router-dom";
 import { resolveProductImage } from "../lib/resolveProductImage";
 import { normalizeCategory } from "../lib/normalizeCategory";
-import { API_BASE, withFilters } from "../lib/api";
+import { API_BASE, outboundUrl, withFilters } from "../lib/api";
 
 function money(n) {
   const x = Number(n);
@@ -35,7 +35,7 @@ function parseIdsParam(sp) {
 function bestOfferFromOffers(offers = []) {
   const valid = (Array.isArray(offers) ? offers : [])
     .filter(o => Number.isFinite(Number(o?.price)) && Number(o.price) > 0)
-    .map(o => ({ source: o.source || "", price: Number(o.price), rating: o.rating != null ? Number(o.rating) : null, url: o.url || null }));
+    .map(o => ({ source: o.source || "", price: Number(o.price), rating: o.rating != null ? Number(o.rating) : null, url: o.url || null, link: o.link || null }));
   if (!valid.length) return null;
   valid.sort((a, b) => {
     if (a.price !== b.price) return a.price - b.price;
@@ -115,7 +115,7 @@ export default function Compare() {
           const detail = detailById.get(p.id);
 
           let finalOffers = co, finalBestOffer = null;
-          if (hasCB) finalBestOffer = { source: p.bestOffer?.source || "", price: cb, rating: p.bestOffer?.rating ?? null, url: p.bestOffer?.url ?? null };
+          if (hasCB) finalBestOffer = { source: p.bestOffer?.source || "", price: cb, rating: p.bestOffer?.rating ?? null, url: p.bestOffer?.url ?? null, link: p.bestOffer?.link ?? null };
           else if (hasCO) finalBestOffer = bestOfferFromOffers(co);
           else { const dOffers = Array.isArray(detail?.offers) ? detail.offers : []; finalOffers = dOffers; finalBestOffer = bestOfferFromOffers(dOffers); }
 
@@ -281,7 +281,7 @@ export default function Compare() {
                       Details
                     </Link>
                     {p?.bestOffer?.url ? (
-                      <a href={p.bestOffer.url} target="_blank" rel="noreferrer" className="btn-accent">
+                      <a href={outboundUrl(p.bestOffer)} target="_blank" rel="noreferrer" className="btn-accent">
                         Buy →
                       </a>
                     ) : (
@@ -77,7 +77,14 @@ export default function Home() {
     if (minRating !== "") params.set("minRating", minRating);
 
     fetch(`${API_BASE}${withFilters(`/products?${params.toString()}`)}`)
-      .then(r => r.json())
+      .then(r => {
+        // Remember which search led to the product page so clicks can be attributed.
+        // Only searches get an id; browsing without one starts afresh.
+        const searchId = r.headers.get("X-Search-ID");
+        if (searchId) sessionStorage.setItem("ch_search_id", searchId);
+        else if (!(q || "").trim()) sessionStorage.removeItem("ch_search_id");
+        return r.json();
+      })
       .then(data => setProducts(Array.isArray(data) ? data : []))
       .catch(console.error)
       .finally(() => setLoading(false));
@@ -2,7 +2,7 @@ import { useEffect, useMemo, useState } from "react";
 import { Link, useParams } from "react-router-dom";
 import { resolveProductImage } from "../lib/resolveProductImage";
 import { normalizeCategory } from "../lib/normalizeCategory";
-import { API_BASE, withFilters } from "../lib/api";
+import { API_BASE, outboundUrl, sessionId, withFilters } from "../lib/api";
 
 function loadWishlist() {
   try { return JSON.parse(localStorage.getItem("wishlist") || "[]"); }
@@ -32,14 +32,17 @@ export default function Product() {
   const [p, setP] = useState(null);
   const [offerSort, setOfferSort] = useState("low");
   const [loading, setLoading] = useState(true);
+  const [alsoViewed, setAlsoViewed] = useState([]);
   const normalizedCategory = useMemo(() => normalizeCategory(p?.category), [p?.category]);
   const [wishlist, setWishlist] = useState(() => loadWishlist());
   const isWishlisted = useMemo(() => wishlist.some(x => String(x.id) === String(id)), [wishlist, id]);
 
   useEffect(() => {
     setLoading(true);
-    fetch(`${API_BASE}${withFilters(`/products/${id}`)}`)
+    fetch(`${API_BASE}${withFilters(`/products/${id}`)}`, { headers: { "X-Session-ID": sessionId() } })
       .then(r => r.json()).then(setP).catch(console.error).finally(() => setLoading(false));
+    fetch(`${API_BASE}${withFilters(`/products/${id}/also-viewed`)}`)
+      .then(r => (r.ok ? r.json() : [])).then(rows => setAlsoViewed(Array.isArray(rows) ? rows : [])).catch(() => setAlsoViewed([]));
   }, [id]);
 
   const offers = useMemo(() => {
@@ -63,9 +66,12 @@ export default function Product() {
     saveWishlist(next); setWishlist(next);
   };
 
-  const trackAndOpen = async (url, storeName) => {
+  const trackAndOpen = async (offer) => {
+    // /go/ links record the click themselves.
+    if (offer?.link) { window.open(outboundUrl(offer), "_blank", "noopener,noreferrer"); return; }
+    const { url, source: storeName } = offer || {};
     try {
-      await fetch(`${API_BASE}/track/click`, { method: "POST", headers: { "Content-Type": "application/json" }, body: JSON.stringify({ productId: Number(p?.id), storeName, url }) });
+      await fetch(`${API_BASE}/track/click`, { method: "POST", headers: { "Content-Type": "application/json" }, body: JSON.stringify({ productId: Number(p?.id), storeName, url, searchId: sessionStorage.getItem("ch_search_id") || "", sessionId: sessionId() }) });
     } catch {}
     if (url) window.open(url, "_blank", "noopener,noreferrer");
   };
@@ -148,7 +154,7 @@ export default function Product() {
           {/* Actions */}
           <div style={{ display: "flex", gap: "0.65rem", flexWrap: "wrap" }}>
             {bestOffer?.url ? (
-              <button className="btn-accent" onClick={() => trackAndOpen(bestOffer.url, bestOffer.source)} style={{ flex: 1 }}>
+              <button className="btn-accent" onClick={() => trackAndOpen(bestOffer)} style={{ flex: 1 }}>
                 Buy at best price →
               </button>
             ) : (
@@ -300,7 +306,7 @@ export default function Product() {
               {o.rating != null ? `★ ${Number(o.rating).toFixed(1)}` : "—"}
             </div>
             <div style={{ textAlign: "right" }}>
-              <button onClick={() => trackAndOpen(o.url, o.source)} className="btn-ghost" style={{ fontSize: "0.75rem", padding: "0.35rem 0.7rem" }}>
+              <button onClick={() => trackAndOpen(o)} className="btn-ghost" style={{ fontSize: "0.75rem", padding: "0.35rem 0.7rem" }}>
                 Visit →
               </button>
             </div>
@@ -313,6 +319,24 @@ export default function Product() {
           </div>
         )}
       </div>
+
+      {alsoViewed.length > 0 && (
+        <div>
+          <div style={{ fontFamily: "var(--font-mono)", fontSize: "0.7rem", color: "var(--text-muted)", marginBottom: "0.6rem" }}>
+            PEOPLE ALSO VIEWED
+          </div>
+          <div style={{ display: "grid", gridTemplateColumns: "repeat(auto-fill, minmax(160px, 1fr))", gap: "0.75rem" }}>
+            {alsoViewed.map(a => (
+              <Link key={a.id} to={`/product/${a.id}`} className="card" style={{ padding: "0.75rem", textDecoration: "none", color: "inherit" }}>
+                <div style={{ fontWeight: 600, fontSize: "0.85rem" }}>{a.name}</div>
+                <div style={{ fontFamily: "var(--font-mono)", fontSize: "0.8rem", color: "var(--accent)", marginTop: "0.3rem" }}>
+                  {a.bestPrice != null ? `$${Number(a.bestPrice).toFixed(2)}` : "—"}
+                </div>
+              </Link>
+            ))}
+          </div>
+        </div>
+      )}
     </div>
   );
 }